@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/archive"
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"gorm.io/gorm"
+)
+
+// runCommand 执行命令行子命令
+func runCommand(args []string) error {
+	switch args[0] {
+	case "export":
+		return exportCommand(args[1:])
+	case "import":
+		return importCommand(args[1:])
+	case "convert-roads":
+		return convertRoadsCommand(args[1:])
+	}
+	return fmt.Errorf("unknown command %q, available commands: export, import, convert-roads", args[0])
+}
+
+// exportCommand 将一个租户的数据导出为归档文件
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	tenantID := flags.Uint("tenant", 0, "要导出的租户ID")
+	output := flags.String("o", "", "归档文件路径，默认为 tenant-<ID>.zip")
+	_ = flags.Parse(args)
+	if err := requireTenant(*tenantID); err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("tenant-%d.zip", *tenantID)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	manifest, err := archive.Export(config.DB, *tenantID, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(*output)
+		return err
+	}
+	counts := manifest.Counts
+	fmt.Printf("exported tenant %d to %s: %d users, %d roads, %d road segments, %d plans, %d plan roads, %d plan segments, %d reports, %d assets, %d report assets, %d zones\n",
+		*tenantID, *output, counts.Users, counts.Roads, counts.RoadSegments, counts.Plans, counts.PlanRoads, counts.PlanSegments, counts.Reports,
+		counts.Assets, counts.ReportAssets, counts.Zones)
+	return nil
+}
+
+// importCommand 将归档文件导入一个已存在的租户，命令行导入不检查租户配额
+func importCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	tenantID := flags.Uint("tenant", 0, "导入的目标租户ID")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: import -tenant <ID> <archive.zip>")
+	}
+	if err := requireTenant(*tenantID); err != nil {
+		return err
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	data, err := archive.Read(file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	var result archive.Result
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = data.Restore(tx, *tenantID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, warning := range result.Warnings {
+		fmt.Println("warning:", warning)
+	}
+	counts := result.Imported
+	fmt.Printf("imported into tenant %d: %d users, %d roads, %d road segments, %d plans, %d plan roads, %d plan segments, %d reports, %d assets, %d report assets, %d zones\n",
+		*tenantID, counts.Users, counts.Roads, counts.RoadSegments, counts.Plans, counts.PlanRoads, counts.PlanSegments, counts.Reports,
+		counts.Assets, counts.ReportAssets, counts.Zones)
+	return nil
+}
+
+// requireTenant 检查租户存在且不是平台租户
+func requireTenant(tenantID uint) error {
+	if tenantID == tenancy.PlatformTenantID {
+		return errors.New("-tenant is required and cannot be the platform tenant")
+	}
+	var tenant model.Tenant
+	if err := config.DB.Where("id = ?", tenantID).First(&tenant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("tenant %d does not exist", tenantID)
+		}
+		return err
+	}
+	return nil
+}
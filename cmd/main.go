@@ -1,10 +1,19 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
 	"github.com/Slinet6056/road-patrol-backend/internal/config"
 	"github.com/Slinet6056/road-patrol-backend/internal/handler"
+	"github.com/Slinet6056/road-patrol-backend/internal/rbac"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
 	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
 	"github.com/Slinet6056/road-patrol-backend/pkg/middleware"
+	"github.com/Slinet6056/road-patrol-backend/pkg/token"
 	"github.com/gin-gonic/gin"
 )
 
@@ -15,43 +24,134 @@ func main() {
 	if err != nil {
 		return
 	}
+	if err := tenancy.Register(config.DB); err != nil { // 注册租户隔离回调
+		panic("failed to register tenant scope: " + err.Error())
+	}
+	if tenantID, err := tenancy.AdoptPlatformData([]string{rbac.SuperAdminRole}); err != nil { // 将旧版本写入平台租户的业务数据移入新租户
+		panic("failed to move tenant 0 data: " + err.Error())
+	} else if tenantID != 0 {
+		logger.Warn("Data stored under tenant_id 0 was moved to tenant ", strconv.FormatUint(uint64(tenantID), 10))
+	}
+	if err := tenancy.Backfill(); err != nil { // 为已有数据补建租户记录
+		panic("failed to backfill tenants: " + err.Error())
+	}
+	if len(os.Args) > 1 { // 执行导出、导入等子命令后退出
+		if err := runCommand(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := rbac.BootstrapSuperAdmin(); err != nil {
+		panic("failed to create super admin: " + err.Error())
+	}
+	if err := loadKeys(); err != nil { // 加载令牌签名密钥
+		panic("failed to load signing keys: " + err.Error())
+	}
+	go reloadKeysOnSignal()
+	handler.InitLoginGuard() // 初始化登录限流
+	handler.InitMailer()     // 初始化邮件发送
 
 	gin.SetMode(config.GinMode)
 	router := gin.Default()
 
 	// 注册登录路由
 	router.POST("/login", handler.Login)
+	router.POST("/login/2fa", handler.LoginMFA)
+	router.POST("/login/2fa/enroll", handler.LoginMFAEnroll)
+
+	// 注册找回密码路由
+	router.POST("/password/forgot", handler.ForgotPassword)
+	router.POST("/password/reset", handler.ResetPassword)
+
+	// 注册公钥集路由，供其他服务校验令牌
+	router.GET("/.well-known/jwks.json", handler.JWKS)
 
 	// 注册刷新令牌路由
 	router.POST("/refresh-token", handler.RefreshToken)
 
-	authorizedAdmin := router.Group("/")
-	authorizedAdmin.Use(middleware.JWTAuth([]string{"admin"}))
+	// 注册注销路由
+	router.POST("/logout", handler.Logout)
+
+	authorized := router.Group("/")
+	authorized.Use(middleware.JWTAuth())
 	{
-		authorizedAdmin.POST("/road", handler.AddRoad)
-		authorizedAdmin.PUT("/road/:id", handler.UpdateRoad)
-		authorizedAdmin.DELETE("/road/:id", handler.DeleteRoad)
+		authorized.POST("/logout-all", handler.LogoutAll)
 
-		authorizedAdmin.POST("/user", handler.AddUser)
-		authorizedAdmin.PUT("/user/:id", handler.UpdateUser)
-		authorizedAdmin.DELETE("/user/:id", handler.DeleteUser)
-	}
+		authorized.GET("/me", handler.GetMe)
+		authorized.PUT("/me", handler.UpdateMe)
+		authorized.PUT("/me/password", handler.ChangePassword)
+		authorized.POST("/me/2fa/enroll", handler.EnrollMFA)
+		authorized.POST("/me/2fa/enable", handler.EnableMFA)
+		authorized.DELETE("/me/2fa", handler.DisableMFA)
+		authorized.POST("/me/2fa/recovery-codes", handler.RegenerateRecoveryCodes)
 
-	authorizedInspector := router.Group("/")
-	authorizedInspector.Use(middleware.JWTAuth([]string{"admin", "inspector"}))
-	{
-		authorizedInspector.GET("/roads", handler.GetRoads)
-		authorizedInspector.GET("/users", handler.GetUsers)
+		authorized.GET("/roads", middleware.RequirePermission(rbac.RoadRead), handler.GetRoads)
+		authorized.POST("/road", middleware.RequirePermission(rbac.RoadWrite), handler.AddRoad)
+		authorized.POST("/roads/import", middleware.RequirePermission(rbac.RoadWrite), handler.ImportRoads)
+		authorized.POST("/roads/import/table", middleware.RequirePermission(rbac.RoadWrite), handler.ImportRoadTable)
+		authorized.GET("/road/:id", middleware.RequirePermission(rbac.RoadRead), handler.GetRoad)
+		authorized.PUT("/road/:id", middleware.RequirePermission(rbac.RoadWrite), handler.UpdateRoad)
+		authorized.DELETE("/road/:id", middleware.RequirePermission(rbac.RoadWrite), handler.DeleteRoad)
+		authorized.GET("/road/:id/history", middleware.RequirePermission(rbac.RoadRead), handler.GetRoadHistory)
+		authorized.GET("/road/:id/segments", middleware.RequirePermission(rbac.RoadRead), handler.GetRoadSegments)
+		authorized.POST("/road/:id/segments/generate", middleware.RequirePermission(rbac.RoadWrite), handler.GenerateRoadSegments)
+		authorized.DELETE("/road/:id/segments", middleware.RequirePermission(rbac.RoadWrite), handler.DeleteRoadSegments)
 
-		authorizedInspector.GET("/plans", handler.GetPlans)
-		authorizedInspector.POST("/plan", handler.AddPlan)
-		authorizedInspector.PUT("/plan/:id", handler.UpdatePlan)
-		authorizedInspector.DELETE("/plan/:id", handler.DeletePlan)
+		authorized.GET("/assets", middleware.RequirePermission(rbac.RoadRead), handler.GetAssets)
+		authorized.GET("/asset/:id", middleware.RequirePermission(rbac.RoadRead), handler.GetAsset)
+		authorized.POST("/asset", middleware.RequirePermission(rbac.RoadWrite), handler.AddAsset)
+		authorized.PUT("/asset/:id", middleware.RequirePermission(rbac.RoadWrite), handler.UpdateAsset)
+		authorized.DELETE("/asset/:id", middleware.RequirePermission(rbac.RoadWrite), handler.DeleteAsset)
 
-		authorizedInspector.GET("/reports", handler.GetReports)
-		authorizedInspector.POST("/report", handler.AddReport)
-		authorizedInspector.PUT("/report/:id", handler.UpdateReport)
-		authorizedInspector.DELETE("/report/:id", handler.DeleteReport)
+		authorized.GET("/zones", middleware.RequirePermission(rbac.RoadRead), handler.GetZones)
+		authorized.POST("/zone", middleware.RequirePermission(rbac.RoadWrite), handler.AddZone)
+		authorized.PUT("/zone/:id", middleware.RequirePermission(rbac.RoadWrite), handler.UpdateZone)
+		authorized.DELETE("/zone/:id", middleware.RequirePermission(rbac.RoadWrite), handler.DeleteZone)
+		authorized.POST("/zones/assign", middleware.RequirePermission(rbac.RoadWrite), handler.AssignRoadZones)
+
+		authorized.GET("/users", middleware.RequirePermission(rbac.UserRead), handler.GetUsers)
+		authorized.POST("/user", middleware.RequirePermission(rbac.UserWrite), handler.AddUser)
+		authorized.PUT("/user/:id", middleware.RequirePermission(rbac.UserWrite), handler.UpdateUser)
+		authorized.DELETE("/user/:id", middleware.RequirePermission(rbac.UserWrite), handler.DeleteUser)
+		authorized.POST("/user/:id/unlock", middleware.RequirePermission(rbac.UserWrite), handler.UnlockUser)
+
+		authorized.GET("/plans", middleware.RequirePermission(rbac.PlanRead), handler.GetPlans)
+		authorized.POST("/plan", middleware.RequirePermission(rbac.PlanWrite), handler.AddPlan)
+		authorized.PUT("/plan/:id", middleware.RequirePermission(rbac.PlanWrite), handler.UpdatePlan)
+		authorized.DELETE("/plan/:id", middleware.RequirePermission(rbac.PlanWrite), handler.DeletePlan)
+
+		authorized.GET("/reports", middleware.RequirePermission(rbac.ReportRead), handler.GetReports)
+		authorized.POST("/report", middleware.RequirePermission(rbac.ReportWrite), handler.AddReport)
+		authorized.PUT("/report/:id", middleware.RequirePermission(rbac.ReportWrite), handler.UpdateReport)
+		authorized.DELETE("/report/:id", middleware.RequirePermission(rbac.ReportWrite), handler.DeleteReport)
+		authorized.POST("/report/:id/approve", middleware.RequirePermission(rbac.ReportApprove), handler.ApproveReport)
+
+		authorized.GET("/permissions", middleware.RequirePermission(rbac.RoleManage), handler.GetPermissions)
+		authorized.GET("/roles", middleware.RequirePermission(rbac.RoleManage), handler.GetRoles)
+		authorized.POST("/role", middleware.RequirePermission(rbac.RoleManage), handler.AddRole)
+		authorized.PUT("/role/:id", middleware.RequirePermission(rbac.RoleManage), handler.UpdateRole)
+		authorized.DELETE("/role/:id", middleware.RequirePermission(rbac.RoleManage), handler.DeleteRole)
+
+		authorized.GET("/tenant/settings", middleware.RequirePermission(rbac.TenantConfig), handler.GetTenantSettings)
+		authorized.PUT("/tenant/settings", middleware.RequirePermission(rbac.TenantConfig), handler.UpdateTenantSettings)
+		authorized.GET("/tenant/usage", middleware.RequirePermission(rbac.TenantConfig), handler.GetTenantUsage)
+		authorized.GET("/tenant/export", middleware.RequirePermission(rbac.TenantConfig), handler.ExportTenantData)
+		authorized.POST("/tenant/import", middleware.RequirePermission(rbac.TenantConfig), handler.ImportTenantData)
+
+		authorized.GET("/vocabularies", middleware.RequirePermission(rbac.RoadRead), handler.GetVocabularies)
+		authorized.POST("/vocabulary", middleware.RequirePermission(rbac.TenantConfig), handler.AddVocabularyTerm)
+		authorized.PUT("/vocabulary/:id", middleware.RequirePermission(rbac.TenantConfig), handler.UpdateVocabularyTerm)
+		authorized.DELETE("/vocabulary/:id", middleware.RequirePermission(rbac.TenantConfig), handler.DeleteVocabularyTerm)
+
+		// 租户管理只对平台租户中的超级管理员开放
+		authorized.GET("/tenants", middleware.RequirePermission(rbac.TenantManage), handler.GetTenants)
+		authorized.POST("/tenant", middleware.RequirePermission(rbac.TenantManage), handler.AddTenant)
+		authorized.PUT("/tenant/:id", middleware.RequirePermission(rbac.TenantManage), handler.UpdateTenant)
+		authorized.DELETE("/tenant/:id", middleware.RequirePermission(rbac.TenantManage), handler.DeleteTenant)
+		authorized.POST("/tenant/:id/suspend", middleware.RequirePermission(rbac.TenantManage), handler.SuspendTenant)
+		authorized.POST("/tenant/:id/activate", middleware.RequirePermission(rbac.TenantManage), handler.ActivateTenant)
+		authorized.PUT("/tenant/:id/quota", middleware.RequirePermission(rbac.TenantManage), handler.UpdateTenantQuota)
 	}
 
 	err = router.Run(":" + config.GinPort)
@@ -59,3 +159,25 @@ func main() {
 		return
 	}
 }
+
+func loadKeys() error {
+	legacySecret := ""
+	if config.JWTAcceptLegacy {
+		legacySecret = config.JWTSecret
+	}
+	return token.LoadKeys(config.JWTKeysDir, config.JWTActiveKID, legacySecret)
+}
+
+// reloadKeysOnSignal 收到 SIGHUP 时重新读取配置和密钥目录，用于不停机轮换密钥
+func reloadKeysOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		config.ReloadJWTConfig()
+		if err := loadKeys(); err != nil {
+			logger.Error("Could not reload signing keys: ", err.Error())
+			continue
+		}
+		logger.Info("Signing keys reloaded")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/history"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+	"gorm.io/gorm"
+)
+
+// convertRoadsCommand 将租户中以其他坐标系保存的道路坐标转换为 WGS84
+// 程序无法判断已有道路原本使用的坐标系，需要由管理员指定来源坐标系和要转换的道路
+func convertRoadsCommand(args []string) error {
+	flags := flag.NewFlagSet("convert-roads", flag.ExitOnError)
+	tenantID := flags.Uint("tenant", 0, "道路所属的租户ID")
+	from := flags.String("from", "", "道路当前使用的坐标系：gcj02 或 bd09")
+	ids := flags.String("ids", "", "要转换的道路ID，以逗号分隔，留空时转换该租户的全部道路")
+	dryRun := flags.Bool("dry-run", false, "只输出转换结果，不写入数据库")
+	_ = flags.Parse(args)
+	if err := requireTenant(*tenantID); err != nil {
+		return err
+	}
+	crs, err := geo.ParseCRS(*from)
+	if err != nil {
+		return err
+	}
+	if crs == geo.WGS84 {
+		return errors.New("-from must be gcj02 or bd09")
+	}
+
+	db := tenancy.Scoped(config.DB, *tenantID)
+	query := db.Order("id")
+	if *ids != "" {
+		var roadIDs []uint64
+		for _, s := range strings.Split(*ids, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid road id %q", s)
+			}
+			roadIDs = append(roadIDs, id)
+		}
+		query = query.Where("id IN ?", roadIDs)
+	}
+	var roads []model.Road
+	if err := query.Find(&roads).Error; err != nil {
+		return err
+	}
+
+	columns := append([]string{"latitude", "longitude", "geometry", "length"}, model.RoadBBoxColumns...)
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := range roads {
+			road := &roads[i]
+			before := road.Point()
+			road.ConvertCRS(crs, geo.WGS84)
+			if err := road.ApplyGeometry(); err != nil {
+				return fmt.Errorf("road %d: %w", road.ID, err)
+			}
+			fmt.Printf("road %d: [%g, %g] -> [%g, %g]\n", road.ID, before.Lon(), before.Lat(), road.Longitude, road.Latitude)
+			if *dryRun {
+				continue
+			}
+			if err := tx.Model(road).Select(columns).Updates(road).Error; err != nil {
+				return err
+			}
+			if err := history.RecordRoad(tx, road, model.RoadChangeUpdate, nil); err != nil {
+				return err
+			}
+			if err := convertSegments(tx, road.ID, crs); err != nil {
+				return err
+			}
+			if err := convertAssets(tx, road.ID, crs); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("converted %d roads from %s to wgs84\n", len(roads), crs)
+		return nil
+	})
+}
+
+// convertSegments 将道路各路段的几何形状转换为 WGS84
+func convertSegments(tx *gorm.DB, roadID uint, from geo.CRS) error {
+	var segments []model.RoadSegment
+	if err := tx.Where("road_id = ?", roadID).Find(&segments).Error; err != nil {
+		return err
+	}
+	for i := range segments {
+		segments[i].ConvertCRS(from, geo.WGS84)
+		if err := tx.Model(&segments[i]).Select("geometry").Updates(&segments[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertAssets 将道路上各设施的位置转换为 WGS84
+func convertAssets(tx *gorm.DB, roadID uint, from geo.CRS) error {
+	var assets []model.Asset
+	if err := tx.Where("road_id = ?", roadID).Find(&assets).Error; err != nil {
+		return err
+	}
+	for i := range assets {
+		assets[i].ConvertCRS(from, geo.WGS84)
+		if err := tx.Model(&assets[i]).Select("latitude", "longitude").Updates(&assets[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Package archive 实现租户数据的导出和导入
+// 归档为 zip 文件，包含 manifest.json 和每张表一个 JSON Lines 文件，导入时为记录分配新的ID并保持记录之间的关联
+package archive
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+)
+
+// Format 为归档清单中的格式标识
+const Format = "road-patrol-tenant-archive"
+
+// Version 为当前的归档格式版本，格式发生不兼容的变化时递增，新增可选字段不改变版本
+const Version = 1
+
+const (
+	manifestFile     = "manifest.json"
+	usersFile        = "users.jsonl"
+	roadsFile        = "roads.jsonl"
+	roadSegmentsFile = "road_segments.jsonl"
+	plansFile        = "plans.jsonl"
+	planRoadsFile    = "plan_roads.jsonl"
+	planSegmentsFile = "plan_segments.jsonl"
+	reportsFile      = "reports.jsonl"
+	assetsFile       = "assets.jsonl"
+	reportAssetsFile = "report_assets.jsonl"
+	zonesFile        = "zones.jsonl"
+)
+
+var (
+	// ErrInvalidArchive 表示归档文件损坏、格式不受支持或记录之间的关联不完整
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrConflict 表示归档内容与目标租户中的已有数据冲突
+	ErrConflict = errors.New("archive conflicts with target tenant")
+)
+
+// Manifest 描述归档的格式版本、来源和各表的记录数
+type Manifest struct {
+	Format       string    `json:"format"`
+	Version      int       `json:"version"`
+	SourceTenant uint      `json:"source_tenant"`
+	ExportedAt   time.Time `json:"exported_at"`
+	Counts       Counts    `json:"counts"`
+}
+
+// Counts 为归档中各表的记录数
+type Counts struct {
+	Users        int `json:"users"`
+	Roads        int `json:"roads"`
+	RoadSegments int `json:"road_segments"`
+	Plans        int `json:"plans"`
+	PlanRoads    int `json:"plan_roads"`
+	PlanSegments int `json:"plan_segments"`
+	Reports      int `json:"reports"`
+	Assets       int `json:"assets"`
+	ReportAssets int `json:"report_assets"`
+	Zones        int `json:"zones"`
+}
+
+// 以下为归档中各表的记录格式，与数据库模型分开定义，模型的变化不会直接影响归档格式
+// 记录中的ID只在归档内部有意义，导入时会重新分配
+
+type userRecord struct {
+	ID           uint   `json:"id"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Role         string `json:"role"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone"`
+}
+
+type roadRecord struct {
+	ID               uint           `json:"id"`
+	Name             string         `json:"name"`
+	Latitude         float64        `json:"latitude"`
+	Longitude        float64        `json:"longitude"`
+	Geometry         geo.LineString `json:"geometry,omitempty"`
+	Length           float64        `json:"length"`
+	Type             string         `json:"type"`
+	SurfaceMaterial  string         `json:"surface_material"`
+	ConstructionYear int            `json:"construction_year"`
+	ZoneID           *uint          `json:"zone_id,omitempty"`
+}
+
+type roadSegmentRecord struct {
+	ID            uint           `json:"id"`
+	RoadID        uint           `json:"road_id"`
+	Name          string         `json:"name"`
+	StartChainage geo.Chainage   `json:"start_chainage"`
+	EndChainage   geo.Chainage   `json:"end_chainage"`
+	Length        float64        `json:"length"`
+	Geometry      geo.LineString `json:"geometry,omitempty"`
+}
+
+type planRecord struct {
+	ID          uint      `json:"id"`
+	InspectorID uint      `json:"inspector_id"`
+	Date        time.Time `json:"date"`
+	Status      string    `json:"status"`
+}
+
+type planRoadRecord struct {
+	PlanID uint `json:"plan_id"`
+	RoadID uint `json:"road_id"`
+}
+
+type planSegmentRecord struct {
+	PlanID    uint `json:"plan_id"`
+	SegmentID uint `json:"segment_id"`
+}
+
+type reportRecord struct {
+	ID         uint       `json:"id"`
+	PlanID     uint       `json:"plan_id"`
+	Content    string     `json:"content"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ApprovedBy *uint      `json:"approved_by"`
+	ApprovedAt *time.Time `json:"approved_at"`
+
+	SegmentID *uint         `json:"segment_id,omitempty"`
+	Chainage  *geo.Chainage `json:"chainage,omitempty"`
+}
+
+type assetRecord struct {
+	ID          uint                   `json:"id"`
+	RoadID      uint                   `json:"road_id"`
+	SegmentID   *uint                  `json:"segment_id,omitempty"`
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name"`
+	Latitude    float64                `json:"latitude"`
+	Longitude   float64                `json:"longitude"`
+	Chainage    *geo.Chainage          `json:"chainage,omitempty"`
+	InstallDate *time.Time             `json:"install_date,omitempty"`
+	Condition   string                 `json:"condition"`
+	Attributes  map[string]interface{} `json:"attributes,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+type reportAssetRecord struct {
+	ReportID uint `json:"report_id"`
+	AssetID  uint `json:"asset_id"`
+}
+
+type zoneRecord struct {
+	ID       uint        `json:"id"`
+	ParentID *uint       `json:"parent_id,omitempty"`
+	Name     string      `json:"name"`
+	Kind     string      `json:"kind"`
+	Boundary geo.Polygon `json:"boundary,omitempty"`
+}
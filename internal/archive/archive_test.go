@@ -0,0 +1,262 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB 打开一个内存中的 SQLite 数据库，迁移归档涉及的表并注册租户回调
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:?_pragma=foreign_keys(1)"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接各自独立，只保留一个连接
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	err = db.AutoMigrate(&model.Road{}, &model.User{}, &model.Plan{}, &model.Report{}, &model.PlanRoad{}, &model.RoadSegment{}, &model.PlanSegment{}, &model.Asset{}, &model.ReportAsset{}, &model.Zone{}, &model.RoadVersion{}, &model.Role{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tenancy.Register(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// seedTenant 在租户中创建一组相互关联的用户、区域、道路、路段、设施、巡检任务和报告
+func seedTenant(t *testing.T, db *gorm.DB, tenantID uint, prefix string) {
+	t.Helper()
+	db = tenancy.Scoped(db, tenantID)
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	admin := model.User{Username: prefix + "admin", Password: "$2a$10$admin", Role: "admin", Email: prefix + "admin@example.com"}
+	inspector := model.User{Username: prefix + "inspector", Password: "$2a$10$inspector", Role: "inspector", Phone: "13800000000"}
+	must(db.Create(&admin).Error)
+	must(db.Create(&inspector).Error)
+
+	district := model.Zone{Name: prefix + "district", Kind: "district"}
+	must(db.Create(&district).Error)
+	street := model.Zone{Name: prefix + "street", Kind: "street", ParentID: &district.ID}
+	must(db.Create(&street).Error)
+
+	road := model.Road{
+		Name:     prefix + "road",
+		Geometry: geo.LineString{{116.40, 39.90}, {116.41, 39.90}, {116.41, 39.91}},
+		Type:     "primary",
+		ZoneID:   &street.ID,
+	}
+	must(road.ApplyGeometry())
+	must(db.Create(&road).Error)
+	segment := model.RoadSegment{RoadID: road.ID, Name: prefix + "segment", StartChainage: 0, EndChainage: 500, Length: 500}
+	must(db.Create(&segment).Error)
+	chainage := geo.Chainage(120)
+	asset := model.Asset{RoadID: road.ID, SegmentID: &segment.ID, Type: "sign", Name: prefix + "sign", Chainage: &chainage, Condition: model.AssetConditionGood}
+	must(db.Create(&asset).Error)
+
+	plan := model.Plan{InspectorID: inspector.ID, Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Status: "completed"}
+	must(db.Create(&plan).Error)
+	must(db.Create(&model.PlanRoad{PlanID: plan.ID, RoadID: road.ID}).Error)
+	must(db.Create(&model.PlanSegment{PlanID: plan.ID, SegmentID: segment.ID}).Error)
+	approvedAt := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	report := model.Report{PlanID: plan.ID, Content: prefix + "report", SegmentID: &segment.ID, Chainage: &chainage, ApprovedBy: &admin.ID, ApprovedAt: &approvedAt}
+	must(db.Create(&report).Error)
+	must(db.Create(&model.ReportAsset{ReportID: report.ID, AssetID: asset.ID}).Error)
+}
+
+func TestExportRestore(t *testing.T) {
+	db := openTestDB(t)
+	seedTenant(t, db, 1, "")
+	// 另一个租户的数据不应出现在归档中
+	seedTenant(t, db, 3, "other-")
+
+	var buf bytes.Buffer
+	manifest, err := Export(db, 1, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Counts{Users: 2, Roads: 1, RoadSegments: 1, Plans: 1, PlanRoads: 1, PlanSegments: 1, Reports: 1, Assets: 1, ReportAssets: 1, Zones: 2}
+	if manifest.Counts != want {
+		t.Errorf("Export() counts = %+v, want %+v", manifest.Counts, want)
+	}
+	if manifest.Format != Format || manifest.Version != Version || manifest.SourceTenant != 1 {
+		t.Errorf("Export() manifest = %+v", manifest)
+	}
+
+	a, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Counts() != want {
+		t.Errorf("Read() counts = %+v, want %+v", a.Counts(), want)
+	}
+
+	var result Result
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = a.Restore(tx, 2)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != want || len(result.Warnings) != 0 {
+		t.Errorf("Restore() = %+v, want %+v without warnings", result, want)
+	}
+
+	target := tenancy.Scoped(db, 2)
+	var inspector model.User
+	if err := target.Where("username = ?", "inspector").First(&inspector).Error; err != nil {
+		t.Fatal(err)
+	}
+	if inspector.Password != "$2a$10$inspector" || inspector.Phone != "13800000000" {
+		t.Errorf("restored inspector = %+v", inspector)
+	}
+	var road model.Road
+	if err := target.First(&road).Error; err != nil {
+		t.Fatal(err)
+	}
+	if road.Name != "road" || len(road.Geometry) != 3 || road.ZoneID == nil {
+		t.Fatalf("restored road = %+v", road)
+	}
+	var street model.Zone
+	if err := target.First(&street, *road.ZoneID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if street.Name != "street" || street.ParentID == nil {
+		t.Errorf("restored road zone = %+v, want street with a parent", street)
+	}
+	var plan model.Plan
+	if err := target.First(&plan).Error; err != nil {
+		t.Fatal(err)
+	}
+	if plan.InspectorID != inspector.ID || !plan.Date.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("restored plan = %+v, want inspector %d", plan, inspector.ID)
+	}
+	var planRoad model.PlanRoad
+	if err := target.Where("plan_id = ? AND road_id = ?", plan.ID, road.ID).First(&planRoad).Error; err != nil {
+		t.Errorf("restored plan road: %v", err)
+	}
+	var report model.Report
+	if err := target.First(&report).Error; err != nil {
+		t.Fatal(err)
+	}
+	var segment model.RoadSegment
+	if err := target.First(&segment).Error; err != nil {
+		t.Fatal(err)
+	}
+	if segment.RoadID != road.ID {
+		t.Errorf("restored segment = %+v, want road %d", segment, road.ID)
+	}
+	if report.PlanID != plan.ID || report.SegmentID == nil || *report.SegmentID != segment.ID || report.ApprovedBy == nil {
+		t.Errorf("restored report = %+v", report)
+	}
+	var asset model.Asset
+	if err := target.First(&asset).Error; err != nil {
+		t.Fatal(err)
+	}
+	if asset.RoadID != road.ID || asset.SegmentID == nil || *asset.SegmentID != segment.ID {
+		t.Errorf("restored asset = %+v", asset)
+	}
+	var reportAsset model.ReportAsset
+	if err := target.Where("report_id = ? AND asset_id = ?", report.ID, asset.ID).First(&reportAsset).Error; err != nil {
+		t.Errorf("restored report asset: %v", err)
+	}
+	var versions int64
+	if err := target.Model(&model.RoadVersion{}).Where("road_id = ?", road.ID).Count(&versions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if versions != 1 {
+		t.Errorf("restored road has %d versions, want 1", versions)
+	}
+
+	// 再次导入时用户名已存在
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := a.Restore(tx, 2)
+		return err
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("second Restore() error = %v, want ErrConflict", err)
+	}
+}
+
+// buildArchive 将 files 打包为归档，键为文件名
+func buildArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadInvalid(t *testing.T) {
+	const manifest = `{"format":"road-patrol-tenant-archive","version":1}`
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"missing manifest", map[string]string{usersFile: ""}},
+		{"wrong format", map[string]string{manifestFile: `{"format":"other","version":1}`}},
+		{"future version", map[string]string{manifestFile: `{"format":"road-patrol-tenant-archive","version":2}`}},
+		{"malformed manifest", map[string]string{manifestFile: `{"format":`}},
+		{"malformed line", map[string]string{manifestFile: manifest, roadsFile: `{"id":1,"name":"road"}` + "\n" + `{"id":`}},
+		{"user without password", map[string]string{manifestFile: manifest, usersFile: `{"id":1,"username":"admin"}`}},
+		{"duplicate username", map[string]string{manifestFile: manifest, usersFile: strings.Repeat(`{"id":1,"username":"admin","password_hash":"x"}`+"\n", 2)}},
+		{"duplicate road", map[string]string{manifestFile: manifest, roadsFile: `{"id":1}` + "\n" + `{"id":1}`}},
+		{"zone cycle", map[string]string{manifestFile: manifest, zonesFile: `{"id":1,"parent_id":2}` + "\n" + `{"id":2,"parent_id":1}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildArchive(t, tt.files)
+			if _, err := Read(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrInvalidArchive) {
+				t.Errorf("Read() error = %v, want ErrInvalidArchive", err)
+			}
+		})
+	}
+}
+
+func TestReadNotZip(t *testing.T) {
+	data := []byte("not an archive")
+	if _, err := Read(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("Read() error = %v, want ErrInvalidArchive", err)
+	}
+}
+
+func TestRestorePlatformTenant(t *testing.T) {
+	a := &Archive{}
+	if _, err := a.Restore(openTestDB(t), tenancy.PlatformTenantID); err == nil {
+		t.Error("Restore() into the platform tenant succeeded")
+	}
+}
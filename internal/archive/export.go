@@ -0,0 +1,266 @@
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"gorm.io/gorm"
+)
+
+// Export 将租户的用户、区域、道路及其路段和设施、巡检任务及其关联的道路和路段、巡检报告及其检查的设施写入归档
+// 用户的密码以哈希形式导出，两步验证的密钥和恢复码不导出，导入后用户需要重新绑定认证器
+func Export(db *gorm.DB, tenantID uint, w io.Writer) (Manifest, error) {
+	db = tenancy.Scoped(db, tenantID)
+	var users []model.User
+	var roads []model.Road
+	var roadSegments []model.RoadSegment
+	var plans []model.Plan
+	var planRoads []model.PlanRoad
+	var planSegments []model.PlanSegment
+	var reports []model.Report
+	var assets []model.Asset
+	var reportAssets []model.ReportAsset
+	var zones []model.Zone
+	if err := db.Order("id").Find(&users).Error; err != nil {
+		return Manifest{}, err
+	}
+	if err := db.Order("id").Find(&roads).Error; err != nil {
+		return Manifest{}, err
+	}
+	if err := db.Order("id").Find(&roadSegments).Error; err != nil {
+		return Manifest{}, err
+	}
+	if err := db.Order("id").Find(&plans).Error; err != nil {
+		return Manifest{}, err
+	}
+	if err := db.Order("plan_id, road_id").Find(&planRoads).Error; err != nil {
+		return Manifest{}, err
+	}
+	if err := db.Order("plan_id, segment_id").Find(&planSegments).Error; err != nil {
+		return Manifest{}, err
+	}
+	if err := db.Order("id").Find(&reports).Error; err != nil {
+		return Manifest{}, err
+	}
+	if err := db.Order("id").Find(&assets).Error; err != nil {
+		return Manifest{}, err
+	}
+	if err := db.Order("report_id, asset_id").Find(&reportAssets).Error; err != nil {
+		return Manifest{}, err
+	}
+	if err := db.Order("id").Find(&zones).Error; err != nil {
+		return Manifest{}, err
+	}
+
+	manifest := Manifest{
+		Format:       Format,
+		Version:      Version,
+		SourceTenant: tenantID,
+		ExportedAt:   time.Now().UTC(),
+		Counts: Counts{
+			Users:        len(users),
+			Roads:        len(roads),
+			RoadSegments: len(roadSegments),
+			Plans:        len(plans),
+			PlanRoads:    len(planRoads),
+			PlanSegments: len(planSegments),
+			Reports:      len(reports),
+			Assets:       len(assets),
+			ReportAssets: len(reportAssets),
+			Zones:        len(zones),
+		},
+	}
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		records []interface{}
+	}{
+		{usersFile, userRecords(users)},
+		{roadsFile, roadRecords(roads)},
+		{roadSegmentsFile, roadSegmentRecords(roadSegments)},
+		{plansFile, planRecords(plans)},
+		{planRoadsFile, planRoadRecords(planRoads)},
+		{planSegmentsFile, planSegmentRecords(planSegments)},
+		{reportsFile, reportRecords(reports)},
+		{assetsFile, assetRecords(assets)},
+		{reportAssetsFile, reportAssetRecords(reportAssets)},
+		{zonesFile, zoneRecords(zones)},
+	}
+	for _, file := range files {
+		if err := writeLines(zw, file.name, file.records); err != nil {
+			return Manifest{}, err
+		}
+	}
+
+	mw, err := zw.Create(manifestFile)
+	if err != nil {
+		return Manifest{}, err
+	}
+	encoder := json.NewEncoder(mw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, zw.Close()
+}
+
+// writeLines 将记录逐行写入归档中的一个 JSON Lines 文件
+func writeLines(zw *zip.Writer, name string, records []interface{}) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(fw)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func userRecords(users []model.User) []interface{} {
+	records := make([]interface{}, 0, len(users))
+	for _, user := range users {
+		records = append(records, userRecord{
+			ID:           user.ID,
+			Username:     user.Username,
+			PasswordHash: user.Password,
+			Role:         user.Role,
+			Email:        user.Email,
+			Phone:        user.Phone,
+		})
+	}
+	return records
+}
+
+func roadRecords(roads []model.Road) []interface{} {
+	records := make([]interface{}, 0, len(roads))
+	for _, road := range roads {
+		records = append(records, roadRecord{
+			ID:               road.ID,
+			Name:             road.Name,
+			Latitude:         road.Latitude,
+			Longitude:        road.Longitude,
+			Geometry:         road.Geometry,
+			Length:           road.Length,
+			Type:             road.Type,
+			SurfaceMaterial:  road.SurfaceMaterial,
+			ConstructionYear: road.ConstructionYear,
+			ZoneID:           road.ZoneID,
+		})
+	}
+	return records
+}
+
+func roadSegmentRecords(segments []model.RoadSegment) []interface{} {
+	records := make([]interface{}, 0, len(segments))
+	for _, segment := range segments {
+		records = append(records, roadSegmentRecord{
+			ID:            segment.ID,
+			RoadID:        segment.RoadID,
+			Name:          segment.Name,
+			StartChainage: segment.StartChainage,
+			EndChainage:   segment.EndChainage,
+			Length:        segment.Length,
+			Geometry:      segment.Geometry,
+		})
+	}
+	return records
+}
+
+func planRecords(plans []model.Plan) []interface{} {
+	records := make([]interface{}, 0, len(plans))
+	for _, plan := range plans {
+		records = append(records, planRecord{
+			ID:          plan.ID,
+			InspectorID: plan.InspectorID,
+			Date:        plan.Date,
+			Status:      plan.Status,
+		})
+	}
+	return records
+}
+
+func planRoadRecords(planRoads []model.PlanRoad) []interface{} {
+	records := make([]interface{}, 0, len(planRoads))
+	for _, planRoad := range planRoads {
+		records = append(records, planRoadRecord{PlanID: planRoad.PlanID, RoadID: planRoad.RoadID})
+	}
+	return records
+}
+
+func planSegmentRecords(planSegments []model.PlanSegment) []interface{} {
+	records := make([]interface{}, 0, len(planSegments))
+	for _, planSegment := range planSegments {
+		records = append(records, planSegmentRecord{PlanID: planSegment.PlanID, SegmentID: planSegment.SegmentID})
+	}
+	return records
+}
+
+func reportRecords(reports []model.Report) []interface{} {
+	records := make([]interface{}, 0, len(reports))
+	for _, report := range reports {
+		records = append(records, reportRecord{
+			ID:         report.ID,
+			PlanID:     report.PlanID,
+			Content:    report.Content,
+			CreatedAt:  report.CreatedAt,
+			UpdatedAt:  report.UpdatedAt,
+			ApprovedBy: report.ApprovedBy,
+			ApprovedAt: report.ApprovedAt,
+			SegmentID:  report.SegmentID,
+			Chainage:   report.Chainage,
+		})
+	}
+	return records
+}
+
+func assetRecords(assets []model.Asset) []interface{} {
+	records := make([]interface{}, 0, len(assets))
+	for _, asset := range assets {
+		records = append(records, assetRecord{
+			ID:          asset.ID,
+			RoadID:      asset.RoadID,
+			SegmentID:   asset.SegmentID,
+			Type:        asset.Type,
+			Name:        asset.Name,
+			Latitude:    asset.Latitude,
+			Longitude:   asset.Longitude,
+			Chainage:    asset.Chainage,
+			InstallDate: asset.InstallDate,
+			Condition:   asset.Condition,
+			Attributes:  asset.Attributes,
+			CreatedAt:   asset.CreatedAt,
+			UpdatedAt:   asset.UpdatedAt,
+		})
+	}
+	return records
+}
+
+func reportAssetRecords(reportAssets []model.ReportAsset) []interface{} {
+	records := make([]interface{}, 0, len(reportAssets))
+	for _, reportAsset := range reportAssets {
+		records = append(records, reportAssetRecord{ReportID: reportAsset.ReportID, AssetID: reportAsset.AssetID})
+	}
+	return records
+}
+
+func zoneRecords(zones []model.Zone) []interface{} {
+	records := make([]interface{}, 0, len(zones))
+	for _, zone := range zones {
+		records = append(records, zoneRecord{
+			ID:       zone.ID,
+			ParentID: zone.ParentID,
+			Name:     zone.Name,
+			Kind:     zone.Kind,
+			Boundary: zone.Boundary,
+		})
+	}
+	return records
+}
@@ -0,0 +1,655 @@
+package archive
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/history"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/rbac"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxEntrySize 为归档中单个文件解压后的最大字节数，防止解压炸弹
+var MaxEntrySize int64 = 256 << 20
+
+const batchSize = 500
+
+// Archive 为读取到内存中的归档内容
+type Archive struct {
+	Manifest Manifest
+
+	users        []userRecord
+	roads        []roadRecord
+	roadSegments []roadSegmentRecord
+	plans        []planRecord
+	planRoads    []planRoadRecord
+	planSegments []planSegmentRecord
+	reports      []reportRecord
+	assets       []assetRecord
+	reportAssets []reportAssetRecord
+	zones        []zoneRecord
+}
+
+// Result 为导入的结果
+// 归档中引用了不存在的用户、区域、道路、路段、巡检任务、报告或设施时（例如源租户中已删除的记录），对应的引用会被清除，并在 Warnings 中说明
+type Result struct {
+	Imported Counts   `json:"imported"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Read 读取并校验归档，不访问数据库
+func Read(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	a := &Archive{}
+	manifest, ok := files[manifestFile]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidArchive, manifestFile)
+	}
+	if err := readJSON(manifest, &a.Manifest); err != nil {
+		return nil, err
+	}
+	if a.Manifest.Format != Format {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidArchive, a.Manifest.Format)
+	}
+	if a.Manifest.Version < 1 || a.Manifest.Version > Version {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidArchive, a.Manifest.Version)
+	}
+
+	// 缺少的数据文件视为没有记录
+	if err := readLines(files[usersFile], func(d *json.Decoder) error {
+		var record userRecord
+		if err := d.Decode(&record); err != nil {
+			return err
+		}
+		a.users = append(a.users, record)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := readLines(files[roadsFile], func(d *json.Decoder) error {
+		var record roadRecord
+		if err := d.Decode(&record); err != nil {
+			return err
+		}
+		a.roads = append(a.roads, record)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := readLines(files[roadSegmentsFile], func(d *json.Decoder) error {
+		var record roadSegmentRecord
+		if err := d.Decode(&record); err != nil {
+			return err
+		}
+		a.roadSegments = append(a.roadSegments, record)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := readLines(files[plansFile], func(d *json.Decoder) error {
+		var record planRecord
+		if err := d.Decode(&record); err != nil {
+			return err
+		}
+		a.plans = append(a.plans, record)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := readLines(files[planRoadsFile], func(d *json.Decoder) error {
+		var record planRoadRecord
+		if err := d.Decode(&record); err != nil {
+			return err
+		}
+		a.planRoads = append(a.planRoads, record)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := readLines(files[planSegmentsFile], func(d *json.Decoder) error {
+		var record planSegmentRecord
+		if err := d.Decode(&record); err != nil {
+			return err
+		}
+		a.planSegments = append(a.planSegments, record)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := readLines(files[reportsFile], func(d *json.Decoder) error {
+		var record reportRecord
+		if err := d.Decode(&record); err != nil {
+			return err
+		}
+		a.reports = append(a.reports, record)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := readLines(files[assetsFile], func(d *json.Decoder) error {
+		var record assetRecord
+		if err := d.Decode(&record); err != nil {
+			return err
+		}
+		a.assets = append(a.assets, record)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := readLines(files[reportAssetsFile], func(d *json.Decoder) error {
+		var record reportAssetRecord
+		if err := d.Decode(&record); err != nil {
+			return err
+		}
+		a.reportAssets = append(a.reportAssets, record)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := readLines(files[zonesFile], func(d *json.Decoder) error {
+		var record zoneRecord
+		if err := d.Decode(&record); err != nil {
+			return err
+		}
+		a.zones = append(a.zones, record)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return a, a.validate()
+}
+
+// validate 检查归档内部的ID和用户名没有重复，区域的上下级关系没有形成环
+func (a *Archive) validate() error {
+	userIDs := make(map[uint]bool, len(a.users))
+	usernames := make(map[string]bool, len(a.users))
+	for _, user := range a.users {
+		if user.Username == "" || user.PasswordHash == "" {
+			return fmt.Errorf("%w: user %d has no username or password", ErrInvalidArchive, user.ID)
+		}
+		if userIDs[user.ID] || usernames[user.Username] {
+			return fmt.Errorf("%w: duplicate user %d (%s)", ErrInvalidArchive, user.ID, user.Username)
+		}
+		userIDs[user.ID] = true
+		usernames[user.Username] = true
+	}
+	roadIDs := make(map[uint]bool, len(a.roads))
+	for _, road := range a.roads {
+		if roadIDs[road.ID] {
+			return fmt.Errorf("%w: duplicate road %d", ErrInvalidArchive, road.ID)
+		}
+		roadIDs[road.ID] = true
+	}
+	segmentIDs := make(map[uint]bool, len(a.roadSegments))
+	for _, segment := range a.roadSegments {
+		if segmentIDs[segment.ID] {
+			return fmt.Errorf("%w: duplicate road segment %d", ErrInvalidArchive, segment.ID)
+		}
+		segmentIDs[segment.ID] = true
+	}
+	planIDs := make(map[uint]bool, len(a.plans))
+	for _, plan := range a.plans {
+		if planIDs[plan.ID] {
+			return fmt.Errorf("%w: duplicate plan %d", ErrInvalidArchive, plan.ID)
+		}
+		planIDs[plan.ID] = true
+	}
+	reportIDs := make(map[uint]bool, len(a.reports))
+	for _, report := range a.reports {
+		if reportIDs[report.ID] {
+			return fmt.Errorf("%w: duplicate report %d", ErrInvalidArchive, report.ID)
+		}
+		reportIDs[report.ID] = true
+	}
+	assetIDs := make(map[uint]bool, len(a.assets))
+	for _, asset := range a.assets {
+		if assetIDs[asset.ID] {
+			return fmt.Errorf("%w: duplicate asset %d", ErrInvalidArchive, asset.ID)
+		}
+		assetIDs[asset.ID] = true
+	}
+	zoneParents := make(map[uint]*uint, len(a.zones))
+	for _, zone := range a.zones {
+		if _, ok := zoneParents[zone.ID]; ok {
+			return fmt.Errorf("%w: duplicate zone %d", ErrInvalidArchive, zone.ID)
+		}
+		zoneParents[zone.ID] = zone.ParentID
+	}
+	for _, zone := range a.zones {
+		parent := zone.ParentID
+		for depth := 0; parent != nil; depth++ {
+			if depth >= len(a.zones) {
+				return fmt.Errorf("%w: zone %d is its own ancestor", ErrInvalidArchive, zone.ID)
+			}
+			parent = zoneParents[*parent]
+		}
+	}
+	return nil
+}
+
+// Counts 返回归档中各表的记录数
+func (a *Archive) Counts() Counts {
+	return Counts{
+		Users:        len(a.users),
+		Roads:        len(a.roads),
+		RoadSegments: len(a.roadSegments),
+		Plans:        len(a.plans),
+		PlanRoads:    len(a.planRoads),
+		PlanSegments: len(a.planSegments),
+		Reports:      len(a.reports),
+		Assets:       len(a.assets),
+		ReportAssets: len(a.reportAssets),
+		Zones:        len(a.zones),
+	}
+}
+
+// CountPlans 返回归档中满足条件的巡检任务数
+func (a *Archive) CountPlans(match func(status string) bool) int {
+	count := 0
+	for _, plan := range a.plans {
+		if match(plan.Status) {
+			count++
+		}
+	}
+	return count
+}
+
+// Restore 将归档导入目标租户，所有记录都会分配新的ID
+// 调用方应在事务中调用，出错时回滚，避免留下只导入了一部分的数据
+// 目标租户中已存在同名用户，或用户的角色在目标租户中不存在时返回 ErrConflict
+func (a *Archive) Restore(db *gorm.DB, tenantID uint) (Result, error) {
+	var result Result
+	if tenantID == tenancy.PlatformTenantID {
+		return result, errors.New("cannot import into the platform tenant")
+	}
+	db = tenancy.Scoped(db, tenantID)
+	if err := a.checkConflicts(db); err != nil {
+		return result, err
+	}
+	// 关联的模型由各自的文件导入，创建时不级联写入
+	db = db.Omit(clause.Associations).Session(&gorm.Session{})
+
+	userIDs := make(map[uint]uint, len(a.users))
+	users := make([]model.User, 0, len(a.users))
+	for _, record := range a.users {
+		users = append(users, model.User{
+			Username: record.Username,
+			Password: record.PasswordHash,
+			Role:     record.Role,
+			Email:    record.Email,
+			Phone:    record.Phone,
+		})
+	}
+	if err := createAll(db, &users); err != nil {
+		return result, err
+	}
+	for i, record := range a.users {
+		userIDs[record.ID] = users[i].ID
+	}
+
+	// 区域先不设置上级区域，全部创建后再按新的ID设置
+	zoneIDs := make(map[uint]uint, len(a.zones))
+	zones := make([]model.Zone, 0, len(a.zones))
+	for _, record := range a.zones {
+		if record.Boundary != nil {
+			if err := record.Boundary.Validate(); err != nil {
+				return result, fmt.Errorf("%w: zone %d: %v", ErrInvalidArchive, record.ID, err)
+			}
+		}
+		zones = append(zones, model.Zone{Name: record.Name, Kind: record.Kind, Boundary: record.Boundary})
+	}
+	if err := createAll(db, &zones); err != nil {
+		return result, err
+	}
+	for i, record := range a.zones {
+		zoneIDs[record.ID] = zones[i].ID
+	}
+	for i, record := range a.zones {
+		if record.ParentID == nil {
+			continue
+		}
+		parentID, ok := zoneIDs[*record.ParentID]
+		if !ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("zone %d: parent zone %d not found, cleared", record.ID, *record.ParentID))
+			continue
+		}
+		if err := db.Model(&zones[i]).Update("parent_id", parentID).Error; err != nil {
+			return result, err
+		}
+	}
+
+	roadIDs := make(map[uint]uint, len(a.roads))
+	roads := make([]model.Road, 0, len(a.roads))
+	for _, record := range a.roads {
+		var zoneID *uint
+		if record.ZoneID != nil {
+			if id, ok := zoneIDs[*record.ZoneID]; ok {
+				zoneID = &id
+			} else {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("road %d: zone %d not found, cleared", record.ID, *record.ZoneID))
+			}
+		}
+		roads = append(roads, model.Road{
+			Name:             record.Name,
+			Latitude:         record.Latitude,
+			Longitude:        record.Longitude,
+			Geometry:         record.Geometry,
+			Length:           record.Length,
+			Type:             record.Type,
+			SurfaceMaterial:  record.SurfaceMaterial,
+			ConstructionYear: record.ConstructionYear,
+			ZoneID:           zoneID,
+		})
+	}
+	for i := range roads {
+		if err := roads[i].ApplyGeometry(); err != nil {
+			return result, fmt.Errorf("%w: road %d: %v", ErrInvalidArchive, a.roads[i].ID, err)
+		}
+	}
+	if err := createAll(db, &roads); err != nil {
+		return result, err
+	}
+	for i, record := range a.roads {
+		roadIDs[record.ID] = roads[i].ID
+	}
+	// 归档不包含历史版本，导入时的状态作为道路的第一个版本
+	for i := range roads {
+		if err := history.RecordRoad(db, &roads[i], model.RoadChangeCreate, nil); err != nil {
+			return result, err
+		}
+	}
+
+	segmentIDs := make(map[uint]uint, len(a.roadSegments))
+	roadSegments := make([]model.RoadSegment, 0, len(a.roadSegments))
+	importedSegments := make([]roadSegmentRecord, 0, len(a.roadSegments))
+	for _, record := range a.roadSegments {
+		roadID, ok := roadIDs[record.RoadID]
+		if !ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("road segment %d: road %d not found, skipped", record.ID, record.RoadID))
+			continue
+		}
+		roadSegments = append(roadSegments, model.RoadSegment{
+			RoadID:        roadID,
+			Name:          record.Name,
+			StartChainage: record.StartChainage,
+			EndChainage:   record.EndChainage,
+			Length:        record.Length,
+			Geometry:      record.Geometry,
+		})
+		importedSegments = append(importedSegments, record)
+	}
+	if err := createAll(db, &roadSegments); err != nil {
+		return result, err
+	}
+	for i, record := range importedSegments {
+		segmentIDs[record.ID] = roadSegments[i].ID
+	}
+
+	// 巡检员和所属任务由外键约束，找不到时跳过任务或报告
+	planIDs := make(map[uint]uint, len(a.plans))
+	plans := make([]model.Plan, 0, len(a.plans))
+	importedPlans := make([]planRecord, 0, len(a.plans))
+	for _, record := range a.plans {
+		inspectorID, ok := userIDs[record.InspectorID]
+		if !ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("plan %d: inspector %d not found, skipped", record.ID, record.InspectorID))
+			continue
+		}
+		plans = append(plans, model.Plan{InspectorID: inspectorID, Date: record.Date, Status: record.Status})
+		importedPlans = append(importedPlans, record)
+	}
+	if err := createAll(db, &plans); err != nil {
+		return result, err
+	}
+	for i, record := range importedPlans {
+		planIDs[record.ID] = plans[i].ID
+	}
+
+	planRoads := make([]model.PlanRoad, 0, len(a.planRoads))
+	seen := make(map[planRoadRecord]bool, len(a.planRoads))
+	for _, record := range a.planRoads {
+		planID, planOK := planIDs[record.PlanID]
+		roadID, roadOK := roadIDs[record.RoadID]
+		if !planOK || !roadOK {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("plan road %d-%d: plan or road not found, skipped", record.PlanID, record.RoadID))
+			continue
+		}
+		if seen[record] {
+			continue
+		}
+		seen[record] = true
+		planRoads = append(planRoads, model.PlanRoad{PlanID: planID, RoadID: roadID})
+	}
+	if err := createAll(db, &planRoads); err != nil {
+		return result, err
+	}
+
+	planSegments := make([]model.PlanSegment, 0, len(a.planSegments))
+	seenSegments := make(map[planSegmentRecord]bool, len(a.planSegments))
+	for _, record := range a.planSegments {
+		planID, planOK := planIDs[record.PlanID]
+		segmentID, segmentOK := segmentIDs[record.SegmentID]
+		if !planOK || !segmentOK {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("plan segment %d-%d: plan or segment not found, skipped", record.PlanID, record.SegmentID))
+			continue
+		}
+		if seenSegments[record] {
+			continue
+		}
+		seenSegments[record] = true
+		planSegments = append(planSegments, model.PlanSegment{PlanID: planID, SegmentID: segmentID})
+	}
+	if err := createAll(db, &planSegments); err != nil {
+		return result, err
+	}
+
+	reports := make([]model.Report, 0, len(a.reports))
+	importedReports := make([]reportRecord, 0, len(a.reports))
+	for _, record := range a.reports {
+		planID, ok := planIDs[record.PlanID]
+		if !ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("report %d: plan %d not found, skipped", record.ID, record.PlanID))
+			continue
+		}
+		report := model.Report{
+			PlanID:     planID,
+			Content:    record.Content,
+			CreatedAt:  record.CreatedAt,
+			UpdatedAt:  record.UpdatedAt,
+			ApprovedAt: record.ApprovedAt,
+		}
+		if record.ApprovedBy != nil {
+			if approverID, ok := userIDs[*record.ApprovedBy]; ok {
+				report.ApprovedBy = &approverID
+			} else {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("report %d: approver %d not found, cleared", record.ID, *record.ApprovedBy))
+			}
+		}
+		if record.SegmentID != nil {
+			if segmentID, ok := segmentIDs[*record.SegmentID]; ok {
+				report.SegmentID = &segmentID
+				report.Chainage = record.Chainage
+			} else {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("report %d: segment %d not found, location cleared", record.ID, *record.SegmentID))
+			}
+		}
+		reports = append(reports, report)
+		importedReports = append(importedReports, record)
+	}
+	if err := createAll(db, &reports); err != nil {
+		return result, err
+	}
+	reportIDs := make(map[uint]uint, len(a.reports))
+	for i, record := range importedReports {
+		reportIDs[record.ID] = reports[i].ID
+	}
+
+	assetIDs := make(map[uint]uint, len(a.assets))
+	assets := make([]model.Asset, 0, len(a.assets))
+	importedAssets := make([]assetRecord, 0, len(a.assets))
+	for _, record := range a.assets {
+		roadID, ok := roadIDs[record.RoadID]
+		if !ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("asset %d: road %d not found, skipped", record.ID, record.RoadID))
+			continue
+		}
+		asset := model.Asset{
+			RoadID:      roadID,
+			Type:        record.Type,
+			Name:        record.Name,
+			Latitude:    record.Latitude,
+			Longitude:   record.Longitude,
+			InstallDate: record.InstallDate,
+			Condition:   record.Condition,
+			Attributes:  record.Attributes,
+			CreatedAt:   record.CreatedAt,
+			UpdatedAt:   record.UpdatedAt,
+		}
+		if record.SegmentID != nil {
+			if segmentID, ok := segmentIDs[*record.SegmentID]; ok {
+				asset.SegmentID = &segmentID
+				asset.Chainage = record.Chainage
+			} else {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("asset %d: segment %d not found, location cleared", record.ID, *record.SegmentID))
+			}
+		}
+		assets = append(assets, asset)
+		importedAssets = append(importedAssets, record)
+	}
+	if err := createAll(db, &assets); err != nil {
+		return result, err
+	}
+	for i, record := range importedAssets {
+		assetIDs[record.ID] = assets[i].ID
+	}
+
+	reportAssets := make([]model.ReportAsset, 0, len(a.reportAssets))
+	seenAssets := make(map[reportAssetRecord]bool, len(a.reportAssets))
+	for _, record := range a.reportAssets {
+		reportID, reportOK := reportIDs[record.ReportID]
+		assetID, assetOK := assetIDs[record.AssetID]
+		if !reportOK || !assetOK {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("report asset %d-%d: report or asset not found, skipped", record.ReportID, record.AssetID))
+			continue
+		}
+		if seenAssets[record] {
+			continue
+		}
+		seenAssets[record] = true
+		reportAssets = append(reportAssets, model.ReportAsset{ReportID: reportID, AssetID: assetID})
+	}
+	if err := createAll(db, &reportAssets); err != nil {
+		return result, err
+	}
+
+	result.Imported = Counts{
+		Users:        len(users),
+		Roads:        len(roads),
+		RoadSegments: len(roadSegments),
+		Plans:        len(plans),
+		PlanRoads:    len(planRoads),
+		PlanSegments: len(planSegments),
+		Reports:      len(reports),
+		Assets:       len(assets),
+		ReportAssets: len(reportAssets),
+		Zones:        len(zones),
+	}
+	return result, nil
+}
+
+// checkConflicts 检查归档中的用户名和角色是否与目标租户冲突
+func (a *Archive) checkConflicts(db *gorm.DB) error {
+	if len(a.users) == 0 {
+		return nil
+	}
+	usernames := make([]string, 0, len(a.users))
+	roles := make(map[string]bool)
+	for _, user := range a.users {
+		usernames = append(usernames, user.Username)
+		if !rbac.IsBuiltinRole(user.Role) {
+			roles[user.Role] = true
+		}
+	}
+
+	var taken []string
+	if err := db.Model(&model.User{}).Where("username IN ?", usernames).Pluck("username", &taken).Error; err != nil {
+		return err
+	}
+	if len(taken) > 0 {
+		return fmt.Errorf("%w: username %q already exists", ErrConflict, taken[0])
+	}
+
+	for role := range roles {
+		var count int64
+		if err := db.Model(&model.Role{}).Where("name = ?", role).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: role %q does not exist", ErrConflict, role)
+		}
+	}
+	return nil
+}
+
+// createAll 分批创建记录，创建后切片中的记录会带上新分配的ID
+func createAll[T any](db *gorm.DB, records *[]T) error {
+	if len(*records) == 0 {
+		return nil
+	}
+	return db.CreateInBatches(records, batchSize).Error
+}
+
+func readJSON(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(io.LimitReader(rc, MaxEntrySize)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, f.Name, err)
+	}
+	return nil
+}
+
+// readLines 逐条读取 JSON Lines 文件中的记录，f 为 nil 时不做任何事
+func readLines(f *zip.File, decode func(d *json.Decoder) error) error {
+	if f == nil {
+		return nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer rc.Close()
+
+	limited := &io.LimitedReader{R: rc, N: MaxEntrySize + 1}
+	decoder := json.NewDecoder(bufio.NewReader(limited))
+	for decoder.More() {
+		if err := decode(decoder); err != nil {
+			if limited.N <= 0 {
+				return fmt.Errorf("%w: %s exceeds %d bytes", ErrInvalidArchive, f.Name, MaxEntrySize)
+			}
+			return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, f.Name, err)
+		}
+	}
+	if limited.N <= 0 {
+		return fmt.Errorf("%w: %s exceeds %d bytes", ErrInvalidArchive, f.Name, MaxEntrySize)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package config
+
+import "github.com/Slinet6056/road-patrol-backend/internal/model"
+
+// backfillRoadBounds 为升级前创建、还没有外包矩形的道路计算外包矩形
+// 早期版本以全为 0 的外包矩形表示没有坐标，这些道路也重新计算，没有坐标的改为 NULL
+// 在注册租户回调之前执行，因此会处理所有租户的道路
+func backfillRoadBounds() error {
+	var roads []model.Road
+	err := DB.Where("min_lon IS NULL AND (latitude <> 0 OR longitude <> 0 OR geometry IS NOT NULL)").
+		Or("min_lon = 0 AND max_lon = 0 AND min_lat = 0 AND max_lat = 0").
+		Find(&roads).Error
+	if err != nil {
+		return err
+	}
+	for i := range roads {
+		if err := roads[i].ApplyGeometry(); err != nil {
+			continue
+		}
+		if err := DB.Model(&roads[i]).Select(model.RoadBBoxColumns).Updates(&roads[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
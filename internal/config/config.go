@@ -2,8 +2,11 @@ package config
 
 import (
 	"sync"
+	"time"
 
+	"github.com/Slinet6056/road-patrol-backend/internal/history"
 	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/password"
 	"github.com/spf13/viper"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -15,6 +18,41 @@ var (
 	GinPort   string
 	GinMode   string
 	DbMutex   sync.Mutex
+
+	LoginMaxFailures   int
+	LoginLockout       time.Duration
+	LoginIPMaxAttempts int
+	LoginIPWindow      time.Duration
+	LoginLimiterStore  string
+
+	TOTPIssuer string
+
+	JWTKeysDir      string
+	JWTActiveKID    string
+	JWTAcceptLegacy bool
+
+	PasswordResetTTL time.Duration
+	PasswordResetURL string
+
+	MailDriver       string
+	MailFrom         string
+	MailSMTPHost     string
+	MailSMTPPort     string
+	MailSMTPUsername string
+	MailSMTPPassword string
+	MailFileDir      string
+
+	SuperAdminUsername string
+	SuperAdminPassword string
+
+	QuotaMaxUsers           int
+	QuotaMaxRoads           int
+	QuotaMaxActivePlans     int
+	QuotaClosedPlanStatuses []string
+
+	RoadTypes            []string
+	RoadSurfaceMaterials []string
+	AssetTypes           []string
 )
 
 func InitConfig() {
@@ -25,9 +63,74 @@ func InitConfig() {
 	if err != nil {
 		panic("Failed to read the config file")
 	}
-	JWTSecret = viper.GetString("jwt_secret")
 	GinPort = viper.GetString("gin.port")
 	GinMode = viper.GetString("gin.mode")
+
+	viper.SetDefault("login.max_failures", 5)
+	viper.SetDefault("login.lockout", "15m")
+	viper.SetDefault("login.ip_max_attempts", 20)
+	viper.SetDefault("login.ip_window", "1m")
+	viper.SetDefault("login.limiter_store", "memory")
+	LoginMaxFailures = viper.GetInt("login.max_failures")
+	LoginLockout = viper.GetDuration("login.lockout")
+	LoginIPMaxAttempts = viper.GetInt("login.ip_max_attempts")
+	LoginIPWindow = viper.GetDuration("login.ip_window")
+	LoginLimiterStore = viper.GetString("login.limiter_store")
+
+	viper.SetDefault("jwt.keys_dir", "keys")
+	loadJWTConfig()
+
+	viper.SetDefault("totp.issuer", "RoadPatrol")
+	TOTPIssuer = viper.GetString("totp.issuer")
+
+	if cost := viper.GetInt("password.bcrypt_cost"); cost > 0 {
+		password.Cost = cost
+	}
+	if minLength := viper.GetInt("password.min_length"); minLength > 0 {
+		password.MinLength = minLength
+	}
+	viper.SetDefault("password.reset_ttl", "30m")
+	PasswordResetTTL = viper.GetDuration("password.reset_ttl")
+	PasswordResetURL = viper.GetString("password.reset_url")
+
+	SuperAdminUsername = viper.GetString("platform.superadmin_username")
+	SuperAdminPassword = viper.GetString("platform.superadmin_password")
+
+	viper.SetDefault("quota.closed_plan_statuses", []string{"completed", "cancelled"})
+	QuotaMaxUsers = viper.GetInt("quota.max_users")
+	QuotaMaxRoads = viper.GetInt("quota.max_roads")
+	QuotaMaxActivePlans = viper.GetInt("quota.max_active_plans")
+	QuotaClosedPlanStatuses = viper.GetStringSlice("quota.closed_plan_statuses")
+
+	RoadTypes = viper.GetStringSlice("road.types")
+	RoadSurfaceMaterials = viper.GetStringSlice("road.surface_materials")
+	AssetTypes = viper.GetStringSlice("asset.types")
+
+	viper.SetDefault("mail.driver", "log")
+	viper.SetDefault("mail.smtp.port", "25")
+	viper.SetDefault("mail.file_dir", "mail")
+	MailDriver = viper.GetString("mail.driver")
+	MailFrom = viper.GetString("mail.from")
+	MailSMTPHost = viper.GetString("mail.smtp.host")
+	MailSMTPPort = viper.GetString("mail.smtp.port")
+	MailSMTPUsername = viper.GetString("mail.smtp.username")
+	MailSMTPPassword = viper.GetString("mail.smtp.password")
+	MailFileDir = viper.GetString("mail.file_dir")
+}
+
+// ReloadJWTConfig 重新读取配置文件中与令牌签名密钥相关的配置
+func ReloadJWTConfig() {
+	if err := viper.ReadInConfig(); err != nil {
+		return
+	}
+	loadJWTConfig()
+}
+
+func loadJWTConfig() {
+	JWTSecret = viper.GetString("jwt_secret")
+	JWTKeysDir = viper.GetString("jwt.keys_dir")
+	JWTActiveKID = viper.GetString("jwt.active_kid")
+	JWTAcceptLegacy = viper.GetBool("jwt.accept_legacy_hs256")
 }
 
 func InitDB() {
@@ -51,15 +154,38 @@ func InitDB() {
 
 	// 连接到具体的数据库
 	dsn = username + ":" + password + "@tcp(" + host + ":" + port + ")/road_patrol?charset=utf8mb4&parseTime=True&loc=Local"
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	// 外键在清理已有的孤立数据之后由 createForeignKeys 单独建立，否则迁移会因孤立数据而失败
+	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{DisableForeignKeyConstraintWhenMigrating: true})
 	if err != nil {
 		panic("failed to connect to road_patrol database")
 	}
 
 	DbMutex.Lock()
-	err = DB.AutoMigrate(&model.Road{}, &model.User{}, &model.Plan{}, &model.Report{}, &model.PlanRoad{})
+	err = DB.AutoMigrate(&model.Road{}, &model.User{}, &model.Plan{}, &model.Report{}, &model.PlanRoad{}, &model.RoadSegment{}, &model.PlanSegment{}, &model.Asset{}, &model.ReportAsset{}, &model.VocabularyTerm{}, &model.Zone{}, &model.RoadVersion{}, &model.RefreshToken{}, &model.RecoveryCode{}, &model.TenantSetting{}, &model.Role{}, &model.RolePermission{}, &model.PasswordResetToken{}, &model.Tenant{})
 	DbMutex.Unlock()
 	if err != nil {
 		panic("failed to auto migrate database")
 	}
+
+	DbMutex.Lock()
+	err = backfillRoadBounds()
+	DbMutex.Unlock()
+	if err != nil {
+		panic("failed to backfill road bounds")
+	}
+
+	// 为升级前创建的道路记录基线版本，同样在注册租户回调之前执行
+	DbMutex.Lock()
+	err = history.Backfill(DB)
+	DbMutex.Unlock()
+	if err != nil {
+		panic("failed to backfill road history")
+	}
+
+	DbMutex.Lock()
+	err = createForeignKeys(viper.GetBool("database.repair_orphans"))
+	DbMutex.Unlock()
+	if err != nil {
+		panic("failed to create foreign keys: " + err.Error())
+	}
 }
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// foreignKey 为需要在数据库中建立的外键，field 为模型中的关联字段
+// fix 处理引用了不存在记录的孤立数据，为 nil 时存在孤立数据则拒绝建立外键，由管理员处理
+// repair 为管理员开启 database.repair_orphans 后对 fix 为 nil 的孤立数据的处理方式
+type foreignKey struct {
+	model  interface{}
+	field  string
+	fix    func(orphans *gorm.DB) error
+	repair func(orphans *gorm.DB) error
+}
+
+// foreignKeys 按被引用的表在前的顺序排列，清理孤立数据时不会产生新的孤立数据
+// 修复时删除的路段、设施和任务所留下的引用由排在后面的外键继续清理
+var foreignKeys = []foreignKey{
+	{&model.Road{}, "Zone", clearOrphans("zone_id"), nil},
+	{&model.RoadSegment{}, "Road", nil, deleteOrphans},
+	{&model.Asset{}, "Road", nil, deleteOrphans},
+	{&model.Asset{}, "Segment", clearOrphans("segment_id", "chainage"), nil},
+	{&model.Plan{}, "Inspector", nil, reassignInspectors},
+	{&model.PlanRoad{}, "Plan", deleteOrphans, nil},
+	{&model.PlanRoad{}, "Road", deleteOrphans, nil},
+	{&model.PlanSegment{}, "Plan", deleteOrphans, nil},
+	{&model.PlanSegment{}, "Segment", deleteOrphans, nil},
+	{&model.Report{}, "Plan", nil, deleteOrphans},
+	{&model.Report{}, "Segment", clearOrphans("segment_id", "chainage"), nil},
+	{&model.ReportAsset{}, "Report", deleteOrphans, nil},
+	{&model.ReportAsset{}, "Asset", deleteOrphans, nil},
+	{&model.Role{}, "Permissions", deleteOrphans, nil},
+}
+
+// orphanAdminRole 为修复时接手巡检员不存在的任务的角色
+const orphanAdminRole = "admin"
+
+// deleteOrphans 删除孤立的关联记录
+func deleteOrphans(orphans *gorm.DB) error {
+	return orphans.Delete(orphans.Statement.Model).Error
+}
+
+// clearOrphans 将孤立数据中的引用及相关字段清空
+func clearOrphans(columns ...string) func(orphans *gorm.DB) error {
+	return func(orphans *gorm.DB) error {
+		values := make(map[string]interface{}, len(columns))
+		for _, column := range columns {
+			values[column] = nil
+		}
+		return orphans.Updates(values).Error
+	}
+}
+
+// reassignInspectors 将巡检员不存在（包括 inspector_id 为 0）的任务改派给同一租户中ID最小的管理员，租户中没有管理员时删除这些任务
+func reassignInspectors(orphans *gorm.DB) error {
+	var plans []model.Plan
+	if err := orphans.Select("id", "tenant_id").Find(&plans).Error; err != nil {
+		return err
+	}
+	byTenant := make(map[uint][]uint)
+	for _, plan := range plans {
+		byTenant[plan.TenantID] = append(byTenant[plan.TenantID], plan.ID)
+	}
+	for tenantID, planIDs := range byTenant {
+		var admins []model.User
+		if err := DB.Where("tenant_id = ? AND role = ?", tenantID, orphanAdminRole).Order("id").Limit(1).Find(&admins).Error; err != nil {
+			return err
+		}
+		query := DB.Model(&model.Plan{}).Where("id IN ?", planIDs)
+		var err error
+		if len(admins) == 0 {
+			err = query.Delete(&model.Plan{}).Error
+		} else {
+			err = query.Update("inspector_id", admins[0].ID).Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orphans 返回引用了不存在记录的数据及其所在的表
+func (fk foreignKey) orphans() (*gorm.DB, string, error) {
+	stmt := &gorm.Statement{DB: DB}
+	if err := stmt.Parse(fk.model); err != nil {
+		return nil, "", err
+	}
+	rel, ok := stmt.Schema.Relationships.Relations[fk.field]
+	if !ok || len(rel.References) != 1 {
+		return nil, "", fmt.Errorf("%s has no relation %s", stmt.Schema.Name, fk.field)
+	}
+	// 属于关系的外键在模型自身的表中，拥有关系的外键在关联模型的表中
+	child, parent := rel.Schema, rel.FieldSchema
+	if rel.Type != schema.BelongsTo {
+		child, parent = rel.FieldSchema, rel.Schema
+	}
+	ref := rel.References[0]
+	column := clause.Column{Name: ref.ForeignKey.DBName}
+	parents := DB.Table(parent.Table).Select(ref.PrimaryKey.DBName)
+	orphans := DB.Model(reflect.New(child.ModelType).Interface()).Where("? IS NOT NULL AND ? NOT IN (?)", column, column, parents)
+	return orphans, child.Table, nil
+}
+
+// createForeignKeys 为已有数据清理孤立数据后建立外键，已存在的外键跳过
+// 在注册租户回调之前执行，因此会处理所有租户的数据；repairOrphans 为 false 且存在无法自动清理的孤立数据时返回错误，不建立任何外键
+func createForeignKeys(repairOrphans bool) error {
+	migrator := DB.Migrator()
+	var pending []foreignKey
+	var problems []string
+	for _, fk := range foreignKeys {
+		if migrator.HasConstraint(fk.model, fk.field) {
+			continue
+		}
+		if fk.fix == nil && repairOrphans {
+			fk.fix = fk.repair
+		}
+		pending = append(pending, fk)
+		if fk.fix != nil {
+			continue
+		}
+		orphans, table, err := fk.orphans()
+		if err != nil {
+			return err
+		}
+		var count int64
+		if err := orphans.Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			problems = append(problems, fmt.Sprintf("%d rows in %s reference a missing %s", count, table, strings.ToLower(fk.field)))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("orphaned rows must be fixed first, or set database.repair_orphans to repair them automatically: %s", strings.Join(problems, "; "))
+	}
+
+	for _, fk := range pending {
+		if fk.fix != nil {
+			orphans, _, err := fk.orphans()
+			if err != nil {
+				return err
+			}
+			if err := fk.fix(orphans); err != nil {
+				return err
+			}
+		}
+		if err := migrator.CreateConstraint(fk.model, fk.field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
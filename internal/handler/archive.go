@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/archive"
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/Slinet6056/road-patrol-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxArchiveUpload 为导入接口允许上传的归档大小
+const maxArchiveUpload = 64 << 20
+
+// ExportTenantData 将当前租户的数据导出为 zip 归档
+func ExportTenantData(c *gin.Context) {
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+
+	bufChan := make(chan *bytes.Buffer)
+	errChan := make(chan error)
+
+	go func() {
+		var buf bytes.Buffer
+		config.DbMutex.Lock()
+		_, err := archive.Export(config.DB, tenantID, &buf)
+		config.DbMutex.Unlock()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		bufChan <- &buf
+	}()
+
+	select {
+	case buf := <-bufChan:
+		logger.Info("Tenant ", strconv.FormatUint(uint64(tenantID), 10), " exported by user ", middleware.GetUsername(c))
+		filename := fmt.Sprintf("tenant-%d-%s.zip", tenantID, time.Now().Format("20060102"))
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Data(200, "application/zip", buf.Bytes())
+	case err := <-errChan:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// ImportTenantData 将上传的归档（表单字段 file）导入当前租户，归档中的记录会分配新的ID
+func ImportTenantData(c *gin.Context) {
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxArchiveUpload)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := archive.Read(file, fileHeader.Size)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	resultChan := make(chan archive.Result)
+	errChan := make(chan error)
+
+	go func() {
+		counts := data.Counts()
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		for _, quota := range []struct {
+			resource string
+			adding   int
+		}{
+			{quotaUsers, counts.Users},
+			{quotaRoads, counts.Roads},
+			{quotaActivePlans, data.CountPlans(planIsActive)},
+		} {
+			if err := checkQuota(db, tenantID, quota.resource, int64(quota.adding)); err != nil {
+				errChan <- err
+				return
+			}
+		}
+
+		var result archive.Result
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			result, err = data.Restore(tx, tenantID)
+			return err
+		})
+		if err != nil {
+			errChan <- err
+			return
+		}
+		resultChan <- result
+	}()
+
+	select {
+	case result := <-resultChan:
+		logger.Info("Archive imported into tenant ", strconv.FormatUint(uint64(tenantID), 10), " by user ", middleware.GetUsername(c))
+		c.JSON(201, result)
+	case err := <-errChan:
+		switch {
+		case errors.Is(err, archive.ErrInvalidArchive):
+			c.JSON(400, gin.H{"error": err.Error()})
+		case errors.Is(err, archive.ErrConflict):
+			c.JSON(409, gin.H{"error": err.Error()})
+		case respondQuotaExceeded(c, err):
+		default:
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
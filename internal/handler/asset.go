@@ -0,0 +1,485 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errAssetNotFound   = errors.New("no asset found with given ID")
+	errAssetsReferred  = errors.New("asset is referenced by reports")
+	errAssetIDNotFound = errors.New("asset not found")
+)
+
+// AssetJSON 为设施的请求格式，install_date 的格式为 2006-01-02
+type AssetJSON struct {
+	RoadID      uint             `json:"road_id"`
+	SegmentID   *uint            `json:"segment_id"`
+	Type        string           `json:"type"`
+	Name        string           `json:"name"`
+	Latitude    float64          `json:"latitude"`
+	Longitude   float64          `json:"longitude"`
+	Chainage    *geo.Chainage    `json:"chainage"`
+	InstallDate string           `json:"install_date"`
+	Condition   string           `json:"condition"`
+	Attributes  model.Attributes `json:"attributes"`
+}
+
+// ToAsset 将请求转换为设施并校验字段的取值范围
+func (a *AssetJSON) ToAsset() (model.Asset, model.FieldErrors) {
+	asset := model.Asset{
+		RoadID:     a.RoadID,
+		SegmentID:  a.SegmentID,
+		Type:       a.Type,
+		Name:       a.Name,
+		Latitude:   a.Latitude,
+		Longitude:  a.Longitude,
+		Chainage:   a.Chainage,
+		Condition:  a.Condition,
+		Attributes: a.Attributes,
+	}
+	var dateErr bool
+	if a.InstallDate != "" {
+		date, err := time.Parse("2006-01-02", a.InstallDate)
+		if err != nil {
+			dateErr = true
+		} else {
+			asset.InstallDate = &date
+		}
+	}
+	errs := asset.Validate()
+	if dateErr {
+		errs["install_date"] = "must be a date in YYYY-MM-DD format"
+	}
+	return asset, errs
+}
+
+// RoadDetail 为道路详情，包括道路上的全部设施
+type RoadDetail struct {
+	model.Road
+	Assets []model.Asset `json:"assets"`
+}
+
+// GetRoad 获取道路详情及道路上的设施，crs 参数指定返回的坐标使用的坐标系
+// 带有 as_of 参数时返回道路在该时间点的状态，不包括设施
+func GetRoad(c *gin.Context) {
+	db := tenantDB(c)
+	id := c.Param("id")
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+	if c.Query("as_of") != "" {
+		getRoadAsOf(c, id, crs)
+		return
+	}
+
+	detailChan := make(chan RoadDetail)
+	errChan := make(chan error)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		road, err := findRoad(db, id)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		assets := []model.Asset{}
+		if err := db.Where("road_id = ?", road.ID).Order("id").Find(&assets).Error; err != nil {
+			errChan <- err
+			return
+		}
+		detailChan <- RoadDetail{Road: road, Assets: assets}
+	}()
+
+	select {
+	case detail := <-detailChan:
+		detail.Road.ConvertCRS(geo.WGS84, crs)
+		detail.Assets = assetsInCRS(detail.Assets, crs)
+		c.JSON(200, detail)
+	case err := <-errChan:
+		if errors.Is(err, errRoadNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// assetListSpec 为 GetAssets 允许的筛选参数和排序字段
+// condition 是 MySQL 的保留字，筛选和排序时由 GORM 为列名加引号
+var assetListSpec = listSpec[model.Asset]{
+	filters: map[string]listFilter{
+		"road_id":    equalFilter("road_id", parseID),
+		"segment_id": equalFilter("segment_id", parseID),
+		"type":       equalFilter("type", parseString),
+		"condition":  equalFilter("condition", parseString),
+	},
+	sorts: map[string]listSort[model.Asset]{
+		"id":         {"id", func(a *model.Asset) interface{} { return a.ID }},
+		"name":       {"name", func(a *model.Asset) interface{} { return a.Name }},
+		"type":       {"type", func(a *model.Asset) interface{} { return a.Type }},
+		"condition":  {"condition", func(a *model.Asset) interface{} { return a.Condition }},
+		"updated_at": {"updated_at", func(a *model.Asset) interface{} { return a.UpdatedAt }},
+	},
+	defaultSort: "id",
+	id:          func(a *model.Asset) uint { return a.ID },
+}
+
+// GetAssets 分页获取设施，可以按道路、路段、类型和状况筛选，crs 参数指定返回的坐标使用的坐标系
+func GetAssets(c *gin.Context) {
+	db := tenantDB(c)
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+	list, ok := parseListQuery(c, &assetListSpec)
+	if !ok {
+		return
+	}
+
+	pageChan := make(chan ListPage)
+	errChan := make(chan error)
+
+	go func() {
+		var assets []model.Asset
+		config.DbMutex.Lock()
+		result := list.apply(db).Find(&assets)
+		config.DbMutex.Unlock()
+		if result.Error != nil {
+			errChan <- result.Error
+			return
+		}
+		assets, next := list.page(assets)
+		pageChan <- ListPage{Data: assetsInCRS(assets, crs), NextCursor: next}
+	}()
+
+	select {
+	case page := <-pageChan:
+		c.JSON(200, page)
+	case err := <-errChan:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// GetAsset 获取设施
+func GetAsset(c *gin.Context) {
+	db := tenantDB(c)
+	id := c.Param("id")
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+
+	var asset model.Asset
+	config.DbMutex.Lock()
+	result := db.Where("id = ?", id).First(&asset)
+	config.DbMutex.Unlock()
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": errAssetNotFound.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": result.Error.Error()})
+		}
+		return
+	}
+	asset.ConvertCRS(geo.WGS84, crs)
+	c.JSON(200, asset)
+}
+
+// AddAsset 添加新的设施，road_id 和 type 必填，crs 参数指定请求和响应中坐标使用的坐标系
+// 指定了路段和桩号但没有经纬度时，以路段几何形状上该桩号处的点作为设施的位置
+func AddAsset(c *gin.Context) {
+	db := tenantDB(c)
+	var assetJSON AssetJSON
+	if err := c.ShouldBindJSON(&assetJSON); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+	asset, fieldErrs := assetJSON.ToAsset()
+	if asset.RoadID == 0 {
+		fieldErrs["road_id"] = "is required"
+	}
+	if asset.Type == "" {
+		fieldErrs["type"] = "is required"
+	}
+	if len(fieldErrs) > 0 {
+		respondFieldErrors(c, "Invalid asset", fieldErrs)
+		return
+	}
+	asset.ConvertCRS(crs, geo.WGS84)
+
+	assetChan := make(chan model.Asset)
+	errChan := make(chan error)
+	invalidChan := make(chan model.FieldErrors)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		fieldErrs, err := prepareAsset(db, &asset)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		if len(fieldErrs) > 0 {
+			invalidChan <- fieldErrs
+			return
+		}
+		if err := db.Create(&asset).Error; err != nil {
+			errChan <- err
+			return
+		}
+		assetChan <- asset
+	}()
+
+	select {
+	case asset := <-assetChan:
+		asset.ConvertCRS(geo.WGS84, crs)
+		c.JSON(201, asset)
+	case fieldErrs := <-invalidChan:
+		respondFieldErrors(c, "Invalid asset", fieldErrs)
+	case err := <-errChan:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// UpdateAsset 更新设施，只修改请求中提供的字段，attributes 提供时整体替换
+// 修改了道路但没有指定路段时，设施原有的路段和桩号会被清除
+func UpdateAsset(c *gin.Context) {
+	db := tenantDB(c)
+	id := c.Param("id")
+	var assetJSON AssetJSON
+	if err := c.ShouldBindJSON(&assetJSON); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+	update, fieldErrs := assetJSON.ToAsset()
+	if len(fieldErrs) > 0 {
+		respondFieldErrors(c, "Invalid asset", fieldErrs)
+		return
+	}
+	// 坐标转换需要同时知道经度和纬度
+	if crs != geo.WGS84 && (update.Latitude == 0) != (update.Longitude == 0) {
+		c.JSON(400, gin.H{"error": "latitude and longitude must be provided together when crs is not wgs84"})
+		return
+	}
+	update.ConvertCRS(crs, geo.WGS84)
+
+	assetChan := make(chan model.Asset)
+	errChan := make(chan error)
+	invalidChan := make(chan model.FieldErrors)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		var asset model.Asset
+		if err := db.Where("id = ?", id).First(&asset).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				errChan <- errAssetNotFound
+			} else {
+				errChan <- err
+			}
+			return
+		}
+		mergeAsset(&asset, update)
+		fieldErrs, err := prepareAsset(db, &asset)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		if len(fieldErrs) > 0 {
+			invalidChan <- fieldErrs
+			return
+		}
+		if err := db.Save(&asset).Error; err != nil {
+			errChan <- err
+			return
+		}
+		assetChan <- asset
+	}()
+
+	select {
+	case asset := <-assetChan:
+		asset.ConvertCRS(geo.WGS84, crs)
+		c.JSON(200, asset)
+	case fieldErrs := <-invalidChan:
+		respondFieldErrors(c, "Invalid asset", fieldErrs)
+	case err := <-errChan:
+		if errors.Is(err, errAssetNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// DeleteAsset 删除设施，设施被巡检报告引用时返回 409
+func DeleteAsset(c *gin.Context) {
+	db := tenantDB(c)
+	id := c.Param("id")
+
+	resultChan := make(chan error)
+	referredChan := make(chan int64)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		var asset model.Asset
+		if err := db.Where("id = ?", id).First(&asset).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				resultChan <- errAssetNotFound
+			} else {
+				resultChan <- err
+			}
+			return
+		}
+		var reports int64
+		if err := db.Model(&model.ReportAsset{}).Where("asset_id = ?", asset.ID).Count(&reports).Error; err != nil {
+			resultChan <- err
+			return
+		}
+		if reports > 0 {
+			referredChan <- reports
+			return
+		}
+		resultChan <- db.Delete(&asset).Error
+	}()
+
+	select {
+	case reports := <-referredChan:
+		c.JSON(409, gin.H{"error": errAssetsReferred.Error(), "reports": reports})
+	case err := <-resultChan:
+		if errors.Is(err, errAssetNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(200, gin.H{"message": "Asset deleted"})
+		}
+	}
+}
+
+// mergeAsset 将请求中提供的字段写入已有设施
+func mergeAsset(asset *model.Asset, update model.Asset) {
+	if update.RoadID != 0 && update.RoadID != asset.RoadID {
+		asset.RoadID = update.RoadID
+		asset.SegmentID, asset.Chainage = nil, nil
+	}
+	if update.SegmentID != nil {
+		asset.SegmentID = update.SegmentID
+	}
+	if update.Chainage != nil {
+		asset.Chainage = update.Chainage
+	}
+	if update.Type != "" {
+		asset.Type = update.Type
+	}
+	if update.Name != "" {
+		asset.Name = update.Name
+	}
+	if update.Latitude != 0 || update.Longitude != 0 {
+		asset.Latitude, asset.Longitude = update.Latitude, update.Longitude
+	}
+	if update.InstallDate != nil {
+		asset.InstallDate = update.InstallDate
+	}
+	if update.Condition != "" {
+		asset.Condition = update.Condition
+	}
+	if update.Attributes != nil {
+		asset.Attributes = update.Attributes
+	}
+}
+
+// prepareAsset 检查设施的道路、路段和桩号，将类型统一为词表中的写法，并在需要时按桩号计算位置
+// 调用方需持有 config.DbMutex
+func prepareAsset(db *gorm.DB, asset *model.Asset) (model.FieldErrors, error) {
+	fieldErrs := model.FieldErrors{}
+	vocabulary, err := loadVocabulary(db)
+	if err != nil {
+		return nil, err
+	}
+	vocabulary.NormalizeAsset(asset, fieldErrs)
+
+	if _, err := findRoad(db, fmt.Sprint(asset.RoadID)); err != nil {
+		if !errors.Is(err, errRoadNotFound) {
+			return nil, err
+		}
+		fieldErrs["road_id"] = errRoadNotFound.Error()
+		return fieldErrs, nil
+	}
+	if asset.SegmentID == nil {
+		if asset.Chainage != nil {
+			fieldErrs["chainage"] = errChainageNoSegment.Error()
+		}
+		return fieldErrs, nil
+	}
+	var segment model.RoadSegment
+	if err := db.Where("id = ? AND road_id = ?", *asset.SegmentID, asset.RoadID).First(&segment).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		fieldErrs["segment_id"] = "segment not found on the road"
+		return fieldErrs, nil
+	}
+	if asset.Chainage == nil {
+		return fieldErrs, nil
+	}
+	if !segment.Contains(*asset.Chainage) {
+		fieldErrs["chainage"] = fmt.Sprintf("%s is not within %s", asset.Chainage, segment.Name)
+		return fieldErrs, nil
+	}
+	if asset.Latitude == 0 && asset.Longitude == 0 && segment.Geometry != nil {
+		p := segment.Geometry.PointAt(float64(*asset.Chainage - segment.StartChainage))
+		asset.Longitude, asset.Latitude = p.Lon(), p.Lat()
+	}
+	return fieldErrs, nil
+}
+
+// checkAssetsExist 检查设施都存在于当前租户中，调用方需持有 config.DbMutex
+func checkAssetsExist(db *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var found []uint
+	if err := db.Model(&model.Asset{}).Where("id IN ?", ids).Pluck("id", &found).Error; err != nil {
+		return err
+	}
+	exists := make(map[uint]bool, len(found))
+	for _, id := range found {
+		exists[id] = true
+	}
+	for _, id := range ids {
+		if !exists[id] {
+			return fmt.Errorf("%w: %d", errAssetIDNotFound, id)
+		}
+	}
+	return nil
+}
+
+// assetsInCRS 将以 WGS84 保存的设施位置转换到请求的坐标系
+func assetsInCRS(assets []model.Asset, crs geo.CRS) []model.Asset {
+	if assets == nil {
+		return []model.Asset{}
+	}
+	for i := range assets {
+		assets[i].ConvertCRS(geo.WGS84, crs)
+	}
+	return assets
+}
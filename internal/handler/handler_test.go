@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/rbac"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/Slinet6056/road-patrol-backend/pkg/middleware"
+	"github.com/Slinet6056/road-patrol-backend/pkg/password"
+	"github.com/Slinet6056/road-patrol-backend/pkg/token"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// testRouter 注册了测试用到的路由，中间件与 cmd/main.go 中一致
+var testRouter *gin.Engine
+
+func TestMain(m *testing.M) {
+	if err := logger.Init(); err != nil {
+		panic(err)
+	}
+	db, err := gorm.Open(sqlite.Open("file:handler_test?mode=memory&cache=shared&_pragma=foreign_keys(1)"), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		panic(err)
+	}
+	err = db.AutoMigrate(&model.Road{}, &model.User{}, &model.Plan{}, &model.Report{}, &model.PlanRoad{}, &model.RoadSegment{}, &model.PlanSegment{}, &model.Asset{}, &model.ReportAsset{}, &model.VocabularyTerm{}, &model.Zone{}, &model.RoadVersion{}, &model.RefreshToken{}, &model.RecoveryCode{}, &model.TenantSetting{}, &model.Role{}, &model.RolePermission{}, &model.PasswordResetToken{}, &model.Tenant{})
+	if err != nil {
+		panic(err)
+	}
+	if err := tenancy.Register(db); err != nil {
+		panic(err)
+	}
+	config.DB = db
+
+	keysDir, err := os.MkdirTemp("", "handler-test-keys")
+	if err != nil {
+		panic(err)
+	}
+	if err := token.LoadKeys(keysDir, "", ""); err != nil {
+		panic(err)
+	}
+	password.Cost = bcrypt.MinCost
+	config.LoginMaxFailures = 5
+	config.LoginLockout = 15 * time.Minute
+	config.LoginIPWindow = time.Minute
+	config.PasswordResetTTL = 30 * time.Minute
+	config.QuotaClosedPlanStatuses = []string{"completed", "cancelled"}
+	InitLoginGuard()
+	InitMailer()
+
+	gin.SetMode(gin.TestMode)
+	testRouter = newTestRouter()
+	code := m.Run()
+	os.RemoveAll(keysDir)
+	os.Exit(code)
+}
+
+func newTestRouter() *gin.Engine {
+	router := gin.New()
+	router.POST("/login", Login)
+	router.POST("/login/2fa", LoginMFA)
+	router.POST("/password/forgot", ForgotPassword)
+	router.POST("/password/reset", ResetPassword)
+	router.POST("/refresh-token", RefreshToken)
+	router.POST("/logout", Logout)
+
+	authorized := router.Group("/")
+	authorized.Use(middleware.JWTAuth())
+	{
+		authorized.GET("/me", GetMe)
+		authorized.PUT("/me", UpdateMe)
+		authorized.PUT("/me/password", ChangePassword)
+
+		authorized.GET("/roads", middleware.RequirePermission(rbac.RoadRead), GetRoads)
+		authorized.POST("/road", middleware.RequirePermission(rbac.RoadWrite), AddRoad)
+		authorized.GET("/road/:id", middleware.RequirePermission(rbac.RoadRead), GetRoad)
+		authorized.GET("/users", middleware.RequirePermission(rbac.UserRead), GetUsers)
+		authorized.POST("/user", middleware.RequirePermission(rbac.UserWrite), AddUser)
+		authorized.POST("/plan", middleware.RequirePermission(rbac.PlanWrite), AddPlan)
+		authorized.PUT("/plan/:id", middleware.RequirePermission(rbac.PlanWrite), UpdatePlan)
+		authorized.POST("/report", middleware.RequirePermission(rbac.ReportWrite), AddReport)
+		authorized.POST("/role", middleware.RequirePermission(rbac.RoleManage), AddRole)
+		authorized.PUT("/role/:id", middleware.RequirePermission(rbac.RoleManage), UpdateRole)
+		authorized.GET("/tenant/usage", middleware.RequirePermission(rbac.TenantConfig), GetTenantUsage)
+		authorized.POST("/tenant", middleware.RequirePermission(rbac.TenantManage), AddTenant)
+	}
+	return router
+}
+
+var tenantSeq atomic.Uint32
+
+// newTenant 创建一个新的启用状态的租户，每个测试使用各自的租户，互不影响
+func newTenant(t *testing.T, quota ...func(*model.Tenant)) uint {
+	t.Helper()
+	tenant := model.Tenant{Name: "test-" + strconv.FormatUint(uint64(tenantSeq.Add(1)), 10), Status: model.TenantActive}
+	for _, set := range quota {
+		set(&tenant)
+	}
+	if err := config.DB.Create(&tenant).Error; err != nil {
+		t.Fatal(err)
+	}
+	return tenant.ID
+}
+
+// newUser 在租户中创建用户，密码为 secret123
+func newUser(t *testing.T, tenantID uint, username string, role string) model.User {
+	t.Helper()
+	hashed, err := password.Hash("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := model.User{Username: username, Password: hashed, Role: role, Email: username + "@example.com"}
+	if err := tenancy.Scoped(config.DB, tenantID).Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// doRequest 以 JSON 请求体发送请求，accessToken 为空时不带 Authorization 头
+func doRequest(method string, path string, accessToken string, body interface{}) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	return w
+}
+
+// decode 解析 JSON 响应体
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response %d is not JSON: %s", w.Code, w.Body.String())
+	}
+	return body
+}
+
+// login 以密码 secret123 登录并返回访问令牌和刷新令牌
+func login(t *testing.T, tenantID uint, username string) (string, string) {
+	t.Helper()
+	w := doRequest("POST", "/login?tenant_id="+uintString(tenantID), "", gin.H{"username": username, "password": "secret123"})
+	if w.Code != 200 {
+		t.Fatalf("login %s: %d %s", username, w.Code, w.Body.String())
+	}
+	data, _ := decode(t, w)["data"].(map[string]interface{})
+	accessToken, _ := data["accessToken"].(string)
+	refreshToken, _ := data["refreshToken"].(string)
+	if accessToken == "" || refreshToken == "" {
+		t.Fatalf("login %s: no tokens in %s", username, w.Body.String())
+	}
+	return accessToken, refreshToken
+}
+
+// uintString 将ID格式化为十进制字符串，用于拼接路径和查询参数
+func uintString(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
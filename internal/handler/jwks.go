@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/Slinet6056/road-patrol-backend/pkg/token"
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS 返回用于校验令牌的公钥集合
+func JWKS(c *gin.Context) {
+	jwks, err := token.JWKS()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "signing keys are not available"})
+		logger.Error(err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, jwks)
+}
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// listFilter 解析查询参数的值并返回对应的查询条件，值不合法时返回错误
+type listFilter func(value string) (listCondition, error)
+
+// listCondition 为列表查询的一个筛选条件
+type listCondition func(db *gorm.DB) *gorm.DB
+
+// listSort 为可排序的字段，value 从记录中取出该字段的值，用于生成游标
+type listSort[T any] struct {
+	column string
+	value  func(*T) interface{}
+}
+
+// listSpec 声明列表接口允许的筛选参数和排序字段
+// 排序相同时按 ID 排序，因此 id 返回记录的 ID，排序字段的值不能为 NULL
+type listSpec[T any] struct {
+	filters     map[string]listFilter
+	sorts       map[string]listSort[T]
+	defaultSort string
+	id          func(*T) uint
+}
+
+// ListPage 为分页列表的响应格式，NextCursor 为 nil 表示没有更多记录
+type ListPage struct {
+	Data       interface{} `json:"data"`
+	NextCursor *string     `json:"next_cursor"`
+}
+
+// listCursor 为游标的内容，记录上一页最后一条记录的排序字段值和 ID
+type listCursor struct {
+	Sort  string          `json:"sort"`
+	Value json.RawMessage `json:"value"`
+	ID    uint            `json:"id"`
+}
+
+// listQuery 为解析后的列表查询参数
+type listQuery[T any] struct {
+	spec    *listSpec[T]
+	filters []listCondition
+	sortKey string
+	sort    listSort[T]
+	desc    bool
+	limit   int
+
+	// after 为游标指向的记录，afterValue 为该记录的排序字段值，已转换为字段的类型
+	after      *listCursor
+	afterValue interface{}
+}
+
+// parseListQuery 按 spec 解析请求中的筛选、排序（sort=字段 或 sort=-字段）和分页参数（limit、cursor）
+// 参数不合法时返回 400 并返回 false
+func parseListQuery[T any](c *gin.Context, spec *listSpec[T]) (*listQuery[T], bool) {
+	q, err := spec.parse(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return q, true
+}
+
+func (spec *listSpec[T]) parse(c *gin.Context) (*listQuery[T], error) {
+	q := &listQuery[T]{spec: spec, limit: defaultListLimit}
+	for name, filter := range spec.filters {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		condition, err := filter(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		q.filters = append(q.filters, condition)
+	}
+
+	q.sortKey = c.DefaultQuery("sort", spec.defaultSort)
+	field, ok := spec.sorts[strings.TrimPrefix(q.sortKey, "-")]
+	if !ok {
+		return nil, errors.New("sort must be one of " + strings.Join(spec.sortKeys(), ", ") + ", optionally prefixed with -")
+	}
+	q.sort, q.desc = field, strings.HasPrefix(q.sortKey, "-")
+
+	if s := c.Query("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			return nil, errors.New("limit must be between 1 and " + strconv.Itoa(maxListLimit))
+		}
+		q.limit = limit
+	}
+
+	if s := c.Query("cursor"); s != "" {
+		after, err := decodeListCursor(s)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		if after.Sort != q.sortKey {
+			return nil, errors.New("cursor was issued for a different sort")
+		}
+		value := reflect.New(reflect.TypeOf(field.value(new(T))))
+		if err := json.Unmarshal(after.Value, value.Interface()); err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		q.after, q.afterValue = after, value.Elem().Interface()
+	}
+	return q, nil
+}
+
+// sortKeys 返回允许的排序字段，按字母顺序排列
+func (spec *listSpec[T]) sortKeys() []string {
+	keys := make([]string, 0, len(spec.sorts))
+	for key := range spec.sorts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// filter 只应用筛选条件，用于不分页的查询
+func (q *listQuery[T]) filter(db *gorm.DB) *gorm.DB {
+	for _, apply := range q.filters {
+		db = apply(db)
+	}
+	return db
+}
+
+// apply 应用筛选条件、排序和游标，多查询一条记录用于判断是否还有下一页
+func (q *listQuery[T]) apply(db *gorm.DB) *gorm.DB {
+	db = q.filter(db)
+	column := clause.Column{Name: q.sort.column}
+	id := clause.Column{Name: "id"}
+	if q.after != nil {
+		op := ">"
+		if q.desc {
+			op = "<"
+		}
+		if q.sort.column == "id" {
+			db = db.Where("? "+op+" ?", id, q.after.ID)
+		} else {
+			v := q.afterValue
+			db = db.Where("(? "+op+" ? OR (? = ? AND ? "+op+" ?))", column, v, column, v, id, q.after.ID)
+		}
+	}
+	if q.sort.column != "id" {
+		db = db.Order(clause.OrderByColumn{Column: column, Desc: q.desc})
+	}
+	return db.Order(clause.OrderByColumn{Column: id, Desc: q.desc}).Limit(q.limit + 1)
+}
+
+// page 去掉多查询的一条记录，还有下一页时返回指向本页最后一条记录的游标
+func (q *listQuery[T]) page(rows []T) ([]T, *string) {
+	if rows == nil {
+		rows = []T{}
+	}
+	if len(rows) <= q.limit {
+		return rows, nil
+	}
+	rows = rows[:q.limit]
+	last := &rows[len(rows)-1]
+	value, _ := json.Marshal(q.sort.value(last))
+	cursor := encodeListCursor(listCursor{Sort: q.sortKey, Value: value, ID: q.spec.id(last)})
+	return rows, &cursor
+}
+
+func encodeListCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(s string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// equalFilter 按字段值精确筛选，多个值以逗号分隔时匹配其中任意一个，parse 将参数转换为字段的类型
+func equalFilter(column string, parse func(string) (interface{}, error)) listFilter {
+	return func(value string) (listCondition, error) {
+		var values []interface{}
+		for _, s := range strings.Split(value, ",") {
+			v, err := parse(strings.TrimSpace(s))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("? IN ?", clause.Column{Name: column}, values)
+		}, nil
+	}
+}
+
+// dateFilter 按日期范围筛选，日期格式为 2006-01-02，until 为 false 时匹配该日及之后，为 true 时匹配该日及之前
+// 日期按服务器时区解析，与数据库连接的 loc=Local 一致
+func dateFilter(column string, until bool) listFilter {
+	return func(value string) (listCondition, error) {
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return nil, errors.New("must be a date in the form 2006-01-02")
+		}
+		return func(db *gorm.DB) *gorm.DB {
+			if until {
+				return db.Where("? < ?", clause.Column{Name: column}, date.AddDate(0, 0, 1))
+			}
+			return db.Where("? >= ?", clause.Column{Name: column}, date)
+		}, nil
+	}
+}
+
+// nullFilter 按字段是否有值筛选，参数为 true 时匹配有值的记录
+func nullFilter(column string) listFilter {
+	return func(value string) (listCondition, error) {
+		set, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		return func(db *gorm.DB) *gorm.DB {
+			if set {
+				return db.Where("? IS NOT NULL", clause.Column{Name: column})
+			}
+			return db.Where("? IS NULL", clause.Column{Name: column})
+		}, nil
+	}
+}
+
+func parseString(s string) (interface{}, error) {
+	if s == "" {
+		return nil, errors.New("must not be empty")
+	}
+	return s, nil
+}
+
+func parseID(s string) (interface{}, error) {
+	id, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		return nil, errors.New("must be a positive integer")
+	}
+	return uint(id), nil
+}
+
+func parseInt(s string) (interface{}, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, errors.New("must be an integer")
+	}
+	return n, nil
+}
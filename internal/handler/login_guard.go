@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/limiter"
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	// accountLimiter 限制同一 (租户, 用户名) 的连续失败次数，超出后临时锁定账户
+	// 每次尝试在校验之前先占用一次计数，校验通过后再清除，因此并发的尝试也不会超出限制
+	accountLimiter *limiter.SlidingWindow
+	// ipLimiter 限制同一客户端 IP 的登录尝试频率
+	ipLimiter *limiter.SlidingWindow
+)
+
+// InitLoginGuard 根据配置初始化登录防暴力破解的计数器
+func InitLoginGuard() {
+	var store limiter.Store
+	switch config.LoginLimiterStore {
+	case "database":
+		gormStore, err := limiter.NewGormStore(config.DB, &config.DbMutex)
+		if err != nil {
+			panic("failed to initialize login limiter store")
+		}
+		store = gormStore
+	default:
+		store = limiter.NewMemoryStore()
+	}
+
+	accountLimiter = &limiter.SlidingWindow{Store: store, Limit: config.LoginMaxFailures, Window: config.LoginLockout}
+	ipLimiter = &limiter.SlidingWindow{Store: store, Limit: config.LoginIPMaxAttempts, Window: config.LoginIPWindow}
+}
+
+// accountKey 返回账户的计数键，用户名不区分大小写，与数据库的排序规则一致
+func accountKey(tenantID uint, username string) string {
+	return "login:account:" + strconv.FormatUint(uint64(tenantID), 10) + ":" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+// rejectThrottled 返回 429 并设置 Retry-After 头
+func rejectThrottled(c *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "message": message, "retry_after": seconds})
+}
+
+// guardLogin 在校验密码之前检查 IP 和账户是否被限制，被限制时直接返回 429
+// 未被限制时本次尝试已经计为一次失败，校验通过后需要调用 recordLoginSuccess 或 releaseLoginAttempt
+func guardLogin(c *gin.Context, tenantID uint, username string) bool {
+	now := time.Now()
+
+	retryAfter, err := ipLimiter.Allow(ipKey(c.ClientIP()), now)
+	if err != nil {
+		logger.Error("Login limiter error: ", err.Error())
+	} else if retryAfter > 0 {
+		logger.Warn("Login throttled for ip ", c.ClientIP())
+		rejectThrottled(c, retryAfter, "登录尝试过于频繁，请稍后再试")
+		return false
+	}
+
+	retryAfter, err = accountLimiter.Allow(accountKey(tenantID, username), now)
+	if err != nil {
+		logger.Error("Login limiter error: ", err.Error())
+	} else if retryAfter > 0 {
+		logger.Warn("Login rejected for locked account ", username, " in tenant ", strconv.FormatUint(uint64(tenantID), 10))
+		rejectThrottled(c, retryAfter, "账户已被临时锁定，请稍后再试")
+		return false
+	}
+	return true
+}
+
+// releaseLoginAttempt 撤销 guardLogin 为本次尝试占用的计数，但保留此前的失败记录
+func releaseLoginAttempt(tenantID uint, username string) {
+	if err := accountLimiter.Release(accountKey(tenantID, username)); err != nil {
+		logger.Error("Login limiter error: ", err.Error())
+	}
+}
+
+// recordLoginSuccess 登录成功后清除账户的失败计数
+func recordLoginSuccess(tenantID uint, username string) {
+	if err := accountLimiter.Reset(accountKey(tenantID, username)); err != nil {
+		logger.Error("Login limiter error: ", err.Error())
+	}
+}
+
+// UnlockUser 解除用户因登录失败过多导致的锁定
+func UnlockUser(c *gin.Context) {
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+
+	var user model.User
+	config.DbMutex.Lock()
+	result := tenantDB(c).Where("id = ?", id).First(&user)
+	config.DbMutex.Unlock()
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "no user found with given ID"})
+		} else {
+			c.JSON(500, gin.H{"error": result.Error.Error()})
+		}
+		return
+	}
+
+	if err := accountLimiter.Reset(accountKey(tenantID, user.Username)); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "User unlocked"})
+}
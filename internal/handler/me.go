@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/Slinet6056/road-patrol-backend/pkg/middleware"
+	"github.com/Slinet6056/road-patrol-backend/pkg/password"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loadCurrentUser 读取当前令牌对应的用户
+func loadCurrentUser(c *gin.Context) (model.User, error) {
+	var user model.User
+	config.DbMutex.Lock()
+	err := tenantDB(c).Where("id = ?", middleware.GetUserID(c)).First(&user).Error
+	config.DbMutex.Unlock()
+	return user, err
+}
+
+// respondCurrentUserError 处理读取当前用户失败的情况
+func respondCurrentUserError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "no user found for the token"})
+	} else {
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// GetMe 获取当前用户的信息
+func GetMe(c *gin.Context) {
+	user, err := loadCurrentUser(c)
+	if err != nil {
+		respondCurrentUserError(c, err)
+		return
+	}
+
+	c.JSON(200, user)
+}
+
+// UpdateMe 更新当前用户允许自行修改的信息
+// 修改邮箱需要提供当前密码，否则持有被盗访问令牌的人可以改掉邮箱再通过找回密码接管账户；修改成功后吊销该用户的其他会话
+func UpdateMe(c *gin.Context) {
+	var params struct {
+		Email           *string `json:"email" binding:"omitempty,email"`
+		Phone           *string `json:"phone"`
+		CurrentPassword string  `json:"current_password"`
+	}
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := loadCurrentUser(c)
+	if err != nil {
+		respondCurrentUserError(c, err)
+		return
+	}
+
+	emailChanged := params.Email != nil && *params.Email != user.Email
+	if emailChanged {
+		if params.CurrentPassword == "" {
+			c.JSON(400, gin.H{"error": "current_password is required to change the email"})
+			return
+		}
+		if !verifyCurrentPassword(c, user, params.CurrentPassword) {
+			return
+		}
+	}
+
+	updates := make(map[string]interface{})
+	if emailChanged {
+		updates["email"] = *params.Email
+		user.Email = *params.Email
+	}
+	if params.Phone != nil {
+		updates["phone"] = *params.Phone
+		user.Phone = *params.Phone
+	}
+	if len(updates) == 0 {
+		c.JSON(200, gin.H{"message": "No changes made"})
+		return
+	}
+
+	config.DbMutex.Lock()
+	err = tenantDB(c).Model(&model.User{}).Where("id = ?", user.ID).Updates(updates).Error
+	config.DbMutex.Unlock()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if emailChanged {
+		if err := revokeUserSessions(user.TenantID, user.ID, middleware.GetSessionID(c)); err != nil {
+			logger.Error("Could not revoke sessions: ", err.Error())
+		}
+	}
+
+	c.JSON(200, user)
+}
+
+// verifyCurrentPassword 校验当前用户输入的密码，与登录共用失败计数和锁定，校验失败时直接返回错误响应
+func verifyCurrentPassword(c *gin.Context, user model.User, plain string) bool {
+	if !guardLogin(c, user.TenantID, user.Username) {
+		return false
+	}
+	if ok, _ := password.Verify(user.Password, plain); !ok {
+		c.JSON(400, gin.H{"error": "current password is incorrect"})
+		return false
+	}
+	recordLoginSuccess(user.TenantID, user.Username)
+	return true
+}
+
+// ChangePassword 修改当前用户的密码，成功后吊销该用户的其他会话
+func ChangePassword(c *gin.Context) {
+	var params struct {
+		OldPassword string `json:"old_password" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := loadCurrentUser(c)
+	if err != nil {
+		respondCurrentUserError(c, err)
+		return
+	}
+
+	if !verifyCurrentPassword(c, user, params.OldPassword) {
+		return
+	}
+	if params.NewPassword == params.OldPassword {
+		c.JSON(400, gin.H{"error": "new password must be different from the old password"})
+		return
+	}
+	if err := password.Validate(params.NewPassword, user.Username); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashed, err := password.Hash(params.NewPassword)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	config.DbMutex.Lock()
+	err = tenantDB(c).Model(&model.User{}).Where("id = ?", user.ID).Update("password", hashed).Error
+	config.DbMutex.Unlock()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := revokeUserSessions(user.TenantID, user.ID, middleware.GetSessionID(c)); err != nil {
+		logger.Error("Could not revoke sessions: ", err.Error())
+	}
+
+	c.JSON(200, gin.H{"message": "Password changed"})
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdateMeEmail(t *testing.T) {
+	tenantID := newTenant(t)
+	user := newUser(t, tenantID, "alice", "inspector")
+	accessToken, refreshToken := login(t, tenantID, "alice")
+	_, otherRefreshToken := login(t, tenantID, "alice")
+
+	tests := []struct {
+		name string
+		body gin.H
+		want int
+	}{
+		{"phone without password", gin.H{"phone": "13800000000"}, 200},
+		{"same email without password", gin.H{"email": user.Email}, 200},
+		{"email without password", gin.H{"email": "new@example.com"}, 400},
+		{"email with wrong password", gin.H{"email": "new@example.com", "current_password": "wrong"}, 400},
+		{"invalid email", gin.H{"email": "not-an-email", "current_password": "secret123"}, 400},
+	}
+	for _, tt := range tests {
+		if w := doRequest("PUT", "/me", accessToken, tt.body); w.Code != tt.want {
+			t.Errorf("%s: PUT /me = %d %s, want %d", tt.name, w.Code, w.Body.String(), tt.want)
+		}
+	}
+	if w := doRequest("POST", "/refresh-token", "", gin.H{"refreshToken": otherRefreshToken}); w.Code != 200 {
+		t.Fatalf("other session was revoked before the email changed: %d", w.Code)
+	}
+	_, otherRefreshToken = login(t, tenantID, "alice")
+
+	w := doRequest("PUT", "/me", accessToken, gin.H{"email": "new@example.com", "current_password": "secret123"})
+	if w.Code != 200 {
+		t.Fatalf("PUT /me = %d %s", w.Code, w.Body.String())
+	}
+	var saved model.User
+	if err := tenancy.Scoped(config.DB, tenantID).First(&saved, user.ID).Error; err != nil || saved.Email != "new@example.com" {
+		t.Errorf("saved email = %q, %v, want new@example.com", saved.Email, err)
+	}
+	// 其他会话被吊销，当前会话保留
+	if w := doRequest("POST", "/refresh-token", "", gin.H{"refreshToken": otherRefreshToken}); w.Code != 401 {
+		t.Errorf("refresh from another session = %d, want 401", w.Code)
+	}
+	if w := doRequest("POST", "/refresh-token", "", gin.H{"refreshToken": refreshToken}); w.Code != 200 {
+		t.Errorf("refresh from the current session = %d, want 200", w.Code)
+	}
+}
+
+func TestChangePasswordThrottled(t *testing.T) {
+	tenantID := newTenant(t)
+	newUser(t, tenantID, "bob", "inspector")
+	accessToken, _ := login(t, tenantID, "bob")
+
+	for i := 0; i < config.LoginMaxFailures; i++ {
+		w := doRequest("PUT", "/me/password", accessToken, gin.H{"old_password": "guess", "new_password": "another-secret-1"})
+		if w.Code != 400 {
+			t.Fatalf("guess %d: %d %s, want 400", i+1, w.Code, w.Body.String())
+		}
+	}
+	// 锁定后即使旧密码正确也被拒绝
+	w := doRequest("PUT", "/me/password", accessToken, gin.H{"old_password": "secret123", "new_password": "another-secret-1"})
+	if w.Code != 429 {
+		t.Errorf("PUT /me/password after %d failures = %d, want 429", config.LoginMaxFailures, w.Code)
+	}
+	if w := doRequest("POST", "/login?tenant_id="+uintString(tenantID), "", gin.H{"username": "bob", "password": "secret123"}); w.Code != 429 {
+		t.Errorf("login after %d failed password changes = %d, want 429", config.LoginMaxFailures, w.Code)
+	}
+}
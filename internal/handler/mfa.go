@@ -0,0 +1,546 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/rbac"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/Slinet6056/road-patrol-backend/pkg/token"
+	"github.com/Slinet6056/road-patrol-backend/pkg/totp"
+	"github.com/gin-gonic/gin"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	errInvalidSecondFactor = errors.New("invalid verification code")
+	errMFAChallengeUsed    = errors.New("mfa token has already been used or replaced")
+)
+
+// mfaRequired 判断用户登录时是否需要进行两步验证
+func mfaRequired(user model.User) (bool, error) {
+	if user.TOTPEnabled {
+		return true, nil
+	}
+	return adminMFARequired(user)
+}
+
+// adminMFARequired 判断租户是否要求该用户必须启用两步验证
+// 拥有管理角色或用户权限的角色均视为管理员，包括被授予这些权限的自定义角色
+func adminMFARequired(user model.User) (bool, error) {
+	permissions, err := rbac.RolePermissions(user.TenantID, user.Role)
+	if err != nil {
+		return false, err
+	}
+	if !permissions[rbac.RoleManage] && !permissions[rbac.UserWrite] {
+		return false, nil
+	}
+	setting, err := loadTenantSetting(user.TenantID)
+	if err != nil {
+		return false, err
+	}
+	return setting.RequireAdminMFA, nil
+}
+
+func loadTenantSetting(tenantID uint) (model.TenantSetting, error) {
+	var settings []model.TenantSetting
+	config.DbMutex.Lock()
+	err := tenancy.Scoped(config.DB, tenantID).Limit(1).Find(&settings).Error
+	config.DbMutex.Unlock()
+	if err != nil {
+		return model.TenantSetting{}, err
+	}
+	if len(settings) == 0 {
+		return model.TenantSetting{TenantID: tenantID}, nil
+	}
+	return settings[0], nil
+}
+
+// mfaChallenge 生成两步验证挑战的响应数据，并记录挑战令牌的ID，此前签发的挑战令牌随之失效
+func mfaChallenge(user model.User) (gin.H, error) {
+	claims := token.NewClaims(user, token.TypeMFA, token.MFATokenTTL)
+	mfaToken, err := token.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	config.DbMutex.Lock()
+	err = tenancy.Scoped(config.DB, user.TenantID).Model(&model.User{}).Where("id = ?", user.ID).Update("mfa_challenge_id", claims.ID).Error
+	config.DbMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"mfaRequired": true,
+		"enrolled":    user.TOTPEnabled,
+		"mfaToken":    mfaToken,
+		"expires":     claims.ExpiresAt.Format("2006/01/02 15:04:05"),
+	}, nil
+}
+
+// startEnrollment 为用户生成待确认的 TOTP 密钥
+func startEnrollment(user *model.User) (gin.H, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	config.DbMutex.Lock()
+	err = tenancy.Scoped(config.DB, user.TenantID).Model(&model.User{}).Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": false, "totp_last_step": 0}).Error
+	config.DbMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = secret
+
+	account := user.Username + "@" + strconv.FormatUint(uint64(user.TenantID), 10)
+	return gin.H{
+		"secret":          secret,
+		"provisioningUri": totp.ProvisioningURI(config.TOTPIssuer, account, secret),
+	}, nil
+}
+
+// verifyTOTP 校验 TOTP 验证码，并记录已使用的时间步以防重放
+func verifyTOTP(user *model.User, code string) (bool, error) {
+	if user.TOTPSecret == "" {
+		return false, nil
+	}
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return false, nil
+	}
+
+	config.DbMutex.Lock()
+	result := tenancy.Scoped(config.DB, user.TenantID).Model(&model.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	config.DbMutex.Unlock()
+	if result.Error != nil {
+		return false, result.Error
+	}
+	user.TOTPLastStep = step
+	return result.RowsAffected == 1, nil
+}
+
+// verifyRecoveryCode 校验并消耗一个恢复码
+func verifyRecoveryCode(user *model.User, code string) (bool, error) {
+	config.DbMutex.Lock()
+	result := tenancy.Scoped(config.DB, user.TenantID).Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	config.DbMutex.Unlock()
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// verifySecondFactor 使用 TOTP 验证码或恢复码完成已启用用户的两步验证
+func verifySecondFactor(user *model.User, code string, recoveryCode string) error {
+	var ok bool
+	var err error
+	if recoveryCode != "" {
+		ok, err = verifyRecoveryCode(user, recoveryCode)
+	} else {
+		ok, err = verifyTOTP(user, code)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidSecondFactor
+	}
+	return nil
+}
+
+// completeEnrollment 使用验证码确认待启用的密钥，成功后启用两步验证并返回新的恢复码
+func completeEnrollment(user *model.User, code string) ([]string, error) {
+	ok, err := verifyTOTP(user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errInvalidSecondFactor
+	}
+
+	config.DbMutex.Lock()
+	err = tenancy.Scoped(config.DB, user.TenantID).Model(&model.User{}).Where("id = ?", user.ID).Update("totp_enabled", true).Error
+	config.DbMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+
+	return regenerateRecoveryCodes(user)
+}
+
+// regenerateRecoveryCodes 作废旧的恢复码并生成一组新的恢复码，明文只在此时返回一次
+func regenerateRecoveryCodes(user *model.User) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]model.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		rows[i] = model.RecoveryCode{TenantID: user.TenantID, UserID: user.ID, CodeHash: hashRecoveryCode(raw)}
+	}
+
+	db := tenancy.Scoped(config.DB, user.TenantID)
+	config.DbMutex.Lock()
+	defer config.DbMutex.Unlock()
+	if err := db.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadMFAUser 解析挑战令牌并读取对应的用户，只接受该用户最近签发且尚未使用的挑战令牌
+func loadMFAUser(mfaToken string) (model.User, error) {
+	var user model.User
+	claims, err := token.Parse(mfaToken, token.TypeMFA)
+	if err != nil {
+		return user, err
+	}
+	config.DbMutex.Lock()
+	err = tenancy.Scoped(config.DB, claims.TenantID).Where("id = ?", claims.UserID).First(&user).Error
+	config.DbMutex.Unlock()
+	if err == nil && (claims.ID == "" || user.MFAChallengeID != claims.ID) {
+		err = errMFAChallengeUsed
+	}
+	return user, err
+}
+
+// consumeMFAChallenge 清空用户的挑战令牌ID，以条件更新保证并发请求中只有一个能使用该令牌
+func consumeMFAChallenge(user model.User) error {
+	config.DbMutex.Lock()
+	result := tenancy.Scoped(config.DB, user.TenantID).Model(&model.User{}).
+		Where("id = ? AND mfa_challenge_id = ?", user.ID, user.MFAChallengeID).
+		Update("mfa_challenge_id", "")
+	config.DbMutex.Unlock()
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errMFAChallengeUsed
+	}
+	return nil
+}
+
+// LoginMFA 登录第二步：使用挑战令牌和 TOTP 验证码（或恢复码）换取访问令牌和刷新令牌
+// 对于被要求启用两步验证但尚未启用的用户，此步骤同时确认 LoginMFAEnroll 生成的密钥
+func LoginMFA(c *gin.Context) {
+	var mfaParams struct {
+		MFAToken     string `json:"mfaToken" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	if err := c.ShouldBindJSON(&mfaParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	user, err := loadMFAUser(mfaParams.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Invalid or expired MFA token"})
+		return
+	}
+	if rejectInactiveTenant(c, user.TenantID) {
+		return
+	}
+
+	tenantID := user.TenantID
+	if !guardLogin(c, tenantID, user.Username) {
+		return
+	}
+
+	var recoveryCodes []string
+	if user.TOTPEnabled {
+		err = verifySecondFactor(&user, mfaParams.Code, mfaParams.RecoveryCode)
+	} else {
+		recoveryCodes, err = completeEnrollment(&user, mfaParams.Code)
+	}
+	if err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "验证码错误"})
+			logger.Warn("MFA verification failed for user ", user.Username, " in tenant ", strconv.FormatUint(uint64(tenantID), 10), " from ", c.ClientIP())
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+			logger.Error(err.Error())
+		}
+		return
+	}
+
+	if err := consumeMFAChallenge(user); err != nil {
+		if errors.Is(err, errMFAChallengeUsed) {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Invalid or expired MFA token"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+			logger.Error(err.Error())
+		}
+		return
+	}
+
+	recordLoginSuccess(tenantID, user.Username)
+	data, err := issueTokens(user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+		logger.Error("Could not generate token: ", err.Error())
+		return
+	}
+	if recoveryCodes != nil {
+		data["recoveryCodes"] = recoveryCodes
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// LoginMFAEnroll 为被要求启用两步验证但尚未启用的用户在登录过程中生成密钥
+func LoginMFAEnroll(c *gin.Context) {
+	var mfaParams struct {
+		MFAToken string `json:"mfaToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&mfaParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	user, err := loadMFAUser(mfaParams.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Invalid or expired MFA token"})
+		return
+	}
+	if rejectInactiveTenant(c, user.TenantID) {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	data, err := startEnrollment(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+		logger.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+// EnrollMFA 为当前用户生成待确认的 TOTP 密钥
+func EnrollMFA(c *gin.Context) {
+	user, err := loadCurrentUser(c)
+	if err != nil {
+		respondCurrentUserError(c, err)
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(409, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	data, err := startEnrollment(&user)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, data)
+}
+
+// EnableMFA 使用验证码确认密钥并为当前用户启用两步验证
+func EnableMFA(c *gin.Context) {
+	var params struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := loadCurrentUser(c)
+	if err != nil {
+		respondCurrentUserError(c, err)
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(409, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	recoveryCodes, err := completeEnrollment(&user, params.Code)
+	if err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			c.JSON(400, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(200, gin.H{"recovery_codes": recoveryCodes})
+}
+
+// DisableMFA 关闭当前用户的两步验证，需要提供验证码或恢复码
+func DisableMFA(c *gin.Context) {
+	var params struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := loadCurrentUser(c)
+	if err != nil {
+		respondCurrentUserError(c, err)
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(409, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	required, err := adminMFARequired(user)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if required {
+		c.JSON(403, gin.H{"error": "Two-factor authentication is required for admins in this tenant"})
+		return
+	}
+
+	if err := verifySecondFactor(&user, params.Code, params.RecoveryCode); err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			c.JSON(400, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	config.DbMutex.Lock()
+	err = tenantDB(c).Model(&model.User{}).Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error
+	if err == nil {
+		err = tenantDB(c).Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error
+	}
+	config.DbMutex.Unlock()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes 重新生成当前用户的恢复码，需要提供验证码
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var params struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := loadCurrentUser(c)
+	if err != nil {
+		respondCurrentUserError(c, err)
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(409, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if err := verifySecondFactor(&user, params.Code, ""); err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			c.JSON(400, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	recoveryCodes, err := regenerateRecoveryCodes(&user)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"recovery_codes": recoveryCodes})
+}
+
+// GetTenantSettings 获取当前租户的安全设置
+func GetTenantSettings(c *gin.Context) {
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	setting, err := loadTenantSetting(tenantID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, setting)
+}
+
+// UpdateTenantSettings 更新当前租户的安全设置
+func UpdateTenantSettings(c *gin.Context) {
+	var params struct {
+		RequireAdminMFA *bool `json:"require_admin_mfa"`
+	}
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	setting, err := loadTenantSetting(tenantID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if params.RequireAdminMFA != nil {
+		setting.RequireAdminMFA = *params.RequireAdminMFA
+	}
+
+	config.DbMutex.Lock()
+	err = tenantDB(c).Save(&setting).Error
+	config.DbMutex.Unlock()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, setting)
+}
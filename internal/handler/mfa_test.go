@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/totp"
+	"github.com/gin-gonic/gin"
+)
+
+// mfaLogin 以密码登录并返回两步验证的挑战令牌
+func mfaLogin(t *testing.T, tenantID uint, username string) string {
+	t.Helper()
+	w := doRequest("POST", "/login?tenant_id="+uintString(tenantID), "", gin.H{"username": username, "password": "secret123"})
+	if w.Code != 200 {
+		t.Fatalf("login %s: %d %s", username, w.Code, w.Body.String())
+	}
+	data, _ := decode(t, w)["data"].(map[string]interface{})
+	mfaToken, _ := data["mfaToken"].(string)
+	if mfaToken == "" {
+		t.Fatalf("login %s: no mfaToken in %s", username, w.Body.String())
+	}
+	return mfaToken
+}
+
+func TestLoginMFAChallengeSingleUse(t *testing.T) {
+	tenantID := newTenant(t)
+	user := newUser(t, tenantID, "mfauser", "inspector")
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tenancy.Scoped(config.DB, tenantID).Model(&model.User{}).Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": true}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := totp.Step(time.Now())
+	code := func(step int64) string {
+		code, err := totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	// 重新登录后，之前的挑战令牌失效
+	replaced := mfaLogin(t, tenantID, "mfauser")
+	mfaToken := mfaLogin(t, tenantID, "mfauser")
+	if w := doRequest("POST", "/login/2fa", "", gin.H{"mfaToken": replaced, "code": code(step)}); w.Code != 401 {
+		t.Errorf("replaced challenge = %d %s, want 401", w.Code, w.Body.String())
+	}
+
+	if w := doRequest("POST", "/login/2fa", "", gin.H{"mfaToken": mfaToken, "code": code(step)}); w.Code != 200 {
+		t.Fatalf("first use of the challenge = %d %s, want 200", w.Code, w.Body.String())
+	}
+	// 下一个时间步的验证码本身有效，但挑战令牌已经用过
+	if w := doRequest("POST", "/login/2fa", "", gin.H{"mfaToken": mfaToken, "code": code(step + 1)}); w.Code != 401 {
+		t.Errorf("second use of the challenge = %d %s, want 401", w.Code, w.Body.String())
+	}
+}
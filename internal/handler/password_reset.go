@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/Slinet6056/road-patrol-backend/pkg/mailer"
+	"github.com/Slinet6056/road-patrol-backend/pkg/password"
+	"github.com/Slinet6056/road-patrol-backend/pkg/token"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// mailSender 用于发送密码重置等通知邮件
+var mailSender mailer.Mailer = &mailer.LogMailer{}
+
+// InitMailer 根据配置初始化邮件发送方式
+func InitMailer() {
+	mailSender = mailer.New(mailer.Config{
+		Driver:       config.MailDriver,
+		From:         config.MailFrom,
+		SMTPHost:     config.MailSMTPHost,
+		SMTPPort:     config.MailSMTPPort,
+		SMTPUsername: config.MailSMTPUsername,
+		SMTPPassword: config.MailSMTPPassword,
+		FileDir:      config.MailFileDir,
+	})
+}
+
+func hashResetToken(resetToken string) string {
+	sum := sha256.Sum256([]byte(resetToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// createResetToken 为用户生成新的重置令牌，并使该用户此前未使用的令牌失效
+func createResetToken(user model.User) (string, error) {
+	resetToken := token.NewID()
+	now := time.Now()
+
+	config.DbMutex.Lock()
+	defer config.DbMutex.Unlock()
+	err := tenancy.Scoped(config.DB, user.TenantID).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.PasswordResetToken{
+			TenantID:  user.TenantID,
+			UserID:    user.ID,
+			TokenHash: hashResetToken(resetToken),
+			ExpiresAt: now.Add(config.PasswordResetTTL),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return resetToken, nil
+}
+
+// resetMessage 生成密码重置邮件
+func resetMessage(user model.User, resetToken string) mailer.Message {
+	var body strings.Builder
+	body.WriteString(user.Username + "，您好：\n\n")
+	body.WriteString("我们收到了重置您账户密码的请求。")
+	if config.PasswordResetURL != "" {
+		body.WriteString("请打开以下链接设置新密码：\n\n")
+		body.WriteString(strings.ReplaceAll(config.PasswordResetURL, "{token}", resetToken) + "\n\n")
+	} else {
+		body.WriteString("请使用以下重置令牌设置新密码：\n\n")
+		body.WriteString(resetToken + "\n\n")
+	}
+	body.WriteString("该令牌在 " + config.PasswordResetTTL.String() + " 内有效且只能使用一次。如果这不是您本人的操作，请忽略此邮件。\n")
+	return mailer.Message{To: user.Email, Subject: "重置密码", Body: body.String()}
+}
+
+// ForgotPassword 为忘记密码的用户发送重置令牌
+// 查找用户、生成令牌和发送邮件都在响应之后异步进行，无论账户是否存在，响应的内容和时间都相同，避免被用于探测用户名
+func ForgotPassword(c *gin.Context) {
+	var forgotParams struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&forgotParams); err != nil || (forgotParams.Username == "" && forgotParams.Email == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "username or email is required"})
+		return
+	}
+
+	retryAfter, err := ipLimiter.Allow("password:ip:"+c.ClientIP(), time.Now())
+	if err != nil {
+		logger.Error("Password reset limiter error: ", err.Error())
+	} else if retryAfter > 0 {
+		rejectThrottled(c, retryAfter, "请求过于频繁，请稍后再试")
+		return
+	}
+
+	response := gin.H{"success": true, "message": "如果账户存在且设置了邮箱，重置邮件已发送"}
+	parsedTenantID, err := strconv.ParseUint(c.Query("tenant_id"), 10, 32)
+	if err == nil {
+		go sendResetMails(uint(parsedTenantID), forgotParams.Username, forgotParams.Email)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// sendResetMails 向匹配的用户发送重置邮件，按用户名查找时最多匹配一个用户
+// 邮箱不唯一，按邮箱查找时向使用该邮箱的每个用户分别发送各自的令牌
+func sendResetMails(tenantID uint, username string, email string) {
+	var users []model.User
+	query := tenancy.Scoped(config.DB, tenantID)
+	if username != "" {
+		query = query.Where("username = ?", username).Limit(1)
+	} else {
+		query = query.Where("email = ?", email)
+	}
+	config.DbMutex.Lock()
+	err := query.Find(&users).Error
+	config.DbMutex.Unlock()
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	for _, user := range users {
+		if user.Email == "" {
+			logger.Warn("Password reset requested for user ", user.Username, " in tenant ", strconv.FormatUint(uint64(tenantID), 10), " without an email address")
+			continue
+		}
+		resetToken, err := createResetToken(user)
+		if err != nil {
+			logger.Error("Could not create reset token: ", err.Error())
+			continue
+		}
+		if err := mailSender.Send(resetMessage(user, resetToken)); err != nil {
+			logger.Error("Could not send password reset mail: ", err.Error())
+		}
+	}
+}
+
+// loadResetToken 查找未使用且未过期的重置令牌及其所属的用户
+func loadResetToken(resetToken string) (model.PasswordResetToken, model.User, error) {
+	var record model.PasswordResetToken
+	var user model.User
+
+	config.DbMutex.Lock()
+	defer config.DbMutex.Unlock()
+	// 请求中没有租户信息，令牌哈希全局唯一，按哈希查找时不限定租户
+	err := tenancy.AllTenants(config.DB).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashResetToken(resetToken), time.Now()).First(&record).Error
+	if err == nil {
+		err = tenancy.Scoped(config.DB, record.TenantID).Where("id = ?", record.UserID).First(&user).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = errInvalidResetToken
+	}
+	return record, user, err
+}
+
+// applyPasswordReset 将重置令牌标记为已使用并更新密码
+// 以条件更新保证并发请求中只有一个能使用该令牌
+func applyPasswordReset(record model.PasswordResetToken, hashed string) error {
+	config.DbMutex.Lock()
+	defer config.DbMutex.Unlock()
+	return tenancy.Scoped(config.DB, record.TenantID).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", record.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+		return tx.Model(&model.User{}).Where("id = ?", record.UserID).Update("password", hashed).Error
+	})
+}
+
+// ResetPassword 使用重置令牌设置新密码，成功后吊销该用户的全部会话并解除登录锁定
+func ResetPassword(c *gin.Context) {
+	var resetParams struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&resetParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	record, user, err := loadResetToken(resetParams.Token)
+	if err == nil {
+		if err := password.Validate(resetParams.NewPassword, user.Username); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+		var hashed string
+		if hashed, err = password.Hash(resetParams.NewPassword); err == nil {
+			err = applyPasswordReset(record, hashed)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, errInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+			logger.Warn("Invalid password reset token from ", c.ClientIP())
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+			logger.Error(err.Error())
+		}
+		return
+	}
+
+	tenantID := strconv.FormatUint(uint64(user.TenantID), 10)
+	if err := revokeUserSessions(user.TenantID, user.ID, ""); err != nil {
+		logger.Error("Could not revoke sessions: ", err.Error())
+	}
+	recordLoginSuccess(user.TenantID, user.Username)
+	logger.Info("Password reset for user ", user.Username, " in tenant ", tenantID)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "密码已重置"})
+}
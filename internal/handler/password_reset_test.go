@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/mailer"
+	"github.com/gin-gonic/gin"
+)
+
+// fakeMailer 将发送的邮件放入通道，供测试读取
+type fakeMailer struct {
+	sent chan mailer.Message
+}
+
+func (m *fakeMailer) Send(msg mailer.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+// useFakeMailer 在测试期间以 fakeMailer 替换邮件发送
+func useFakeMailer(t *testing.T) *fakeMailer {
+	t.Helper()
+	fake := &fakeMailer{sent: make(chan mailer.Message, 10)}
+	previous := mailSender
+	mailSender = fake
+	t.Cleanup(func() { mailSender = previous })
+	return fake
+}
+
+// requestReset 请求重置密码并从邮件中取出重置令牌，邮件在响应之后异步发送
+func requestReset(t *testing.T, fake *fakeMailer, tenantID uint, username string) string {
+	t.Helper()
+	w := doRequest("POST", "/password/forgot?tenant_id="+uintString(tenantID), "", gin.H{"username": username})
+	if w.Code != 200 {
+		t.Fatalf("POST /password/forgot: %d %s", w.Code, w.Body.String())
+	}
+	select {
+	case msg := <-fake.sent:
+		if msg.To != username+"@example.com" {
+			t.Errorf("reset mail sent to %q, want %s@example.com", msg.To, username)
+		}
+		// 没有配置 password_reset.url 时令牌单独成行，位于提示语之后
+		lines := strings.Split(msg.Body, "\n")
+		for i, line := range lines {
+			if strings.Contains(line, "重置令牌") && i+2 < len(lines) {
+				return lines[i+2]
+			}
+		}
+		t.Fatalf("no reset token in mail: %s", msg.Body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reset mail sent")
+	}
+	return ""
+}
+
+func resetPassword(resetToken string, newPassword string) int {
+	return doRequest("POST", "/password/reset", "", gin.H{"token": resetToken, "new_password": newPassword}).Code
+}
+
+func TestPasswordReset(t *testing.T) {
+	fake := useFakeMailer(t)
+	tenantID := newTenant(t)
+	newUser(t, tenantID, "forgetful", "inspector")
+
+	resetToken := requestReset(t, fake, tenantID, "forgetful")
+	if code := resetPassword(resetToken, "Reset-Password-2024"); code != 200 {
+		t.Fatalf("reset with a fresh token = %d, want 200", code)
+	}
+	w := doRequest("POST", "/login?tenant_id="+uintString(tenantID), "", gin.H{"username": "forgetful", "password": "Reset-Password-2024"})
+	if w.Code != 200 {
+		t.Errorf("login with the new password = %d %s, want 200", w.Code, w.Body.String())
+	}
+
+	if code := resetPassword(resetToken, "Another-Password-2024"); code != 400 {
+		t.Errorf("reusing a reset token = %d, want 400", code)
+	}
+
+	// 新令牌使此前未使用的令牌失效
+	first := requestReset(t, fake, tenantID, "forgetful")
+	second := requestReset(t, fake, tenantID, "forgetful")
+	if code := resetPassword(first, "Another-Password-2024"); code != 400 {
+		t.Errorf("reset with a superseded token = %d, want 400", code)
+	}
+
+	// 过期的令牌不能使用
+	err := tenancy.Scoped(config.DB, tenantID).Model(&model.PasswordResetToken{}).
+		Where("token_hash = ?", hashResetToken(second)).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := resetPassword(second, "Another-Password-2024"); code != 400 {
+		t.Errorf("reset with an expired token = %d, want 400", code)
+	}
+
+	if code := resetPassword("not-a-token", "Another-Password-2024"); code != 400 {
+		t.Errorf("reset with an unknown token = %d, want 400", code)
+	}
+}
+
+func TestPasswordResetUnknownUser(t *testing.T) {
+	fake := useFakeMailer(t)
+	tenantID := newTenant(t)
+
+	w := doRequest("POST", "/password/forgot?tenant_id="+uintString(tenantID), "", gin.H{"username": "nobody"})
+	if w.Code != 200 {
+		t.Fatalf("POST /password/forgot for an unknown user = %d, want 200", w.Code)
+	}
+	select {
+	case msg := <-fake.sent:
+		t.Errorf("mail sent for an unknown user: %+v", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
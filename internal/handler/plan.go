@@ -7,17 +7,37 @@ import (
 
 	"github.com/Slinet6056/road-patrol-backend/internal/config"
 	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/rbac"
+	"github.com/Slinet6056/road-patrol-backend/pkg/middleware"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+var (
+	errPlanNotOwned      = errors.New("plan is not assigned to the current user")
+	errPlanNotFound      = errors.New("no plan found with given ID")
+	errInspectorNotFound = errors.New("no user found with given inspector ID")
+)
+
+// ownsPlan 判断巡检任务是否分配给了指定用户
+func ownsPlan(db *gorm.DB, planID uint, userID uint) (bool, error) {
+	var count int64
+	config.DbMutex.Lock()
+	err := db.Model(&model.Plan{}).Where("id = ? AND inspector_id = ?", planID, userID).Count(&count).Error
+	config.DbMutex.Unlock()
+	return count > 0, err
+}
+
 type PlanDetail struct {
 	model.Plan
-	RoadIDs []uint `json:"road_ids"`
+	RoadIDs    []uint `json:"road_ids"`
+	SegmentIDs []uint `json:"segment_ids"`
 }
 
+// PlanDetailJSON 为巡检任务的请求格式，修改任务时不提供 road_ids 或 segment_ids 则保留原有的道路或路段
 type PlanDetailJSON struct {
 	RoadIDs     []uint `json:"road_ids"`
+	SegmentIDs  []uint `json:"segment_ids"`
 	InspectorID uint   `json:"inspector_id"`
 	Date        string `json:"date"`
 	Status      string `json:"status"`
@@ -39,23 +59,54 @@ func (p *PlanDetailJSON) ToPlanDetail() (PlanDetail, error) {
 			Date:        date,
 			Status:      p.Status,
 		},
-		RoadIDs: p.RoadIDs,
+		RoadIDs:    p.RoadIDs,
+		SegmentIDs: p.SegmentIDs,
 	}, nil
 }
 
-// GetPlans 获取所有巡检任务及其关联的道路ID
+// planListSpec 为 GetPlans 允许的筛选参数和排序字段
+var planListSpec = listSpec[model.Plan]{
+	filters: map[string]listFilter{
+		"status":       equalFilter("status", parseString),
+		"inspector_id": equalFilter("inspector_id", parseID),
+		"date_from":    dateFilter("date", false),
+		"date_to":      dateFilter("date", true),
+	},
+	sorts: map[string]listSort[model.Plan]{
+		"id":           {"id", func(p *model.Plan) interface{} { return p.ID }},
+		"date":         {"date", func(p *model.Plan) interface{} { return p.Date }},
+		"status":       {"status", func(p *model.Plan) interface{} { return p.Status }},
+		"inspector_id": {"inspector_id", func(p *model.Plan) interface{} { return p.InspectorID }},
+	},
+	defaultSort: "id",
+	id:          func(p *model.Plan) uint { return p.ID },
+}
+
+// GetPlans 分页获取巡检任务及其关联的道路ID和路段ID
+// zone_id 参数只返回涉及该区域及其下级区域内道路或路段的任务
 func GetPlans(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
+	list, ok := parseListQuery(c, &planListSpec)
+	if !ok {
+		return
+	}
+	zoneIDs, ok := zoneFilter(c, db)
+	if !ok {
+		return
+	}
+	query := db
+	if zoneIDs != nil {
+		query = db.Where("id IN (?)", zonePlanIDs(db, zoneIDs))
+	}
 
-	planDetailChan := make(chan []PlanDetail)
+	pageChan := make(chan ListPage)
 	errChan := make(chan error)
 
 	go func() {
 		var plans []model.Plan
-		var planDetails []PlanDetail
 
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ?", tenantID).Find(&plans)
+		result := list.apply(query).Find(&plans)
 		config.DbMutex.Unlock()
 
 		if result.Error != nil {
@@ -63,52 +114,74 @@ func GetPlans(c *gin.Context) {
 			return
 		}
 
+		plans, next := list.page(plans)
+		planDetails := make([]PlanDetail, 0, len(plans))
 		for _, plan := range plans {
-			var roadIDs []uint
+			var roadIDs, segmentIDs []uint
 			config.DbMutex.Lock()
-			config.DB.Where("tenant_id = ?", tenantID).Model(&model.PlanRoad{}).Where("plan_id = ?", plan.ID).Pluck("road_id", &roadIDs)
+			db.Model(&model.PlanRoad{}).Where("plan_id = ?", plan.ID).Pluck("road_id", &roadIDs)
+			db.Model(&model.PlanSegment{}).Where("plan_id = ?", plan.ID).Pluck("segment_id", &segmentIDs)
 			config.DbMutex.Unlock()
 
-			planDetails = append(planDetails, PlanDetail{Plan: plan, RoadIDs: roadIDs})
+			planDetails = append(planDetails, PlanDetail{Plan: plan, RoadIDs: roadIDs, SegmentIDs: segmentIDs})
 		}
 
-		planDetailChan <- planDetails
+		pageChan <- ListPage{Data: planDetails, NextCursor: next}
 	}()
 
 	select {
-	case planDetails := <-planDetailChan:
-		if len(planDetails) == 0 {
-			c.JSON(200, []PlanDetail{})
-		} else {
-			c.JSON(200, planDetails)
-		}
+	case page := <-pageChan:
+		c.JSON(200, page)
 	case err := <-errChan:
 		c.JSON(500, gin.H{"error": err.Error()})
 	}
 }
 
-// AddPlan 添加新的巡检任务及其关联的道路
+// AddPlan 添加新的巡检任务及其关联的道路和路段
 func AddPlan(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
 	var planDetailJSON PlanDetailJSON
 	if err := c.ShouldBindJSON(&planDetailJSON); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	parsedTenantID, _ := strconv.ParseUint(tenantID, 10, 64)
 	planDetail, err := planDetailJSON.ToPlanDetail()
 	if err != nil {
 		c.JSON(400, gin.H{"error": "Invalid date format"})
 		return
 	}
-	planDetail.TenantID = uint(parsedTenantID)
+
+	// 没有指定巡检员时任务分配给当前用户，没有 plan:manage_all 权限的用户只能创建分配给自己的任务
+	userID := middleware.GetUserID(c)
+	if planDetail.InspectorID == 0 {
+		planDetail.InspectorID = userID
+	} else if planDetail.InspectorID != userID && !middleware.HasPermission(c, rbac.PlanManageAll) {
+		c.JSON(403, gin.H{"error": errPlanNotOwned.Error()})
+		return
+	}
 
 	plans := make(chan model.Plan)
 	errChan := make(chan error)
 
 	go func() {
 		config.DbMutex.Lock()
-		result := config.DB.Create(&planDetail.Plan)
+		if err := checkPlanReferences(db, &planDetail); err != nil {
+			config.DbMutex.Unlock()
+			errChan <- err
+			return
+		}
+		if planIsActive(planDetail.Status) {
+			if err := checkQuota(db, tenantID, quotaActivePlans, 1); err != nil {
+				config.DbMutex.Unlock()
+				errChan <- err
+				return
+			}
+		}
+		result := db.Create(&planDetail.Plan)
 		config.DbMutex.Unlock()
 		if result.Error != nil {
 			errChan <- result.Error
@@ -117,7 +190,12 @@ func AddPlan(c *gin.Context) {
 
 		for _, roadID := range planDetail.RoadIDs {
 			config.DbMutex.Lock()
-			config.DB.Create(&model.PlanRoad{TenantID: planDetail.TenantID, PlanID: planDetail.ID, RoadID: roadID})
+			db.Create(&model.PlanRoad{PlanID: planDetail.ID, RoadID: roadID})
+			config.DbMutex.Unlock()
+		}
+		for _, segmentID := range planDetail.SegmentIDs {
+			config.DbMutex.Lock()
+			db.Create(&model.PlanSegment{PlanID: planDetail.ID, SegmentID: segmentID})
 			config.DbMutex.Unlock()
 		}
 
@@ -128,26 +206,46 @@ func AddPlan(c *gin.Context) {
 	case createdPlan := <-plans:
 		c.JSON(201, createdPlan)
 	case err := <-errChan:
-		c.JSON(500, gin.H{"error": err.Error()})
+		if isPlanReferenceError(err) {
+			c.JSON(400, gin.H{"error": err.Error()})
+		} else if !respondQuotaExceeded(c, err) {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
 	}
 }
 
-// UpdatePlan 更新巡检任务及其关联的道路
+// UpdatePlan 更新巡检任务及其关联的道路和路段
 func UpdatePlan(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
 	var planDetailJSON PlanDetailJSON
 	id := c.Param("id")
 	if err := c.ShouldBindJSON(&planDetailJSON); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	parsedTenantID, _ := strconv.ParseUint(tenantID, 10, 64)
 	planDetail, err := planDetailJSON.ToPlanDetail()
 	if err != nil {
 		c.JSON(400, gin.H{"error": "Invalid date format"})
 		return
 	}
-	planDetail.TenantID = uint(parsedTenantID)
+
+	// 将 id 从 string 转换为 uint
+	parsedID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	manageAll := middleware.HasPermission(c, rbac.PlanManageAll)
+	userID := middleware.GetUserID(c)
+	if !manageAll && planDetail.InspectorID != 0 && planDetail.InspectorID != userID {
+		c.JSON(403, gin.H{"error": errPlanNotOwned.Error()})
+		return
+	}
 
 	planChan := make(chan model.Plan)
 	errChan := make(chan error)
@@ -155,34 +253,51 @@ func UpdatePlan(c *gin.Context) {
 	go func() {
 		var existingPlan model.Plan
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&existingPlan)
+		result := db.Where("id = ?", id).First(&existingPlan)
 		config.DbMutex.Unlock()
 		if result.Error != nil {
 			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-				errChan <- errors.New("no plan found with given ID")
+				errChan <- errPlanNotFound
 			} else {
 				errChan <- result.Error
 			}
 			return
 		}
+		if !manageAll && existingPlan.InspectorID != userID {
+			errChan <- errPlanNotOwned
+			return
+		}
 
-		// 更新 Plan 表
+		// 更新 Plan 表，重新打开已结束的任务时同样受活动任务配额限制
 		config.DbMutex.Lock()
-		result = config.DB.Where("tenant_id = ?", tenantID).Model(&model.Plan{}).Where("id = ?", id).Updates(planDetail.Plan)
-		config.DbMutex.Unlock()
-
-		// 将 id 从 string 转换为 uint
-		parsedID, err := strconv.ParseUint(id, 10, 64)
-		if err != nil {
-			c.JSON(400, gin.H{"error": "Invalid ID format"})
+		if err := checkPlanReferences(db, &planDetail); err != nil {
+			config.DbMutex.Unlock()
+			errChan <- err
 			return
 		}
+		if planDetail.Status != "" && !planIsActive(existingPlan.Status) && planIsActive(planDetail.Status) {
+			if err := checkQuota(db, tenantID, quotaActivePlans, 1); err != nil {
+				config.DbMutex.Unlock()
+				errChan <- err
+				return
+			}
+		}
+		result = db.Model(&model.Plan{}).Where("id = ?", id).Updates(planDetail.Plan)
+		config.DbMutex.Unlock()
 
-		// 更新 PlanRoad 表
+		// 更新 PlanRoad 和 PlanSegment 表，未提供 road_ids 或 segment_ids 时保留原有关联，提供空数组时清空
 		config.DbMutex.Lock()
-		config.DB.Where("plan_id = ? AND tenant_id = ?", id, tenantID).Delete(&model.PlanRoad{})
-		for _, roadID := range planDetail.RoadIDs {
-			config.DB.Create(&model.PlanRoad{TenantID: planDetail.TenantID, PlanID: uint(parsedID), RoadID: roadID})
+		if planDetail.RoadIDs != nil {
+			db.Where("plan_id = ?", id).Delete(&model.PlanRoad{})
+			for _, roadID := range planDetail.RoadIDs {
+				db.Create(&model.PlanRoad{PlanID: uint(parsedID), RoadID: roadID})
+			}
+		}
+		if planDetail.SegmentIDs != nil {
+			db.Where("plan_id = ?", id).Delete(&model.PlanSegment{})
+			for _, segmentID := range planDetail.SegmentIDs {
+				db.Create(&model.PlanSegment{PlanID: uint(parsedID), SegmentID: segmentID})
+			}
 		}
 		config.DbMutex.Unlock()
 
@@ -195,7 +310,7 @@ func UpdatePlan(c *gin.Context) {
 		} else {
 			var updatedPlan model.Plan
 			config.DbMutex.Lock()
-			config.DB.Where("id = ?", id).First(&updatedPlan)
+			db.Where("id = ?", id).First(&updatedPlan)
 			config.DbMutex.Unlock()
 			planChan <- updatedPlan
 		}
@@ -209,35 +324,131 @@ func UpdatePlan(c *gin.Context) {
 			c.JSON(200, plan)
 		}
 	case err := <-errChan:
-		if err.Error() == "no plan found with given ID" {
+		if errors.Is(err, errPlanNotFound) {
 			c.JSON(404, gin.H{"error": err.Error()})
-		} else {
+		} else if errors.Is(err, errPlanNotOwned) {
+			c.JSON(403, gin.H{"error": err.Error()})
+		} else if isPlanReferenceError(err) {
+			c.JSON(400, gin.H{"error": err.Error()})
+		} else if !respondQuotaExceeded(c, err) {
 			c.JSON(500, gin.H{"error": err.Error()})
 		}
 	}
 }
 
-// DeletePlan 删除巡检任务及其关联的道路
+// DeletePlan 删除巡检任务及其关联的道路和路段
+// 任务仍有报告时返回 409 和这些报告的ID，除非指定以下参数之一：
+// cascade=true 同时删除这些报告；reassign_to 为另一个任务的ID时，这些报告移到该任务下
 func DeletePlan(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
 	id := c.Param("id")
+	options, ok := parseDeleteOptions(c)
+	if !ok {
+		return
+	}
+
+	manageAll := middleware.HasPermission(c, rbac.PlanManageAll)
+	userID := middleware.GetUserID(c)
 
 	resultChan := make(chan error)
+	blockedChan := make(chan dependents)
 
 	go func() {
 		config.DbMutex.Lock()
-		// 先删除 PlanRoad 表中的关联数据
-		config.DB.Where("plan_id = ? AND tenant_id = ?", id, tenantID).Delete(&model.PlanRoad{})
-		// 再删除 Plan 表中的数据
-		result := config.DB.Where("tenant_id = ?", tenantID).Delete(&model.Plan{}, id)
-		config.DbMutex.Unlock()
-		resultChan <- result.Error
+		defer config.DbMutex.Unlock()
+		var blocked dependents
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var plan model.Plan
+			if err := tx.Where("id = ?", id).Limit(1).Find(&plan).Error; err != nil {
+				return err
+			}
+			if plan.ID == 0 {
+				return nil
+			}
+			if !manageAll && plan.InspectorID != userID {
+				return errPlanNotOwned
+			}
+			var reportIDs []uint
+			if err := tx.Model(&model.Report{}).Where("plan_id = ?", plan.ID).Order("id").Pluck("id", &reportIDs).Error; err != nil {
+				return err
+			}
+			deps := dependents{"reports": reportIDs}
+			if options.blocks(deps) {
+				blocked = deps
+				return nil
+			}
+			if options.reassignTo != 0 {
+				var target model.Plan
+				if err := tx.Where("id = ?", options.reassignTo).Limit(1).Find(&target).Error; err != nil {
+					return err
+				}
+				if target.ID == 0 || target.ID == plan.ID {
+					return errReassignTarget
+				}
+				// 没有 plan:manage_all 权限的用户只能把报告移到分配给自己的任务
+				if !manageAll && target.InspectorID != userID {
+					return errPlanNotOwned
+				}
+				if err := tx.Model(&model.Report{}).Where("plan_id = ?", plan.ID).Update("plan_id", target.ID).Error; err != nil {
+					return err
+				}
+			}
+			return deletePlans(tx, []uint{plan.ID})
+		})
+		if err == nil && blocked != nil {
+			blockedChan <- blocked
+			return
+		}
+		resultChan <- err
 	}()
 
-	if err := <-resultChan; err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+	select {
+	case deps := <-blockedChan:
+		respondDependents(c, "plan still has reports", deps)
+	case err := <-resultChan:
+		if errors.Is(err, errPlanNotOwned) {
+			c.JSON(403, gin.H{"error": err.Error()})
+		} else if errors.Is(err, errReassignTarget) {
+			c.JSON(400, gin.H{"error": err.Error()})
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(200, gin.H{"message": "Plan deleted"})
+		}
+	}
+}
+
+// checkPlanReferences 检查任务的巡检员、道路和路段是否存在，巡检员为 0 表示不修改，调用方需持有 config.DbMutex
+func checkPlanReferences(db *gorm.DB, planDetail *PlanDetail) error {
+	if planDetail.InspectorID != 0 {
+		if err := checkRecordsExist(db, &model.User{}, []uint{planDetail.InspectorID}, errInspectorNotFound); err != nil {
+			return err
+		}
+	}
+	if err := checkRecordsExist(db, &model.Road{}, planDetail.RoadIDs, errRoadNotFound); err != nil {
+		return err
 	}
+	return checkSegmentsExist(db, planDetail.SegmentIDs)
+}
+
+// isPlanReferenceError 判断错误是否为任务引用了不存在的巡检员、道路或路段
+func isPlanReferenceError(err error) bool {
+	return errors.Is(err, errInspectorNotFound) || errors.Is(err, errRoadNotFound) || errors.Is(err, errSegmentNotFound)
+}
 
-	c.JSON(200, gin.H{"message": "Plan deleted"})
+// deletePlans 删除巡检任务及其关联的道路、路段、报告和报告检查的设施记录，调用方需持有 config.DbMutex
+func deletePlans(db *gorm.DB, planIDs []uint) error {
+	if len(planIDs) == 0 {
+		return nil
+	}
+	reportIDs := db.Model(&model.Report{}).Select("id").Where("plan_id IN ?", planIDs)
+	if err := db.Where("report_id IN (?)", reportIDs).Delete(&model.ReportAsset{}).Error; err != nil {
+		return err
+	}
+	for _, table := range []interface{}{&model.Report{}, &model.PlanRoad{}, &model.PlanSegment{}} {
+		if err := db.Where("plan_id IN ?", planIDs).Delete(table).Error; err != nil {
+			return err
+		}
+	}
+	return db.Where("id IN ?", planIDs).Delete(&model.Plan{}).Error
 }
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/gin-gonic/gin"
+)
+
+// createdID 返回创建接口响应中的 id
+func createdID(t *testing.T, method string, path string, accessToken string, body interface{}) uint {
+	t.Helper()
+	w := doRequest(method, path, accessToken, body)
+	if w.Code != 200 && w.Code != 201 {
+		t.Fatalf("%s %s: %d %s", method, path, w.Code, w.Body.String())
+	}
+	id, _ := decode(t, w)["id"].(float64)
+	if id == 0 {
+		t.Fatalf("%s %s: no id in %s", method, path, w.Body.String())
+	}
+	return uint(id)
+}
+
+func TestUpdatePlanRoads(t *testing.T) {
+	tenantID := newTenant(t)
+	newUser(t, tenantID, "admin", "admin")
+	accessToken, _ := login(t, tenantID, "admin")
+
+	road1 := createdID(t, "POST", "/road", accessToken, gin.H{"name": "road 1"})
+	road2 := createdID(t, "POST", "/road", accessToken, gin.H{"name": "road 2"})
+	planID := createdID(t, "POST", "/plan", accessToken, gin.H{"status": "pending", "road_ids": []uint{road1, road2}})
+	path := "/plan/" + uintString(planID)
+
+	planRoads := func() int64 {
+		var count int64
+		if err := tenancy.Scoped(config.DB, tenantID).Model(&model.PlanRoad{}).Where("plan_id = ?", planID).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	tests := []struct {
+		name string
+		body gin.H
+		want int64
+	}{
+		{"omitted road_ids keep the roads", gin.H{"status": "in_progress"}, 2},
+		{"null road_ids keep the roads", gin.H{"road_ids": nil}, 2},
+		{"road_ids replace the roads", gin.H{"road_ids": []uint{road2}}, 1},
+		{"empty road_ids clear the roads", gin.H{"road_ids": []uint{}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doRequest("PUT", path, accessToken, tt.body); w.Code != 200 {
+				t.Fatalf("PUT %s: %d %s", path, w.Code, w.Body.String())
+			}
+			if got := planRoads(); got != tt.want {
+				t.Errorf("plan has %d roads, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddReportPlan(t *testing.T) {
+	tenantID := newTenant(t)
+	newUser(t, tenantID, "admin", "admin")
+	newUser(t, tenantID, "inspector", "inspector")
+	adminToken, _ := login(t, tenantID, "admin")
+	inspectorToken, _ := login(t, tenantID, "inspector")
+
+	adminPlan := createdID(t, "POST", "/plan", adminToken, gin.H{"status": "pending"})
+	ownPlan := createdID(t, "POST", "/plan", inspectorToken, gin.H{"status": "pending"})
+
+	tests := []struct {
+		name   string
+		planID uint
+		want   int
+	}{
+		{"missing plan", 999999, 404},
+		{"plan of another inspector", adminPlan, 403},
+		{"own plan", ownPlan, 201},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest("POST", "/report", inspectorToken, gin.H{"plan_id": tt.planID, "content": "pothole"})
+			if w.Code != tt.want {
+				t.Errorf("POST /report for plan %d = %d %s, want %d", tt.planID, w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/Slinet6056/road-patrol-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 配额限制的资源类型
+const (
+	quotaUsers       = "users"
+	quotaRoads       = "roads"
+	quotaActivePlans = "active_plans"
+)
+
+// quotaResources 为用量报告中资源的展示顺序
+var quotaResources = []string{quotaUsers, quotaRoads, quotaActivePlans}
+
+// QuotaExceededError 表示新增资源会超出租户配额
+type QuotaExceededError struct {
+	Resource string
+	Limit    int64
+	Used     int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded (%d/%d)", e.Resource, e.Used, e.Limit)
+}
+
+// QuotaUsage 表示一项资源的用量和配额，Limit 为 0 表示不限制
+type QuotaUsage struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit"`
+}
+
+// TenantQuotaJSON 定义修改租户配额时的请求参数，未传入的字段保持不变
+type TenantQuotaJSON struct {
+	MaxUsers       *int `json:"max_users" binding:"omitempty,min=0"`
+	MaxRoads       *int `json:"max_roads" binding:"omitempty,min=0"`
+	MaxActivePlans *int `json:"max_active_plans" binding:"omitempty,min=0"`
+}
+
+// quotaLimit 返回租户对某项资源的配额
+func quotaLimit(tenant model.Tenant, resource string) int64 {
+	switch resource {
+	case quotaUsers:
+		return int64(tenant.MaxUsers)
+	case quotaRoads:
+		return int64(tenant.MaxRoads)
+	case quotaActivePlans:
+		return int64(tenant.MaxActivePlans)
+	}
+	return 0
+}
+
+// activePlans 在查询中排除已结束的巡检任务
+func activePlans(db *gorm.DB) *gorm.DB {
+	db = db.Model(&model.Plan{})
+	if len(config.QuotaClosedPlanStatuses) > 0 {
+		db = db.Where("status NOT IN ?", config.QuotaClosedPlanStatuses)
+	}
+	return db
+}
+
+// planIsActive 判断处于某个状态的巡检任务是否计入活动任务配额
+func planIsActive(status string) bool {
+	for _, closed := range config.QuotaClosedPlanStatuses {
+		if status == closed {
+			return false
+		}
+	}
+	return true
+}
+
+// quotaUsed 统计租户对某项资源的当前用量，db 须为限定在该租户内的会话
+func quotaUsed(db *gorm.DB, resource string) (int64, error) {
+	var count int64
+	var err error
+	switch resource {
+	case quotaUsers:
+		err = db.Model(&model.User{}).Count(&count).Error
+	case quotaRoads:
+		err = db.Model(&model.Road{}).Count(&count).Error
+	case quotaActivePlans:
+		err = activePlans(db).Count(&count).Error
+	}
+	return count, err
+}
+
+// loadTenantQuota 读取租户的配额，平台租户等没有租户记录的情况视为不限制
+func loadTenantQuota(tenantID uint) (model.Tenant, error) {
+	var tenant model.Tenant
+	err := config.DB.Where("id = ?", tenantID).First(&tenant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.Tenant{ID: tenantID}, nil
+	}
+	return tenant, err
+}
+
+// checkQuota 检查租户新增 adding 个单位的资源后是否超出配额，超出时返回 *QuotaExceededError。
+// 调用方需持有 config.DbMutex，并在释放前完成创建，避免并发请求同时通过检查
+func checkQuota(db *gorm.DB, tenantID uint, resource string, adding int64) error {
+	tenant, err := loadTenantQuota(tenantID)
+	if err != nil {
+		return err
+	}
+	limit := quotaLimit(tenant, resource)
+	if limit <= 0 {
+		return nil
+	}
+	used, err := quotaUsed(db, resource)
+	if err != nil {
+		return err
+	}
+	if used+adding > limit {
+		return &QuotaExceededError{Resource: resource, Limit: limit, Used: used}
+	}
+	return nil
+}
+
+// respondQuotaExceeded 在 err 为配额超限错误时返回 409 和错误码 quota_exceeded
+func respondQuotaExceeded(c *gin.Context, err error) bool {
+	var quotaErr *QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	c.JSON(409, gin.H{
+		"error":    err.Error(),
+		"code":     "quota_exceeded",
+		"resource": quotaErr.Resource,
+		"limit":    quotaErr.Limit,
+		"used":     quotaErr.Used,
+	})
+	return true
+}
+
+// GetTenantUsage 获取当前租户各项资源的用量和配额
+func GetTenantUsage(c *gin.Context) {
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+
+	usageChan := make(chan map[string]QuotaUsage)
+	errChan := make(chan error)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		tenant, err := loadTenantQuota(tenantID)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		usage := make(map[string]QuotaUsage, len(quotaResources))
+		for _, resource := range quotaResources {
+			used, err := quotaUsed(db, resource)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			usage[resource] = QuotaUsage{Used: used, Limit: quotaLimit(tenant, resource)}
+		}
+		usageChan <- usage
+	}()
+
+	select {
+	case usage := <-usageChan:
+		c.JSON(200, usage)
+	case err := <-errChan:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// UpdateTenantQuota 修改租户的配额，调低配额不会影响已有数据，只限制之后的新增
+func UpdateTenantQuota(c *gin.Context) {
+	var quotaJSON TenantQuotaJSON
+	if err := c.ShouldBindJSON(&quotaJSON); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant, err := updateTenant(c.Param("id"), func(tx *gorm.DB, tenant *model.Tenant) error {
+		if quotaJSON.MaxUsers != nil {
+			tenant.MaxUsers = *quotaJSON.MaxUsers
+		}
+		if quotaJSON.MaxRoads != nil {
+			tenant.MaxRoads = *quotaJSON.MaxRoads
+		}
+		if quotaJSON.MaxActivePlans != nil {
+			tenant.MaxActivePlans = *quotaJSON.MaxActivePlans
+		}
+		return tx.Model(tenant).Updates(map[string]interface{}{
+			"max_users":        tenant.MaxUsers,
+			"max_roads":        tenant.MaxRoads,
+			"max_active_plans": tenant.MaxActivePlans,
+		}).Error
+	})
+	if err == nil {
+		logger.Info("Quota of tenant ", strconv.FormatUint(uint64(tenant.ID), 10), " updated by user ", middleware.GetUsername(c))
+	}
+	respondTenant(c, tenant, err)
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+func TestQuotaExceeded(t *testing.T) {
+	tenantID := newTenant(t, func(tenant *model.Tenant) {
+		tenant.MaxUsers, tenant.MaxRoads, tenant.MaxActivePlans = 2, 1, 1
+	})
+	newUser(t, tenantID, "admin", "admin")
+	accessToken, _ := login(t, tenantID, "admin")
+
+	tests := []struct {
+		resource string
+		path     string
+		first    gin.H
+		second   gin.H
+	}{
+		{"users", "/user",
+			gin.H{"username": "inspector1", "password": "Quota-Test-2024", "role": "inspector"},
+			gin.H{"username": "inspector2", "password": "Quota-Test-2024", "role": "inspector"}},
+		{"roads", "/road", gin.H{"name": "first road"}, gin.H{"name": "second road"}},
+		{"active_plans", "/plan", gin.H{"status": "pending"}, gin.H{"status": "pending"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resource, func(t *testing.T) {
+			if w := doRequest("POST", tt.path, accessToken, tt.first); w.Code != 200 && w.Code != 201 {
+				t.Fatalf("first POST %s: %d %s", tt.path, w.Code, w.Body.String())
+			}
+			w := doRequest("POST", tt.path, accessToken, tt.second)
+			if w.Code != 409 {
+				t.Fatalf("second POST %s = %d %s, want 409", tt.path, w.Code, w.Body.String())
+			}
+			body := decode(t, w)
+			if body["code"] != "quota_exceeded" || body["resource"] != tt.resource {
+				t.Errorf("second POST %s = %s, want code quota_exceeded for %s", tt.path, w.Body.String(), tt.resource)
+			}
+		})
+	}
+
+	// 已结束的任务不计入活动任务配额
+	if w := doRequest("POST", "/plan", accessToken, gin.H{"status": "completed"}); w.Code != 200 && w.Code != 201 {
+		t.Errorf("POST /plan with a closed status = %d %s, want success", w.Code, w.Body.String())
+	}
+
+	w := doRequest("GET", "/tenant/usage", accessToken, nil)
+	if w.Code != 200 {
+		t.Fatalf("GET /tenant/usage: %d %s", w.Code, w.Body.String())
+	}
+	body := decode(t, w)
+	for resource, want := range map[string]float64{"users": 2, "roads": 1, "active_plans": 1} {
+		usage, _ := body[resource].(map[string]interface{})
+		if usage["used"] != want {
+			t.Errorf("usage of %s = %v, want %v used", resource, usage, want)
+		}
+	}
+}
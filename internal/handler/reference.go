@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errReassignTarget = errors.New("reassign_to must be the ID of another existing record of the same kind")
+
+// deleteOptions 为删除仍被其他记录引用的记录时的处理方式
+// cascade 为 true 时一并删除引用，reassignTo 不为 0 时将引用改为指向该ID的记录
+type deleteOptions struct {
+	cascade    bool
+	reassignTo uint
+}
+
+// parseDeleteOptions 解析 cascade 和 reassign_to 参数，两者不能同时使用，参数不合法时返回 400 并返回 false
+func parseDeleteOptions(c *gin.Context) (deleteOptions, bool) {
+	var options deleteOptions
+	if s := c.Query("cascade"); s != "" {
+		cascade, err := strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "cascade must be true or false"})
+			return options, false
+		}
+		options.cascade = cascade
+	}
+	if s := c.Query("reassign_to"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 0)
+		if err != nil || id == 0 {
+			c.JSON(400, gin.H{"error": "reassign_to must be a positive integer"})
+			return options, false
+		}
+		options.reassignTo = uint(id)
+	}
+	if options.cascade && options.reassignTo != 0 {
+		c.JSON(400, gin.H{"error": "cascade and reassign_to cannot be used together"})
+		return options, false
+	}
+	return options, true
+}
+
+// blocks 判断是否因为仍有引用而拒绝删除
+func (o deleteOptions) blocks(d dependents) bool {
+	return !o.cascade && o.reassignTo == 0 && d.any()
+}
+
+// dependents 为引用待删除记录的其他记录的ID，键为记录的种类，如 plans、reports
+type dependents map[string][]uint
+
+func (d dependents) any() bool {
+	for _, ids := range d {
+		if len(ids) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// respondDependents 返回 409 和引用待删除记录的其他记录的ID
+func respondDependents(c *gin.Context, message string, d dependents) {
+	body := gin.H{"error": message}
+	for kind, ids := range d {
+		if ids == nil {
+			ids = []uint{}
+		}
+		body[kind] = ids
+	}
+	c.JSON(409, body)
+}
+
+// checkRecordsExist 检查 ids 对应的记录是否都存在，不存在时返回包装了 notFound 的错误，调用方需持有 config.DbMutex
+func checkRecordsExist(db *gorm.DB, model interface{}, ids []uint, notFound error) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var found []uint
+	if err := db.Model(model).Where("id IN ?", ids).Pluck("id", &found).Error; err != nil {
+		return err
+	}
+	exists := make(map[uint]bool, len(found))
+	for _, id := range found {
+		exists[id] = true
+	}
+	for _, id := range ids {
+		if !exists[id] {
+			return fmt.Errorf("%w: %d", notFound, id)
+		}
+	}
+	return nil
+}
@@ -2,97 +2,217 @@ package handler
 
 import (
 	"errors"
-	"strconv"
+	"time"
 
 	"github.com/Slinet6056/road-patrol-backend/internal/config"
 	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/rbac"
+	"github.com/Slinet6056/road-patrol-backend/pkg/middleware"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// GetReports 获取所有巡检报告
+var errReportNotOwned = errors.New("report belongs to a plan that is not assigned to the current user")
+
+// ReportDetail 为巡检报告及其检查的设施，修改报告时不提供 asset_ids 则保留原有的设施
+type ReportDetail struct {
+	model.Report
+	AssetIDs []uint `json:"asset_ids"`
+}
+
+// reportListSpec 为 GetReports 允许的筛选参数和排序字段，date_from 和 date_to 按报告的创建时间筛选
+var reportListSpec = listSpec[model.Report]{
+	filters: map[string]listFilter{
+		"plan_id":    equalFilter("plan_id", parseID),
+		"segment_id": equalFilter("segment_id", parseID),
+		"approved":   nullFilter("approved_at"),
+		"date_from":  dateFilter("created_at", false),
+		"date_to":    dateFilter("created_at", true),
+	},
+	sorts: map[string]listSort[model.Report]{
+		"id":         {"id", func(r *model.Report) interface{} { return r.ID }},
+		"plan_id":    {"plan_id", func(r *model.Report) interface{} { return r.PlanID }},
+		"created_at": {"created_at", func(r *model.Report) interface{} { return r.CreatedAt }},
+		"updated_at": {"updated_at", func(r *model.Report) interface{} { return r.UpdatedAt }},
+	},
+	defaultSort: "id",
+	id:          func(r *model.Report) uint { return r.ID },
+}
+
+// GetReports 分页获取巡检报告及其检查的设施ID
+// zone_id 参数只返回所属任务涉及该区域及其下级区域，或发现位置在这些区域内路段上的报告
 func GetReports(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
+	list, ok := parseListQuery(c, &reportListSpec)
+	if !ok {
+		return
+	}
+	zoneIDs, ok := zoneFilter(c, db)
+	if !ok {
+		return
+	}
+	query := db
+	if zoneIDs != nil {
+		query = db.Where("(plan_id IN (?) OR segment_id IN (?))", zonePlanIDs(db, zoneIDs), zoneSegmentIDs(db, zoneIDs))
+	}
 
-	reportChan := make(chan []model.Report)
+	pageChan := make(chan ListPage)
 	errChan := make(chan error)
 
 	go func() {
 		var reports []model.Report
+		var reportAssets []model.ReportAsset
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ?", tenantID).Find(&reports)
+		result := list.apply(query).Find(&reports)
+		reports, next := list.page(reports)
+		if result.Error == nil && len(reports) > 0 {
+			reportIDs := make([]uint, 0, len(reports))
+			for _, report := range reports {
+				reportIDs = append(reportIDs, report.ID)
+			}
+			result = db.Where("report_id IN ?", reportIDs).Order("report_id, asset_id").Find(&reportAssets)
+		}
 		config.DbMutex.Unlock()
 		if result.Error != nil {
 			errChan <- result.Error
 			return
 		}
-		reportChan <- reports
+		assetIDs := make(map[uint][]uint)
+		for _, reportAsset := range reportAssets {
+			assetIDs[reportAsset.ReportID] = append(assetIDs[reportAsset.ReportID], reportAsset.AssetID)
+		}
+		reportDetails := make([]ReportDetail, 0, len(reports))
+		for _, report := range reports {
+			reportDetails = append(reportDetails, ReportDetail{Report: report, AssetIDs: assetIDs[report.ID]})
+		}
+		pageChan <- ListPage{Data: reportDetails, NextCursor: next}
 	}()
 
 	select {
-	case reports := <-reportChan:
-		c.JSON(200, reports)
+	case page := <-pageChan:
+		c.JSON(200, page)
 	case err := <-errChan:
 		c.JSON(500, gin.H{"error": err.Error()})
 	}
 }
 
-// AddReport 添加新的巡检报告
+// AddReport 添加新的巡检报告，可以通过 segment_id 和 chainage 指明发现问题的路段和桩号，通过 asset_ids 指明检查的设施
 func AddReport(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
-	var report model.Report
-	if err := c.ShouldBindJSON(&report); err != nil {
+	db := tenantDB(c)
+	var reportDetail ReportDetail
+	if err := c.ShouldBindJSON(&reportDetail); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	parsedTenantID, _ := strconv.ParseUint(tenantID, 10, 64)
-	report.TenantID = uint(parsedTenantID)
+	report := reportDetail.Report
+	if conflictingTenant(c, report.TenantID) {
+		return
+	}
+	report.ApprovedBy = nil
+	report.ApprovedAt = nil
+	manageAll := middleware.HasPermission(c, rbac.ReportManageAll)
+	userID := middleware.GetUserID(c)
 
-	reportChan := make(chan model.Report)
+	reportChan := make(chan ReportDetail)
 	errChan := make(chan error)
 
 	go func() {
+		// 先确认任务存在，任务不存在时返回 404 而不是无权访问
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ?", tenantID).Create(&report)
+		err := checkRecordsExist(db, &model.Plan{}, []uint{report.PlanID}, errPlanNotFound)
 		config.DbMutex.Unlock()
-		if result.Error != nil {
-			errChan <- result.Error
+		if err != nil {
+			errChan <- err
+			return
+		}
+		// 没有 report:manage_all 权限的用户只能为分配给自己的任务提交报告
+		if !manageAll {
+			owned, err := ownsPlan(db, report.PlanID, userID)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			if !owned {
+				errChan <- errReportNotOwned
+				return
+			}
+		}
+
+		config.DbMutex.Lock()
+		if err := checkReportLocation(db, report.SegmentID, report.Chainage); err != nil {
+			config.DbMutex.Unlock()
+			errChan <- err
+			return
+		}
+		if err := checkAssetsExist(db, reportDetail.AssetIDs); err != nil {
+			config.DbMutex.Unlock()
+			errChan <- err
+			return
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&report).Error; err != nil {
+				return err
+			}
+			return replaceReportAssets(tx, report.ID, reportDetail.AssetIDs)
+		})
+		config.DbMutex.Unlock()
+		if err != nil {
+			errChan <- err
 			return
 		}
 		var createdReport model.Report
 		config.DbMutex.Lock()
-		config.DB.Where("id = ?", report.ID).First(&createdReport)
+		db.Where("id = ?", report.ID).First(&createdReport)
+		assetIDs, err := reportAssetIDs(db, report.ID)
 		config.DbMutex.Unlock()
-		reportChan <- createdReport
+		if err != nil {
+			errChan <- err
+			return
+		}
+		reportChan <- ReportDetail{Report: createdReport, AssetIDs: assetIDs}
 	}()
 
 	select {
 	case createdReport := <-reportChan:
 		c.JSON(201, createdReport)
 	case err := <-errChan:
-		c.JSON(500, gin.H{"error": err.Error()})
+		if errors.Is(err, errPlanNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else if errors.Is(err, errReportNotOwned) {
+			c.JSON(403, gin.H{"error": err.Error()})
+		} else if isLocationError(err) || errors.Is(err, errAssetIDNotFound) {
+			c.JSON(400, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
 	}
 }
 
-// UpdateReport 更新巡检报告信息
+// UpdateReport 更新巡检报告信息，提供 asset_ids 时替换报告检查的设施
 func UpdateReport(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
-	var report model.Report
+	db := tenantDB(c)
+	var reportDetail ReportDetail
 	id := c.Param("id")
-	if err := c.ShouldBindJSON(&report); err != nil {
+	if err := c.ShouldBindJSON(&reportDetail); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	parsedTenantID, _ := strconv.ParseUint(tenantID, 10, 64)
-	report.TenantID = uint(parsedTenantID)
+	report := reportDetail.Report
+	if conflictingTenant(c, report.TenantID) {
+		return
+	}
+	report.ApprovedBy = nil
+	report.ApprovedAt = nil
+	manageAll := middleware.HasPermission(c, rbac.ReportManageAll)
+	userID := middleware.GetUserID(c)
 
-	reportChan := make(chan model.Report)
+	reportChan := make(chan ReportDetail)
 	errChan := make(chan error)
 
 	go func() {
 		var existingReport model.Report
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&existingReport)
+		result := db.Where("id = ?", id).First(&existingReport)
 		config.DbMutex.Unlock()
 		if result.Error != nil {
 			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
@@ -102,22 +222,77 @@ func UpdateReport(c *gin.Context) {
 			}
 			return
 		}
+		// 先确认要改到的任务存在，任务不存在时返回 400 而不是无权访问
+		if report.PlanID != 0 {
+			config.DbMutex.Lock()
+			err := checkRecordsExist(db, &model.Plan{}, []uint{report.PlanID}, errPlanNotFound)
+			config.DbMutex.Unlock()
+			if err != nil {
+				errChan <- err
+				return
+			}
+		}
+		if !manageAll {
+			// 原报告所属的任务和要改到的任务都必须分配给当前用户
+			for _, planID := range []uint{existingReport.PlanID, report.PlanID} {
+				if planID == 0 {
+					continue
+				}
+				owned, err := ownsPlan(db, planID, userID)
+				if err != nil {
+					errChan <- err
+					return
+				}
+				if !owned {
+					errChan <- errReportNotOwned
+					return
+				}
+			}
+		}
 		config.DbMutex.Lock()
-		result = config.DB.Where("tenant_id = ?", tenantID).Model(&model.Report{}).Where("id = ?", id).Updates(report)
+		// 只修改路段或桩号之一时，与报告原有的另一项一起校验
+		if report.SegmentID != nil || report.Chainage != nil {
+			segmentID, chainage := report.SegmentID, report.Chainage
+			if segmentID == nil {
+				segmentID = existingReport.SegmentID
+			}
+			if chainage == nil {
+				chainage = existingReport.Chainage
+			}
+			if err := checkReportLocation(db, segmentID, chainage); err != nil {
+				config.DbMutex.Unlock()
+				errChan <- err
+				return
+			}
+		}
+		if err := checkAssetsExist(db, reportDetail.AssetIDs); err != nil {
+			config.DbMutex.Unlock()
+			errChan <- err
+			return
+		}
+		result = db.Model(&model.Report{}).Where("id = ?", id).Updates(report)
+		err := result.Error
+		if err == nil && reportDetail.AssetIDs != nil {
+			err = replaceReportAssets(db, existingReport.ID, reportDetail.AssetIDs)
+		}
 		config.DbMutex.Unlock()
-		if result.Error != nil {
-			errChan <- result.Error
+		if err != nil {
+			errChan <- err
 			return
 		}
-		if result.RowsAffected == 0 {
-			reportChan <- existingReport
-		} else {
-			var updatedReport model.Report
-			config.DbMutex.Lock()
-			config.DB.Where("id = ?", id).First(&updatedReport)
-			config.DbMutex.Unlock()
-			reportChan <- updatedReport
+		updatedReport := existingReport
+		var assetIDs []uint
+		config.DbMutex.Lock()
+		if result.RowsAffected > 0 {
+			db.Where("id = ?", id).First(&updatedReport)
+		}
+		assetIDs, err = reportAssetIDs(db, existingReport.ID)
+		config.DbMutex.Unlock()
+		if err != nil {
+			errChan <- err
+			return
 		}
+		reportChan <- ReportDetail{Report: updatedReport, AssetIDs: assetIDs}
 	}()
 
 	select {
@@ -130,30 +305,134 @@ func UpdateReport(c *gin.Context) {
 	case err := <-errChan:
 		if err.Error() == "no report found with given ID" {
 			c.JSON(404, gin.H{"error": err.Error()})
+		} else if errors.Is(err, errReportNotOwned) {
+			c.JSON(403, gin.H{"error": err.Error()})
+		} else if isLocationError(err) || errors.Is(err, errAssetIDNotFound) || errors.Is(err, errPlanNotFound) {
+			c.JSON(400, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(500, gin.H{"error": err.Error()})
 		}
 	}
 }
 
-// DeleteReport 删除巡检报告
+// DeleteReport 删除巡检报告及其检查的设施关联
 func DeleteReport(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
 	id := c.Param("id")
 
+	manageAll := middleware.HasPermission(c, rbac.ReportManageAll)
+	userID := middleware.GetUserID(c)
+
 	resultChan := make(chan error)
 
 	go func() {
+		if !manageAll {
+			var existingReport model.Report
+			config.DbMutex.Lock()
+			result := db.Where("id = ?", id).First(&existingReport)
+			config.DbMutex.Unlock()
+			if result.Error == nil {
+				owned, err := ownsPlan(db, existingReport.PlanID, userID)
+				if err != nil {
+					resultChan <- err
+					return
+				}
+				if !owned {
+					resultChan <- errReportNotOwned
+					return
+				}
+			}
+		}
+
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ?", tenantID).Delete(&model.Report{}, id)
+		db.Where("report_id = ?", id).Delete(&model.ReportAsset{})
+		result := db.Delete(&model.Report{}, id)
 		config.DbMutex.Unlock()
 		resultChan <- result.Error
 	}()
 
 	if err := <-resultChan; err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		if errors.Is(err, errReportNotOwned) {
+			c.JSON(403, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
 	c.JSON(200, gin.H{"message": "Report deleted"})
 }
+
+// ApproveReport 审核通过巡检报告
+func ApproveReport(c *gin.Context) {
+	db := tenantDB(c)
+	userID := middleware.GetUserID(c)
+	id := c.Param("id")
+
+	reportChan := make(chan model.Report)
+	errChan := make(chan error)
+
+	go func() {
+		var report model.Report
+		config.DbMutex.Lock()
+		result := db.Where("id = ?", id).First(&report)
+		config.DbMutex.Unlock()
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				errChan <- errors.New("no report found with given ID")
+			} else {
+				errChan <- result.Error
+			}
+			return
+		}
+
+		now := time.Now()
+		report.ApprovedBy = &userID
+		report.ApprovedAt = &now
+		config.DbMutex.Lock()
+		result = db.Model(&report).Select("approved_by", "approved_at").Updates(&report)
+		config.DbMutex.Unlock()
+		if result.Error != nil {
+			errChan <- result.Error
+			return
+		}
+		reportChan <- report
+	}()
+
+	select {
+	case report := <-reportChan:
+		c.JSON(200, report)
+	case err := <-errChan:
+		if err.Error() == "no report found with given ID" {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// replaceReportAssets 将报告检查的设施替换为 assetIDs，调用方需持有 config.DbMutex
+func replaceReportAssets(db *gorm.DB, reportID uint, assetIDs []uint) error {
+	if err := db.Where("report_id = ?", reportID).Delete(&model.ReportAsset{}).Error; err != nil {
+		return err
+	}
+	seen := make(map[uint]bool, len(assetIDs))
+	rows := make([]model.ReportAsset, 0, len(assetIDs))
+	for _, assetID := range assetIDs {
+		if !seen[assetID] {
+			seen[assetID] = true
+			rows = append(rows, model.ReportAsset{ReportID: reportID, AssetID: assetID})
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return db.Create(&rows).Error
+}
+
+// reportAssetIDs 返回报告检查的设施ID，调用方需持有 config.DbMutex
+func reportAssetIDs(db *gorm.DB, reportID uint) ([]uint, error) {
+	var assetIDs []uint
+	err := db.Model(&model.ReportAsset{}).Where("report_id = ?", reportID).Order("asset_id").Pluck("asset_id", &assetIDs).Error
+	return assetIDs, err
+}
@@ -5,94 +5,264 @@ import (
 	"strconv"
 
 	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/history"
 	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// GetRoads 获取所有道路信息
+// roadListSpec 为 GetRoads 允许的筛选参数和排序字段
+var roadListSpec = listSpec[model.Road]{
+	filters: map[string]listFilter{
+		"type":              equalFilter("type", parseString),
+		"surface_material":  equalFilter("surface_material", parseString),
+		"construction_year": equalFilter("construction_year", parseInt),
+	},
+	sorts: map[string]listSort[model.Road]{
+		"id":                {"id", func(r *model.Road) interface{} { return r.ID }},
+		"name":              {"name", func(r *model.Road) interface{} { return r.Name }},
+		"type":              {"type", func(r *model.Road) interface{} { return r.Type }},
+		"length":            {"length", func(r *model.Road) interface{} { return r.Length }},
+		"construction_year": {"construction_year", func(r *model.Road) interface{} { return r.ConstructionYear }},
+	},
+	defaultSort: "id",
+	id:          func(r *model.Road) uint { return r.ID },
+}
+
+// roadFeaturePage 为分页的 GeoJSON FeatureCollection，next_cursor 作为 GeoJSON 的扩展成员
+type roadFeaturePage struct {
+	geo.FeatureCollection
+	NextCursor *string `json:"next_cursor"`
+}
+
+// GetRoads 分页获取道路信息，format=geojson 时返回 GeoJSON FeatureCollection
+// 支持 bbox、near（配合 radius）和 nearest（配合 count）空间筛选，筛选结果按距离排序，同样按 limit 和 cursor 分页
+// crs 参数指定筛选参数和返回结果中坐标使用的坐标系，zone_id 参数只返回该区域及其下级区域内的道路
 func GetRoads(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "geojson" {
+		c.JSON(400, gin.H{"error": "Unsupported format"})
+		return
+	}
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+	spatial, err := parseRoadSpatialQuery(c, crs)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	spec := &roadListSpec
+	if spatial != nil {
+		if c.Query("sort") != "" {
+			c.JSON(400, gin.H{"error": "sort cannot be used with spatial queries"})
+			return
+		}
+		spec = &roadSpatialListSpec
+	}
+	list, ok := parseListQuery(c, spec)
+	if !ok {
+		return
+	}
+	zoneIDs, ok := zoneFilter(c, db)
+	if !ok {
+		return
+	}
+	if zoneIDs != nil {
+		db = db.Where("zone_id IN ?", zoneIDs)
+	}
+	db = list.filter(db).Session(&gorm.Session{})
 
-	roadChan := make(chan []model.Road)
+	type roadPage struct {
+		roads []model.Road
+		next  *string
+	}
+	pageChan := make(chan roadPage)
 	errChan := make(chan error)
 
 	go func() {
 		var roads []model.Road
+		var next *string
+		var err error
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ?", tenantID).Find(&roads)
+		if spatial != nil {
+			var after *float64
+			if list.after != nil {
+				distance := list.afterValue.(float64)
+				after = &distance
+			}
+			roads, err = spatial.find(db, after)
+			roads, next = pageByDistance(list, roads)
+		} else {
+			err = list.apply(db).Find(&roads).Error
+			roads, next = list.page(roads)
+		}
 		config.DbMutex.Unlock()
-		if result.Error != nil {
-			errChan <- result.Error
+		if err != nil {
+			errChan <- err
 			return
 		}
-		roadChan <- roads
+		pageChan <- roadPage{roads, next}
 	}()
 
 	select {
-	case roads := <-roadChan:
-		c.JSON(200, roads)
+	case page := <-pageChan:
+		roads := roadsInCRS(page.roads, crs)
+		if format == "geojson" {
+			c.Header("Content-Type", "application/geo+json")
+			c.JSON(200, roadFeaturePage{FeatureCollection: roadFeatureCollection(roads), NextCursor: page.next})
+		} else {
+			c.JSON(200, ListPage{Data: roads, NextCursor: page.next})
+		}
 	case err := <-errChan:
-		c.JSON(500, gin.H{"error": err.Error()})
+		if errors.Is(err, errTooManySpatialCandidates) {
+			c.JSON(400, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
 	}
 }
 
-// AddRoad 添加新的道路信息
+// AddRoad 添加新的道路信息，crs 参数指定请求和响应中坐标使用的坐标系
 func AddRoad(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	userID := changedBy(c)
 	var road model.Road
 	if err := c.ShouldBindJSON(&road); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	parsedTenantID, _ := strconv.ParseUint(tenantID, 10, 64)
-	road.TenantID = uint(parsedTenantID)
+	if conflictingTenant(c, road.TenantID) {
+		return
+	}
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+	if road.ZoneID != nil && *road.ZoneID == 0 {
+		road.ZoneID = nil
+	}
+	fieldErrs := road.Validate()
+	if road.Name == "" {
+		fieldErrs["name"] = "is required"
+	}
+	if len(fieldErrs) > 0 {
+		respondFieldErrors(c, "Invalid road", fieldErrs)
+		return
+	}
+	road.ConvertCRS(crs, geo.WGS84)
+	if err := road.ApplyGeometry(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
 	roadChan := make(chan model.Road)
 	errChan := make(chan error)
+	invalidChan := make(chan model.FieldErrors)
 
 	go func() {
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ?", tenantID).Create(&road)
+		vocabulary, err := loadVocabulary(db)
+		if err != nil {
+			config.DbMutex.Unlock()
+			errChan <- err
+			return
+		}
+		vocabulary.NormalizeRoad(&road, fieldErrs)
+		if err := checkRoadZone(db, road.ZoneID, fieldErrs); err != nil {
+			config.DbMutex.Unlock()
+			errChan <- err
+			return
+		}
+		if len(fieldErrs) > 0 {
+			config.DbMutex.Unlock()
+			invalidChan <- fieldErrs
+			return
+		}
+		if err := checkQuota(db, tenantID, quotaRoads, 1); err != nil {
+			config.DbMutex.Unlock()
+			errChan <- err
+			return
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&road).Error; err != nil {
+				return err
+			}
+			return history.RecordRoad(tx, &road, model.RoadChangeCreate, userID)
+		})
 		config.DbMutex.Unlock()
-		if result.Error != nil {
-			errChan <- result.Error
+		if err != nil {
+			errChan <- err
 			return
 		}
 		var createdRoad model.Road
 		config.DbMutex.Lock()
-		config.DB.Where("id = ?", road.ID).First(&createdRoad)
+		db.Where("id = ?", road.ID).First(&createdRoad)
 		config.DbMutex.Unlock()
 		roadChan <- createdRoad
 	}()
 
 	select {
 	case createdRoad := <-roadChan:
+		createdRoad.ConvertCRS(geo.WGS84, crs)
 		c.JSON(201, createdRoad)
+	case fieldErrs := <-invalidChan:
+		respondFieldErrors(c, "Invalid road", fieldErrs)
 	case err := <-errChan:
-		c.JSON(500, gin.H{"error": err.Error()})
+		if !respondQuotaExceeded(c, err) {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
 	}
 }
 
-// UpdateRoad 更新道路信息
+// UpdateRoad 更新道路信息，crs 参数指定请求和响应中坐标使用的坐标系，zone_id 为 0 时将道路移出所属区域
 func UpdateRoad(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
+	userID := changedBy(c)
 	var road model.Road
 	id := c.Param("id")
 	if err := c.ShouldBindJSON(&road); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	parsedTenantID, _ := strconv.ParseUint(tenantID, 10, 64)
-	road.TenantID = uint(parsedTenantID)
+	if conflictingTenant(c, road.TenantID) {
+		return
+	}
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+	// 坐标转换需要同时知道经度和纬度
+	if crs != geo.WGS84 && (road.Latitude == 0) != (road.Longitude == 0) {
+		c.JSON(400, gin.H{"error": "latitude and longitude must be provided together when crs is not wgs84"})
+		return
+	}
+	fieldErrs := road.Validate()
+	if len(fieldErrs) > 0 {
+		respondFieldErrors(c, "Invalid road", fieldErrs)
+		return
+	}
+	road.ConvertCRS(crs, geo.WGS84)
+	if err := road.ApplyGeometry(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
 	roadChan := make(chan model.Road)
 	errChan := make(chan error)
+	invalidChan := make(chan model.FieldErrors)
 
 	go func() {
 		var existingRoad model.Road
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&existingRoad)
+		result := db.Where("id = ?", id).First(&existingRoad)
 		config.DbMutex.Unlock()
 		if result.Error != nil {
 			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
@@ -103,30 +273,78 @@ func UpdateRoad(c *gin.Context) {
 			return
 		}
 		config.DbMutex.Lock()
-		result = config.DB.Where("tenant_id = ?", tenantID).Model(&model.Road{}).Where("id = ?", id).Updates(road)
+		vocabulary, err := loadVocabulary(db)
+		if err == nil {
+			vocabulary.NormalizeRoad(&road, fieldErrs)
+			err = checkRoadZone(db, road.ZoneID, fieldErrs)
+		}
 		config.DbMutex.Unlock()
-		if result.Error != nil {
-			errChan <- result.Error
+		if err != nil {
+			errChan <- err
 			return
 		}
-		if result.RowsAffected == 0 {
-			roadChan <- existingRoad
-		} else {
-			var updatedRoad model.Road
-			config.DbMutex.Lock()
-			config.DB.Where("id = ?", id).First(&updatedRoad)
-			config.DbMutex.Unlock()
-			roadChan <- updatedRoad
+		if len(fieldErrs) > 0 {
+			invalidChan <- fieldErrs
+			return
+		}
+		// zone_id 为 0 表示移出区域，需要单独更新为 NULL
+		clearZone := road.ZoneID != nil && *road.ZoneID == 0
+		if clearZone {
+			road.ZoneID = nil
 		}
+		// 已有几何形状的道路，长度和代表点只能通过修改几何形状更新
+		if road.Geometry == nil && existingRoad.Geometry != nil {
+			road.Length, road.Latitude, road.Longitude = 0, 0, 0
+		}
+		// 外包矩形在更新后按道路的最终位置重新计算
+		road.SetBounds(nil)
+		// 更新、重新计算外包矩形和记录版本在同一事务中完成，保证每次修改都有对应的历史版本
+		updatedRoad := existingRoad
+		config.DbMutex.Lock()
+		err = db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&model.Road{}).Where("id = ?", id).Updates(road)
+			if result.Error != nil {
+				return result.Error
+			}
+			updated := result.RowsAffected
+			if clearZone {
+				result = tx.Model(&model.Road{}).Where("id = ?", id).Update("zone_id", nil)
+				if result.Error != nil {
+					return result.Error
+				}
+				updated += result.RowsAffected
+			}
+			if updated == 0 {
+				return nil
+			}
+			if err := tx.Where("id = ?", id).First(&updatedRoad).Error; err != nil {
+				return err
+			}
+			if err := updatedRoad.ApplyGeometry(); err == nil {
+				if err := tx.Model(&updatedRoad).Select(model.RoadBBoxColumns).Updates(&updatedRoad).Error; err != nil {
+					return err
+				}
+			}
+			return history.RecordRoad(tx, &updatedRoad, model.RoadChangeUpdate, userID)
+		})
+		config.DbMutex.Unlock()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		roadChan <- updatedRoad
 	}()
 
 	select {
 	case road := <-roadChan:
+		road.ConvertCRS(geo.WGS84, crs)
 		if road.ID == 0 {
 			c.JSON(200, gin.H{"message": "No fields updated", "road": road})
 		} else {
 			c.JSON(200, road)
 		}
+	case fieldErrs := <-invalidChan:
+		respondFieldErrors(c, "Invalid road", fieldErrs)
 	case err := <-errChan:
 		if err.Error() == "no road found with given ID" {
 			c.JSON(404, gin.H{"error": err.Error()})
@@ -136,24 +354,149 @@ func UpdateRoad(c *gin.Context) {
 	}
 }
 
-// DeleteRoad 删除道路信息
+// DeleteRoad 删除道路信息及其路段和设施，道路删除后其历史版本仍然保留
+// 道路或其路段仍被巡检任务关联，或者路段、设施仍被报告引用时返回 409 和这些任务、报告的ID，除非指定以下参数之一：
+// cascade=true 删除这些引用，即任务与道路、路段的关联，报告中的发现位置和对设施的检查记录，任务和报告本身保留；
+// reassign_to 为另一条道路的ID时，关联了该道路或其路段的任务改为关联另一条道路，报告中的引用同样被删除
 func DeleteRoad(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
 	id := c.Param("id")
+	userID := changedBy(c)
+	options, ok := parseDeleteOptions(c)
+	if !ok {
+		return
+	}
 
 	resultChan := make(chan error)
+	blockedChan := make(chan dependents)
 
 	go func() {
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ?", tenantID).Delete(&model.Road{}, id)
-		config.DbMutex.Unlock()
-		resultChan <- result.Error
+		defer config.DbMutex.Unlock()
+		var blocked dependents
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var road model.Road
+			if err := tx.Where("id = ?", id).Limit(1).Find(&road).Error; err != nil {
+				return err
+			}
+			if road.ID == 0 {
+				return nil
+			}
+			deps, err := roadDependents(tx, road.ID)
+			if err != nil {
+				return err
+			}
+			if options.blocks(deps) {
+				blocked = deps
+				return nil
+			}
+			if options.reassignTo != 0 {
+				if err := reassignPlanRoads(tx, road.ID, options.reassignTo, deps["plans"]); err != nil {
+					return err
+				}
+			}
+
+			segmentIDs := tx.Model(&model.RoadSegment{}).Select("id").Where("road_id = ?", road.ID)
+			if err := tx.Where("road_id = ?", road.ID).Delete(&model.PlanRoad{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("segment_id IN (?)", segmentIDs).Delete(&model.PlanSegment{}).Error; err != nil {
+				return err
+			}
+			err = tx.Model(&model.Report{}).Where("segment_id IN (?)", segmentIDs).
+				Updates(map[string]interface{}{"segment_id": nil, "chainage": nil}).Error
+			if err != nil {
+				return err
+			}
+			assetIDs := tx.Model(&model.Asset{}).Select("id").Where("road_id = ?", road.ID)
+			if err := tx.Where("asset_id IN (?)", assetIDs).Delete(&model.ReportAsset{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("road_id = ?", road.ID).Delete(&model.Asset{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("road_id = ?", road.ID).Delete(&model.RoadSegment{}).Error; err != nil {
+				return err
+			}
+			// 最后一个历史版本记录删除前的状态
+			if err := history.RecordRoad(tx, &road, model.RoadChangeDelete, userID); err != nil {
+				return err
+			}
+			return tx.Delete(&road).Error
+		})
+		if err == nil && blocked != nil {
+			blockedChan <- blocked
+			return
+		}
+		resultChan <- err
 	}()
 
-	if err := <-resultChan; err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+	select {
+	case deps := <-blockedChan:
+		respondDependents(c, "road is still referenced by plans or reports", deps)
+	case err := <-resultChan:
+		if errors.Is(err, errReassignTarget) {
+			c.JSON(400, gin.H{"error": err.Error()})
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(200, gin.H{"message": "Road deleted"})
+		}
+	}
+}
+
+// roadDependents 返回关联了道路或其路段的巡检任务，以及引用了其路段或设施的报告，调用方需持有 config.DbMutex
+func roadDependents(db *gorm.DB, roadID uint) (dependents, error) {
+	segmentIDs := db.Model(&model.RoadSegment{}).Select("id").Where("road_id = ?", roadID)
+	assetIDs := db.Model(&model.Asset{}).Select("id").Where("road_id = ?", roadID)
+	var plans, reports []uint
+	err := db.Model(&model.Plan{}).
+		Where("(id IN (?) OR id IN (?))",
+			db.Model(&model.PlanRoad{}).Select("plan_id").Where("road_id = ?", roadID),
+			db.Model(&model.PlanSegment{}).Select("plan_id").Where("segment_id IN (?)", segmentIDs)).
+		Order("id").Pluck("id", &plans).Error
+	if err != nil {
+		return nil, err
 	}
+	err = db.Model(&model.Report{}).
+		Where("(segment_id IN (?) OR id IN (?))",
+			segmentIDs, db.Model(&model.ReportAsset{}).Select("report_id").Where("asset_id IN (?)", assetIDs)).
+		Order("id").Pluck("id", &reports).Error
+	if err != nil {
+		return nil, err
+	}
+	return dependents{"plans": plans, "reports": reports}, nil
+}
 
-	c.JSON(200, gin.H{"message": "Road deleted"})
+// reassignPlanRoads 让关联了道路或其路段的巡检任务改为关联另一条道路，已关联另一条道路的任务不重复关联，调用方需持有 config.DbMutex
+func reassignPlanRoads(db *gorm.DB, roadID, targetID uint, planIDs []uint) error {
+	if targetID == roadID {
+		return errReassignTarget
+	}
+	if _, err := findRoad(db, strconv.FormatUint(uint64(targetID), 10)); err != nil {
+		if errors.Is(err, errRoadNotFound) {
+			return errReassignTarget
+		}
+		return err
+	}
+	if len(planIDs) == 0 {
+		return nil
+	}
+	var linked []uint
+	if err := db.Model(&model.PlanRoad{}).Where("road_id = ? AND plan_id IN ?", targetID, planIDs).Pluck("plan_id", &linked).Error; err != nil {
+		return err
+	}
+	skip := make(map[uint]bool, len(linked))
+	for _, planID := range linked {
+		skip[planID] = true
+	}
+	for _, planID := range planIDs {
+		if skip[planID] {
+			continue
+		}
+		if err := db.Create(&model.PlanRoad{PlanID: planID, RoadID: targetID}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
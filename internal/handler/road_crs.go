@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+	"github.com/gin-gonic/gin"
+)
+
+// requestCRS 读取请求中的 crs 参数，默认为 WGS84，参数无效时直接返回 400
+// 道路坐标在数据库中统一以 WGS84 保存，crs 只决定请求和响应中坐标使用的坐标系
+func requestCRS(c *gin.Context) (geo.CRS, bool) {
+	crs, err := geo.ParseCRS(c.Query("crs"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return crs, true
+}
+
+// roadsInCRS 将以 WGS84 保存的道路转换到请求的坐标系
+func roadsInCRS(roads []model.Road, crs geo.CRS) []model.Road {
+	if crs == geo.WGS84 {
+		return roads
+	}
+	for i := range roads {
+		roads[i].ConvertCRS(geo.WGS84, crs)
+	}
+	return roads
+}
@@ -0,0 +1,317 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/history"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxGeoJSONUpload 为道路导入接口允许的请求体大小
+const maxGeoJSONUpload = 16 << 20
+
+// roadImportColumns 为导入时更新已有道路所写入的字段，要素中缺少的属性会被清空
+var roadImportColumns = append([]string{"name", "latitude", "longitude", "geometry", "length", "type", "surface_material", "construction_year"}, model.RoadBBoxColumns...)
+
+// roadProperties 定义导入时从要素属性中读取的道路字段
+type roadProperties struct {
+	Name             string `json:"name"`
+	Type             string `json:"type"`
+	SurfaceMaterial  string `json:"surface_material"`
+	ConstructionYear int    `json:"construction_year"`
+}
+
+// featureError 描述导入时某个要素的错误，Index 为要素在集合中的下标，Field 为出错的属性
+type featureError struct {
+	Index int    `json:"index"`
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
+
+// fieldFeatureErrors 将要素的字段校验错误按字段名排序后转换为 featureError
+func fieldFeatureErrors(index int, errs model.FieldErrors) []featureError {
+	result := make([]featureError, 0, len(errs))
+	for field, message := range errs {
+		result = append(result, featureError{Index: index, Field: field, Error: message})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Field < result[j].Field })
+	return result
+}
+
+// roadImport 为待导入的一条道路，ID 不为 0 时更新已有道路
+type roadImport struct {
+	index int
+	key   interface{}
+	road  model.Road
+}
+
+// roadFeatureCollection 将道路转换为 GeoJSON FeatureCollection，没有几何形状的道路以代表点表示
+func roadFeatureCollection(roads []model.Road) geo.FeatureCollection {
+	features := make([]geo.Feature, 0, len(roads))
+	for _, road := range roads {
+		geometry := geo.NewPointGeometry(geo.Point{road.Longitude, road.Latitude})
+		if road.Geometry != nil {
+			geometry = road.Geometry.Geometry()
+		}
+		properties := map[string]interface{}{
+			"name":              road.Name,
+			"length":            road.Length,
+			"type":              road.Type,
+			"surface_material":  road.SurfaceMaterial,
+			"construction_year": road.ConstructionYear,
+		}
+		if road.Distance != nil {
+			properties["distance"] = *road.Distance
+		}
+		features = append(features, geo.Feature{
+			Type:       geo.TypeFeature,
+			ID:         road.ID,
+			Geometry:   geometry,
+			Properties: properties,
+		})
+	}
+	return geo.FeatureCollection{Type: geo.TypeFeatureCollection, Features: features}
+}
+
+// ImportRoads 从 GeoJSON 批量创建或更新道路，每个要素的几何形状必须为 LineString
+// crs 参数指定要素坐标使用的坐标系；match=id（默认）时按要素的 id 匹配已有道路，没有 id 的要素创建新道路；match=name 时按道路名称匹配
+// 任何一个要素有误时不做任何修改
+func ImportRoads(c *gin.Context) {
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	userID := changedBy(c)
+	match := c.DefaultQuery("match", "id")
+	if match != "id" && match != "name" {
+		c.JSON(400, gin.H{"error": "match must be id or name"})
+		return
+	}
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxGeoJSONUpload))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	features, err := geo.ParseFeatures(data)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	imports, errs := parseRoadFeatures(features, match, crs)
+	if len(errs) > 0 {
+		c.JSON(400, gin.H{"error": "Invalid features", "errors": errs})
+		return
+	}
+
+	type importResult struct {
+		created []model.Road
+		updated []model.Road
+	}
+	resultChan := make(chan importResult)
+	errChan := make(chan error)
+	invalidChan := make(chan []featureError)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		vocabulary, err := loadVocabulary(db)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		var created int64
+		var errs []featureError
+		for i := range imports {
+			fieldErrs := model.FieldErrors{}
+			if vocabulary.NormalizeRoad(&imports[i].road, fieldErrs); len(fieldErrs) > 0 {
+				errs = append(errs, fieldFeatureErrors(imports[i].index, fieldErrs)...)
+			}
+			if err := resolveRoadImport(db, &imports[i], match); err != nil {
+				if !errors.Is(err, errRoadImportKey) {
+					errChan <- err
+					return
+				}
+				errs = append(errs, featureError{Index: imports[i].index, Error: err.Error()})
+			}
+			if imports[i].road.ID == 0 {
+				created++
+			}
+		}
+		if len(errs) > 0 {
+			invalidChan <- errs
+			return
+		}
+		if err := checkQuota(db, tenantID, quotaRoads, created); err != nil {
+			errChan <- err
+			return
+		}
+
+		var result importResult
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, item := range imports {
+				road := item.road
+				if road.ID == 0 {
+					if err := tx.Create(&road).Error; err != nil {
+						return err
+					}
+					if err := history.RecordRoad(tx, &road, model.RoadChangeCreate, userID); err != nil {
+						return err
+					}
+					result.created = append(result.created, road)
+				} else {
+					if err := tx.Model(&road).Select(roadImportColumns).Updates(&road).Error; err != nil {
+						return err
+					}
+					if err := tx.Where("id = ?", road.ID).First(&road).Error; err != nil {
+						return err
+					}
+					if err := history.RecordRoad(tx, &road, model.RoadChangeUpdate, userID); err != nil {
+						return err
+					}
+					result.updated = append(result.updated, road)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			errChan <- err
+			return
+		}
+		resultChan <- result
+	}()
+
+	select {
+	case result := <-resultChan:
+		c.JSON(200, gin.H{
+			"created": len(result.created),
+			"updated": len(result.updated),
+			"roads":   roadsInCRS(append(result.created, result.updated...), crs),
+		})
+	case errs := <-invalidChan:
+		c.JSON(400, gin.H{"error": "Invalid features", "errors": errs})
+	case err := <-errChan:
+		if !respondQuotaExceeded(c, err) {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+var errRoadImportKey = errors.New("no unique road matches")
+
+// parseRoadFeatures 将要素转换为待导入的道路，并计算长度和代表点
+func parseRoadFeatures(features []geo.Feature, match string, crs geo.CRS) ([]roadImport, []featureError) {
+	imports := make([]roadImport, 0, len(features))
+	keys := make(map[interface{}]bool, len(features))
+	var errs []featureError
+	for i, feature := range features {
+		line, err := feature.Geometry.LineString()
+		if err != nil {
+			errs = append(errs, featureError{Index: i, Error: err.Error()})
+			continue
+		}
+		var properties roadProperties
+		if raw, err := json.Marshal(feature.Properties); err != nil {
+			errs = append(errs, featureError{Index: i, Error: err.Error()})
+			continue
+		} else if err := json.Unmarshal(raw, &properties); err != nil {
+			errs = append(errs, featureError{Index: i, Error: "invalid properties: " + err.Error()})
+			continue
+		}
+		road := model.Road{
+			Name:             properties.Name,
+			Geometry:         line.Convert(crs, geo.WGS84),
+			Type:             properties.Type,
+			SurfaceMaterial:  properties.SurfaceMaterial,
+			ConstructionYear: properties.ConstructionYear,
+		}
+		if fieldErrs := road.Validate(); len(fieldErrs) > 0 {
+			errs = append(errs, fieldFeatureErrors(i, fieldErrs)...)
+			continue
+		}
+		if err := road.ApplyGeometry(); err != nil {
+			errs = append(errs, featureError{Index: i, Error: err.Error()})
+			continue
+		}
+
+		item := roadImport{index: i, road: road}
+		switch match {
+		case "id":
+			if feature.ID != nil {
+				id, err := featureID(feature.ID)
+				if err != nil {
+					errs = append(errs, featureError{Index: i, Error: "invalid feature id"})
+					continue
+				}
+				item.key = id
+			}
+		case "name":
+			if properties.Name == "" {
+				errs = append(errs, featureError{Index: i, Error: "name is required when matching by name"})
+				continue
+			}
+			item.key = properties.Name
+		}
+		if item.key != nil {
+			if keys[item.key] {
+				errs = append(errs, featureError{Index: i, Error: fmt.Sprintf("duplicate feature %s %v", match, item.key)})
+				continue
+			}
+			keys[item.key] = true
+		}
+		imports = append(imports, item)
+	}
+	return imports, errs
+}
+
+// featureID 将要素的 id 转换为道路ID，GeoJSON 允许 id 为数字或字符串
+func featureID(id interface{}) (uint64, error) {
+	switch v := id.(type) {
+	case float64:
+		if v < 1 || v != math.Trunc(v) || v > math.MaxUint32 {
+			return 0, errors.New("invalid feature id")
+		}
+		return uint64(v), nil
+	case string:
+		return strconv.ParseUint(v, 10, 32)
+	}
+	return 0, errors.New("invalid feature id")
+}
+
+// resolveRoadImport 查找要素对应的已有道路，找到时设置待导入道路的ID
+// 按ID匹配时ID必须存在；按名称匹配时没有同名道路则创建，有多条同名道路时返回错误
+func resolveRoadImport(db *gorm.DB, item *roadImport, match string) error {
+	if item.key == nil {
+		return nil
+	}
+	var ids []uint
+	if err := db.Model(&model.Road{}).Where(match+" = ?", item.key).Limit(2).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	switch {
+	case len(ids) == 1:
+		item.road.ID = ids[0]
+	case len(ids) > 1:
+		return fmt.Errorf("%w: more than one road is named %q", errRoadImportKey, item.key)
+	case match == "id":
+		return fmt.Errorf("%w: road %v not found", errRoadImportKey, item.key)
+	}
+	return nil
+}
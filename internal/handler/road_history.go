@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/history"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+	"github.com/Slinet6056/road-patrol-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// RoadAsOf 为道路在某个时间点的状态，以及该状态所属的版本
+type RoadAsOf struct {
+	model.Road
+	Version   int       `json:"version"`
+	ChangedBy *uint     `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// GetRoadHistory 获取道路的全部历史版本，按版本号升序排列，已删除道路的历史仍可查询
+// crs 参数指定返回的坐标使用的坐标系
+func GetRoadHistory(c *gin.Context) {
+	db := tenantDB(c)
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.JSON(404, gin.H{"error": errRoadNotFound.Error()})
+		return
+	}
+
+	versionsChan := make(chan []model.RoadVersion)
+	errChan := make(chan error)
+
+	go func() {
+		config.DbMutex.Lock()
+		versions, err := history.Versions(db, uint(id))
+		config.DbMutex.Unlock()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		if len(versions) == 0 {
+			errChan <- errRoadNotFound
+			return
+		}
+		versionsChan <- versions
+	}()
+
+	select {
+	case versions := <-versionsChan:
+		for i := range versions {
+			(*model.Road)(&versions[i].Road).ConvertCRS(geo.WGS84, crs)
+		}
+		c.JSON(200, versions)
+	case err := <-errChan:
+		if errors.Is(err, errRoadNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// getRoadAsOf 返回道路在 as_of 参数指定的时间点的状态，由 GetRoad 在带有 as_of 参数时调用
+func getRoadAsOf(c *gin.Context, id string, crs geo.CRS) {
+	db := tenantDB(c)
+	t, err := parseAsOf(c.Query("as_of"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	roadID, err := strconv.ParseUint(id, 10, 0)
+	if err != nil {
+		c.JSON(404, gin.H{"error": errRoadNotFound.Error()})
+		return
+	}
+
+	roadChan := make(chan RoadAsOf)
+	errChan := make(chan error)
+
+	go func() {
+		config.DbMutex.Lock()
+		version, err := history.AsOf(db, uint(roadID), t)
+		config.DbMutex.Unlock()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		roadChan <- RoadAsOf{
+			Road:      model.Road(version.Road),
+			Version:   version.Version,
+			ChangedBy: version.ChangedBy,
+			ChangedAt: version.ChangedAt,
+		}
+	}()
+
+	select {
+	case road := <-roadChan:
+		road.ConvertCRS(geo.WGS84, crs)
+		c.JSON(200, road)
+	case err := <-errChan:
+		if errors.Is(err, history.ErrNoVersion) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// parseAsOf 解析时间点参数，格式为 RFC 3339 时间或 2006-01-02 日期，日期表示当天结束时（服务器时区）
+func parseAsOf(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("as_of must be an RFC 3339 timestamp or a date in the form 2006-01-02")
+	}
+	return date.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+// changedBy 返回发起请求的用户，作为道路版本的变更人
+func changedBy(c *gin.Context) *uint {
+	userID := middleware.GetUserID(c)
+	return &userID
+}
@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// minSegmentInterval 和 maxRoadSegments 限制自动分段的间隔和一条道路的路段数
+	minSegmentInterval = 10.0
+	maxRoadSegments    = 10000
+)
+
+var (
+	errRoadNotFound      = errors.New("no road found with given ID")
+	errRoadNoGeometry    = errors.New("road has no geometry to split")
+	errTooManySegments   = fmt.Errorf("interval is too small, a road can have at most %d segments", maxRoadSegments)
+	errSegmentNotFound   = errors.New("segment not found")
+	errSegmentsReferred  = errors.New("segments are referenced by plans, reports or assets")
+	errChainageNoSegment = errors.New("chainage requires segment_id")
+	errChainageOutside   = errors.New("chainage is outside the segment")
+)
+
+// SegmentGenerateJSON 为自动分段的请求参数，start_chainage 为道路起点的桩号，可以写作 K3+200 或以米为单位的数字
+type SegmentGenerateJSON struct {
+	Interval      float64      `json:"interval" binding:"required"`
+	StartChainage geo.Chainage `json:"start_chainage"`
+}
+
+// segmentsInUse 为路段被引用时返回的引用数
+type segmentsInUse struct {
+	Plans   int64 `json:"plans"`
+	Reports int64 `json:"reports"`
+	Assets  int64 `json:"assets"`
+}
+
+// referenced 判断路段是否被引用
+func (u segmentsInUse) referenced() bool {
+	return u.Plans > 0 || u.Reports > 0 || u.Assets > 0
+}
+
+// GetRoadSegments 获取道路的全部路段，按起点桩号排序，crs 参数指定返回的几何形状使用的坐标系
+func GetRoadSegments(c *gin.Context) {
+	db := tenantDB(c)
+	id := c.Param("id")
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+
+	segmentChan := make(chan []model.RoadSegment)
+	errChan := make(chan error)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		if _, err := findRoad(db, id); err != nil {
+			errChan <- err
+			return
+		}
+		var segments []model.RoadSegment
+		if err := db.Where("road_id = ?", id).Order("start_chainage").Find(&segments).Error; err != nil {
+			errChan <- err
+			return
+		}
+		segmentChan <- segments
+	}()
+
+	select {
+	case segments := <-segmentChan:
+		c.JSON(200, segmentsInCRS(segments, crs))
+	case err := <-errChan:
+		if errors.Is(err, errRoadNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// GenerateRoadSegments 按固定间隔（单位为米）根据道路的几何形状生成路段，替换道路原有的路段
+// 原有路段被巡检任务、报告或设施引用时不做修改，返回 409
+func GenerateRoadSegments(c *gin.Context) {
+	db := tenantDB(c)
+	id := c.Param("id")
+	var params SegmentGenerateJSON
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if params.Interval < minSegmentInterval {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("interval must be at least %g meters", minSegmentInterval)})
+		return
+	}
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+
+	segmentChan := make(chan []model.RoadSegment)
+	errChan := make(chan error)
+	inUseChan := make(chan segmentsInUse)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		road, err := findRoad(db, id)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		if road.Geometry == nil {
+			errChan <- errRoadNoGeometry
+			return
+		}
+		if road.Geometry.Length()/params.Interval > maxRoadSegments {
+			errChan <- errTooManySegments
+			return
+		}
+		if inUse, err := roadSegmentsInUse(db, road.ID); err != nil {
+			errChan <- err
+			return
+		} else if inUse.referenced() {
+			inUseChan <- inUse
+			return
+		}
+
+		segments := model.SplitRoad(&road, params.StartChainage, params.Interval)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("road_id = ?", road.ID).Delete(&model.RoadSegment{}).Error; err != nil {
+				return err
+			}
+			return tx.CreateInBatches(&segments, 500).Error
+		})
+		if err != nil {
+			errChan <- err
+			return
+		}
+		segmentChan <- segments
+	}()
+
+	select {
+	case segments := <-segmentChan:
+		c.JSON(201, segmentsInCRS(segments, crs))
+	case inUse := <-inUseChan:
+		c.JSON(409, gin.H{"error": errSegmentsReferred.Error(), "plans": inUse.Plans, "reports": inUse.Reports, "assets": inUse.Assets})
+	case err := <-errChan:
+		if errors.Is(err, errRoadNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else if errors.Is(err, errRoadNoGeometry) || errors.Is(err, errTooManySegments) {
+			c.JSON(400, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// DeleteRoadSegments 删除道路的全部路段，路段被巡检任务、报告或设施引用时返回 409
+func DeleteRoadSegments(c *gin.Context) {
+	db := tenantDB(c)
+	id := c.Param("id")
+
+	resultChan := make(chan error)
+	inUseChan := make(chan segmentsInUse)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		road, err := findRoad(db, id)
+		if err != nil {
+			resultChan <- err
+			return
+		}
+		if inUse, err := roadSegmentsInUse(db, road.ID); err != nil {
+			resultChan <- err
+			return
+		} else if inUse.referenced() {
+			inUseChan <- inUse
+			return
+		}
+		resultChan <- db.Where("road_id = ?", road.ID).Delete(&model.RoadSegment{}).Error
+	}()
+
+	select {
+	case inUse := <-inUseChan:
+		c.JSON(409, gin.H{"error": errSegmentsReferred.Error(), "plans": inUse.Plans, "reports": inUse.Reports, "assets": inUse.Assets})
+	case err := <-resultChan:
+		if errors.Is(err, errRoadNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(200, gin.H{"message": "Road segments deleted"})
+		}
+	}
+}
+
+// findRoad 按ID查找道路，调用方需持有 config.DbMutex
+func findRoad(db *gorm.DB, id string) (model.Road, error) {
+	var road model.Road
+	if err := db.Where("id = ?", id).First(&road).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return road, errRoadNotFound
+		}
+		return road, err
+	}
+	return road, nil
+}
+
+// roadSegmentsInUse 统计引用道路路段的巡检任务、报告和设施数，调用方需持有 config.DbMutex
+func roadSegmentsInUse(db *gorm.DB, roadID uint) (segmentsInUse, error) {
+	var inUse segmentsInUse
+	segmentIDs := db.Model(&model.RoadSegment{}).Select("id").Where("road_id = ?", roadID)
+	err := db.Model(&model.PlanSegment{}).Where("segment_id IN (?)", segmentIDs).
+		Distinct("plan_id").Count(&inUse.Plans).Error
+	if err != nil {
+		return inUse, err
+	}
+	err = db.Model(&model.Report{}).Where("segment_id IN (?)", segmentIDs).Count(&inUse.Reports).Error
+	if err != nil {
+		return inUse, err
+	}
+	err = db.Model(&model.Asset{}).Where("segment_id IN (?)", segmentIDs).Count(&inUse.Assets).Error
+	return inUse, err
+}
+
+// checkSegmentsExist 检查路段都存在于当前租户中，调用方需持有 config.DbMutex
+func checkSegmentsExist(db *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var found []uint
+	if err := db.Model(&model.RoadSegment{}).Where("id IN ?", ids).Pluck("id", &found).Error; err != nil {
+		return err
+	}
+	exists := make(map[uint]bool, len(found))
+	for _, id := range found {
+		exists[id] = true
+	}
+	for _, id := range ids {
+		if !exists[id] {
+			return fmt.Errorf("%w: %d", errSegmentNotFound, id)
+		}
+	}
+	return nil
+}
+
+// checkReportLocation 检查报告的发现位置，里程必须在路段的起止桩号之间，调用方需持有 config.DbMutex
+func checkReportLocation(db *gorm.DB, segmentID *uint, chainage *geo.Chainage) error {
+	if segmentID == nil {
+		if chainage != nil {
+			return errChainageNoSegment
+		}
+		return nil
+	}
+	var segment model.RoadSegment
+	if err := db.Where("id = ?", *segmentID).First(&segment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %d", errSegmentNotFound, *segmentID)
+		}
+		return err
+	}
+	if chainage != nil && !segment.Contains(*chainage) {
+		return fmt.Errorf("%w: %s is not within %s", errChainageOutside, chainage, segment.Name)
+	}
+	return nil
+}
+
+// isLocationError 判断错误是否为路段或里程无效导致的
+func isLocationError(err error) bool {
+	return errors.Is(err, errSegmentNotFound) || errors.Is(err, errChainageNoSegment) || errors.Is(err, errChainageOutside)
+}
+
+// segmentsInCRS 将以 WGS84 保存的路段转换到请求的坐标系
+func segmentsInCRS(segments []model.RoadSegment, crs geo.CRS) []model.RoadSegment {
+	if segments == nil {
+		return []model.RoadSegment{}
+	}
+	for i := range segments {
+		segments[i].ConvertCRS(geo.WGS84, crs)
+	}
+	return segments
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultNearestCount = 10
+	maxNearestCount     = 100
+	// nearestStartRadius 为查找最近道路时的初始搜索半径，找到的道路不足时每次扩大为 4 倍
+	nearestStartRadius = 1000.0
+	// maxSpatialCandidates 为一次空间查询最多从数据库读取的候选道路数，超出时要求缩小查询范围
+	maxSpatialCandidates = 10000
+)
+
+// errTooManySpatialCandidates 表示查询范围内的道路过多，无法在内存中按距离排序
+var errTooManySpatialCandidates = errors.New("too many roads in the queried area, use a smaller bbox or radius")
+
+// roadSpatialListSpec 为 GetRoads 使用空间筛选时的列表参数，筛选参数与 roadListSpec 相同
+// 结果按距离排序，游标记录上一页最后一条道路的距离和 ID
+var roadSpatialListSpec = listSpec[model.Road]{
+	filters: roadListSpec.filters,
+	sorts: map[string]listSort[model.Road]{
+		"distance": {"", func(r *model.Road) interface{} {
+			if r.Distance == nil {
+				return 0.0
+			}
+			return *r.Distance
+		}},
+	},
+	defaultSort: "distance",
+	id:          roadListSpec.id,
+}
+
+// roadSpatialQuery 为 GetRoads 的空间筛选条件，bbox、near 和 nearest 只能使用其中一种，nearest 为返回的最近道路数
+type roadSpatialQuery struct {
+	bbox    *geo.BBox
+	center  geo.Point
+	radius  float64
+	nearest int
+}
+
+// parseRoadSpatialQuery 解析请求中的空间筛选参数并转换为 WGS84，没有空间筛选时返回 nil
+func parseRoadSpatialQuery(c *gin.Context, crs geo.CRS) (*roadSpatialQuery, error) {
+	bbox, hasBBox := c.GetQuery("bbox")
+	near, hasNear := c.GetQuery("near")
+	nearest, hasNearest := c.GetQuery("nearest")
+	count := 0
+	for _, has := range []bool{hasBBox, hasNear, hasNearest} {
+		if has {
+			count++
+		}
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	if count > 1 {
+		return nil, errors.New("only one of bbox, near and nearest can be used")
+	}
+
+	q := &roadSpatialQuery{}
+	switch {
+	case hasBBox:
+		b, err := geo.ParseBBox(bbox)
+		if err != nil {
+			return nil, err
+		}
+		b = geo.ConvertBBox(b, crs, geo.WGS84)
+		q.bbox = &b
+		q.center = b.Center()
+	case hasNear:
+		center, err := geo.ParseLatLon(near)
+		if err != nil {
+			return nil, err
+		}
+		radius, err := strconv.ParseFloat(c.Query("radius"), 64)
+		if err != nil || radius <= 0 || math.IsInf(radius, 0) {
+			return nil, errors.New("radius must be a positive number of meters")
+		}
+		q.center, q.radius = geo.Convert(center, crs, geo.WGS84), radius
+	case hasNearest:
+		center, err := geo.ParseLatLon(nearest)
+		if err != nil {
+			return nil, err
+		}
+		count := defaultNearestCount
+		if s := c.Query("count"); s != "" {
+			count, err = strconv.Atoi(s)
+			if err != nil || count <= 0 || count > maxNearestCount {
+				return nil, errors.New("count must be between 1 and " + strconv.Itoa(maxNearestCount))
+			}
+		}
+		q.center, q.nearest = geo.Convert(center, crs, geo.WGS84), count
+	}
+	return q, nil
+}
+
+// find 按空间条件查询道路，结果按到查询点（bbox 时为矩形中心）的距离排序
+// 先用外包矩形字段在数据库中粗筛，再按几何形状精确计算，不依赖数据库的空间扩展
+// after 为游标中上一页最后一条道路的距离，外包矩形完全在该距离以内的道路已经返回过，在数据库中直接排除
+func (q *roadSpatialQuery) find(db *gorm.DB, after *float64) ([]model.Road, error) {
+	var closer *geo.BBox
+	if after != nil {
+		if b, ok := geo.Inside(q.center, *after); ok {
+			closer = &b
+		}
+	}
+	switch {
+	case q.bbox != nil:
+		candidates, err := roadsInBBox(db, *q.bbox, closer)
+		if err != nil {
+			return nil, err
+		}
+		roads := candidates[:0]
+		for _, road := range candidates {
+			if road.IntersectsBBox(*q.bbox) {
+				roads = append(roads, road)
+			}
+		}
+		return sortByDistance(roads, q.center), nil
+	case q.radius > 0:
+		candidates, err := roadsInBBox(db, geo.Around(q.center, q.radius), closer)
+		if err != nil {
+			return nil, err
+		}
+		return withinRadius(sortByDistance(candidates, q.center), q.radius), nil
+	default:
+		// 最近的 count 条道路需要整体确定后再分页，不能按游标排除
+		return q.findNearest(db)
+	}
+}
+
+// findNearest 逐步扩大搜索半径，直到半径内的道路数达到 count 或已经覆盖整个地球
+// 半径 r 内的道路一定在 Around(center, r) 的外包矩形中，所以半径内最近的 count 条就是全局最近的 count 条
+func (q *roadSpatialQuery) findNearest(db *gorm.DB) ([]model.Road, error) {
+	for radius := nearestStartRadius; ; radius *= 4 {
+		box := geo.Around(q.center, radius)
+		candidates, err := roadsInBBox(db, box, nil)
+		if err != nil {
+			return nil, err
+		}
+		roads := sortByDistance(candidates, q.center)
+		whole := box.MinLon == -180 && box.MaxLon == 180 && box.MinLat == -90 && box.MaxLat == 90
+		if !whole {
+			roads = withinRadius(roads, radius)
+		}
+		if len(roads) >= q.nearest || whole {
+			if len(roads) > q.nearest {
+				roads = roads[:q.nearest]
+			}
+			return roads, nil
+		}
+	}
+}
+
+// roadsInBBox 查询外包矩形与 box 相交、且不完全落在 exclude 内的道路，最多 maxSpatialCandidates 条
+// 没有坐标的道路外包矩形为 NULL，不会参与空间查询
+func roadsInBBox(db *gorm.DB, box geo.BBox, exclude *geo.BBox) ([]model.Road, error) {
+	var roads []model.Road
+	db = db.Where("max_lon >= ? AND min_lon <= ? AND max_lat >= ? AND min_lat <= ?", box.MinLon, box.MaxLon, box.MinLat, box.MaxLat)
+	if exclude != nil {
+		db = db.Where("NOT (min_lon >= ? AND max_lon <= ? AND min_lat >= ? AND max_lat <= ?)", exclude.MinLon, exclude.MaxLon, exclude.MinLat, exclude.MaxLat)
+	}
+	if err := db.Limit(maxSpatialCandidates + 1).Find(&roads).Error; err != nil {
+		return nil, err
+	}
+	if len(roads) > maxSpatialCandidates {
+		return nil, errTooManySpatialCandidates
+	}
+	return roads, nil
+}
+
+// sortByDistance 计算每条道路到 center 的距离并按距离升序排序
+func sortByDistance(roads []model.Road, center geo.Point) []model.Road {
+	for i := range roads {
+		distance := roads[i].DistanceTo(center)
+		roads[i].Distance = &distance
+	}
+	// 距离相同时按 ID 排序，使分页的游标位置确定
+	sort.Slice(roads, func(i, j int) bool {
+		if *roads[i].Distance != *roads[j].Distance {
+			return *roads[i].Distance < *roads[j].Distance
+		}
+		return roads[i].ID < roads[j].ID
+	})
+	return roads
+}
+
+// pageByDistance 对已按距离排序的空间查询结果分页，跳过游标之前的道路，每页最多 list.limit 条
+func pageByDistance(list *listQuery[model.Road], roads []model.Road) ([]model.Road, *string) {
+	if list.after != nil {
+		distance := list.afterValue.(float64)
+		start := sort.Search(len(roads), func(i int) bool {
+			d := *roads[i].Distance
+			return d > distance || (d == distance && roads[i].ID > list.after.ID)
+		})
+		roads = roads[start:]
+	}
+	if len(roads) > list.limit+1 {
+		roads = roads[:list.limit+1]
+	}
+	return list.page(roads)
+}
+
+// withinRadius 截取已按距离排序的道路中距离不超过 radius 的部分
+func withinRadius(roads []model.Road, radius float64) []model.Road {
+	n := sort.Search(len(roads), func(i int) bool {
+		return *roads[i].Distance > radius
+	})
+	return roads[:n]
+}
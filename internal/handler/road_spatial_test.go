@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/gin-gonic/gin"
+)
+
+// spatialPages 依次请求 GET /roads 的每一页，返回所有道路的名称
+func spatialPages(t *testing.T, accessToken string, query string) []string {
+	t.Helper()
+	var names []string
+	cursor := ""
+	for page := 0; page < 10; page++ {
+		path := "/roads?" + query
+		if cursor != "" {
+			path += "&cursor=" + url.QueryEscape(cursor)
+		}
+		w := doRequest("GET", path, accessToken, nil)
+		if w.Code != 200 {
+			t.Fatalf("GET %s: %d %s", path, w.Code, w.Body.String())
+		}
+		body := decode(t, w)
+		roads, _ := body["data"].([]interface{})
+		for _, road := range roads {
+			names = append(names, road.(map[string]interface{})["name"].(string))
+		}
+		next, _ := body["next_cursor"].(string)
+		if next == "" {
+			return names
+		}
+		cursor = next
+	}
+	t.Fatalf("GET /roads?%s did not finish in 10 pages", query)
+	return nil
+}
+
+func TestSpatialRoads(t *testing.T) {
+	tenantID := newTenant(t)
+	newUser(t, tenantID, "admin", "admin")
+	accessToken, _ := login(t, tenantID, "admin")
+
+	roads := []gin.H{
+		{"name": "far", "latitude": 39.92, "longitude": 116.4},
+		{"name": "third", "latitude": 39.903, "longitude": 116.4},
+		{"name": "first", "latitude": 39.901, "longitude": 116.4},
+		{"name": "second", "latitude": 39.902, "longitude": 116.4},
+		{"name": "nowhere"},
+	}
+	for _, road := range roads {
+		if w := doRequest("POST", "/road", accessToken, road); w.Code != 200 && w.Code != 201 {
+			t.Fatalf("POST /road: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	var nowhere model.Road
+	if err := tenancy.Scoped(config.DB, tenantID).Where("name = ?", "nowhere").First(&nowhere).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nowhere.Bounds(); ok {
+		t.Errorf("road without coordinates has bounds %v, want NULL", nowhere.MinLon)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"near one per page", "near=39.9,116.4&radius=1000&limit=1", []string{"first", "second", "third"}},
+		{"bbox", "bbox=116.39,39.89,116.41,39.91&limit=2", []string{"first", "second", "third"}},
+		{"nearest paged by limit", "nearest=39.9,116.4&count=4&limit=3", []string{"first", "second", "third", "far"}},
+		{"nearest default count", "nearest=39.9,116.4", []string{"first", "second", "third", "far"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := spatialPages(t, accessToken, tt.query)
+			if len(got) != len(tt.want) {
+				t.Fatalf("GET /roads?%s = %v, want %v", tt.query, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("GET /roads?%s = %v, want %v", tt.query, got, tt.want)
+				}
+			}
+		})
+	}
+
+	if w := doRequest("GET", "/roads?nearest=39.9,116.4&count=101", accessToken, nil); w.Code != 400 {
+		t.Errorf("nearest with count 101 = %d, want 400", w.Code)
+	}
+}
+
+func TestSpatialRoadsTooManyCandidates(t *testing.T) {
+	tenantID := newTenant(t)
+	newUser(t, tenantID, "admin", "admin")
+	accessToken, _ := login(t, tenantID, "admin")
+
+	roads := make([]model.Road, maxSpatialCandidates+1)
+	for i := range roads {
+		roads[i] = model.Road{Name: "crowded", Latitude: 39.9, Longitude: 116.4}
+		if err := roads[i].ApplyGeometry(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tenancy.Scoped(config.DB, tenantID).CreateInBatches(&roads, 500).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if w := doRequest("GET", "/roads?near=39.9,116.4&radius=100", accessToken, nil); w.Code != 400 {
+		t.Errorf("near over %d roads = %d %s, want 400", maxSpatialCandidates, w.Code, w.Body.String())
+	}
+	if w := doRequest("GET", "/roads?limit=1", accessToken, nil); w.Code != 200 {
+		t.Errorf("plain listing = %d, want 200", w.Code)
+	}
+}
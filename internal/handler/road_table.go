@@ -0,0 +1,478 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/history"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+	"github.com/Slinet6056/road-patrol-backend/pkg/xlsx"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxTableUpload 和 maxTableRows 限制表格导入的文件大小和数据行数，maxTableColumns 限制 XLSX 工作表的列数
+	maxTableUpload  = 16 << 20
+	maxTableRows    = 10000
+	maxTableColumns = 256
+)
+
+// roadTableFields 为表格导入支持的道路字段，默认以同名的列导入
+var roadTableFields = []string{"id", "name", "latitude", "longitude", "length", "type", "surface_material", "construction_year"}
+
+// roadTableColumns 为导入时更新已有道路所写入的字段，未映射的列保留道路原有的值
+var roadTableColumns = append([]string{"name", "latitude", "longitude", "length", "type", "surface_material", "construction_year"}, model.RoadBBoxColumns...)
+
+// rowError 描述表格导入时某一行的错误，Row 为表格中的行号（表头为第 1 行）
+type rowError struct {
+	Row    int    `json:"row"`
+	Column string `json:"column,omitempty"`
+	Error  string `json:"error"`
+}
+
+// rowResult 为表格中一行的导入结果，Action 为 create 或 update
+type rowResult struct {
+	Row    int        `json:"row"`
+	Action string     `json:"action"`
+	Road   model.Road `json:"road"`
+}
+
+// tableRow 为解析后的一行，set 记录该行中有值的字段
+type tableRow struct {
+	roadImport
+	set map[string]bool
+}
+
+// ImportRoadTable 从 CSV 或 XLSX 表格（表单字段 file）批量创建或更新道路
+// mapping 参数（表单字段或查询参数）为字段到列名的 JSON 对象，例如 {"name":"道路名称","latitude":"纬度"}，未指定的字段使用同名的列
+// match 和 crs 参数与 GeoJSON 导入相同；dry_run=true 时只校验并返回每一行将要执行的操作，不做任何修改
+// 任何一行有误时不做任何修改，返回逐行的错误
+func ImportRoadTable(c *gin.Context) {
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	userID := changedBy(c)
+	match := c.DefaultQuery("match", "id")
+	if match != "id" && match != "name" {
+		c.JSON(400, gin.H{"error": "match must be id or name"})
+		return
+	}
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "dry_run must be true or false"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxTableUpload)
+	mapping, err := parseColumnMapping(c.DefaultPostForm("mapping", c.Query("mapping")))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "file is required"})
+		return
+	}
+	rows, err := readTable(fileHeader)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if len(rows)-1 > maxTableRows {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("a table can have at most %d rows", maxTableRows)})
+		return
+	}
+	columns, err := mapColumns(rows, mapping, match)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tableRows, parseErrs := parseRoadRows(rows, columns, match, crs)
+
+	resultChan := make(chan []rowResult)
+	errChan := make(chan error)
+	invalidChan := make(chan []rowError)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		results, errs, err := resolveRoadRows(db, tableRows, match)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		// 格式错误和匹配已有道路时的错误合并为一份按行号排序的报告
+		if errs = append(parseErrs, errs...); len(errs) > 0 {
+			sort.SliceStable(errs, func(i, j int) bool { return errs[i].Row < errs[j].Row })
+			invalidChan <- errs
+			return
+		}
+		var created int64
+		for _, result := range results {
+			if result.Action == "create" {
+				created++
+			}
+		}
+		if err := checkQuota(db, tenantID, quotaRoads, created); err != nil {
+			errChan <- err
+			return
+		}
+		if dryRun {
+			resultChan <- results
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for i := range results {
+				road := &results[i].Road
+				action := model.RoadChangeUpdate
+				if results[i].Action == "create" {
+					action = model.RoadChangeCreate
+					if err := tx.Create(road).Error; err != nil {
+						return err
+					}
+				} else if err := tx.Model(road).Select(roadTableColumns).Updates(road).Error; err != nil {
+					return err
+				}
+				if err := history.RecordRoad(tx, road, action, userID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			errChan <- err
+			return
+		}
+		resultChan <- results
+	}()
+
+	select {
+	case results := <-resultChan:
+		counts := map[string]int{}
+		for i := range results {
+			counts[results[i].Action]++
+			results[i].Road.ConvertCRS(geo.WGS84, crs)
+		}
+		c.JSON(200, gin.H{
+			"dry_run": dryRun,
+			"created": counts["create"],
+			"updated": counts["update"],
+			"rows":    results,
+		})
+	case errs := <-invalidChan:
+		c.JSON(400, gin.H{"error": "Invalid rows", "errors": errs})
+	case err := <-errChan:
+		if !respondQuotaExceeded(c, err) {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// parseColumnMapping 解析字段到列名的映射，s 为空时返回空映射
+func parseColumnMapping(s string) (map[string]string, error) {
+	mapping := map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return mapping, nil
+	}
+	if err := json.Unmarshal([]byte(s), &mapping); err != nil {
+		return nil, errors.New("mapping must be a JSON object of field to column name")
+	}
+	for field := range mapping {
+		if !isRoadTableField(field) {
+			return nil, fmt.Errorf("unknown field %q in mapping, expected one of %s", field, strings.Join(roadTableFields, ", "))
+		}
+	}
+	return mapping, nil
+}
+
+func isRoadTableField(field string) bool {
+	for _, f := range roadTableFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// readTable 按扩展名读取 CSV 或 XLSX 文件的全部行
+func readTable(fileHeader *multipart.FileHeader) ([][]string, error) {
+	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	if ext != ".csv" && ext != ".xlsx" {
+		return nil, errors.New("file must be a .csv or .xlsx file")
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	if ext == ".xlsx" {
+		// 表头占一行，超出 maxTableRows 的表格不必全部读取
+		rows, err = xlsx.ReadRows(bytes.NewReader(data), int64(len(data)), maxTableRows+1, maxTableColumns)
+	} else {
+		// Excel 保存的 UTF-8 CSV 带有 BOM
+		reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+		reader.FieldsPerRecord = -1
+		rows, err = reader.ReadAll()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("the table is empty")
+	}
+	return rows, nil
+}
+
+// mapColumns 根据表头找到每个字段所在的列，列名不区分大小写
+// 映射中指定的列必须存在，没有映射的字段找不到同名的列时不导入；match=name 时必须有名称列，并忽略 id 列
+func mapColumns(rows [][]string, mapping map[string]string, match string) (map[string]int, error) {
+	header := make(map[string]int, len(rows[0]))
+	for i, name := range rows[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := header[name]; name != "" && !ok {
+			header[name] = i
+		}
+	}
+	columns := make(map[string]int)
+	for _, field := range roadTableFields {
+		name, mapped := mapping[field]
+		if !mapped {
+			name = field
+		}
+		if i, ok := header[strings.ToLower(strings.TrimSpace(name))]; ok {
+			columns[field] = i
+		} else if mapped {
+			return nil, fmt.Errorf("column %q mapped to %s not found", name, field)
+		}
+	}
+	if match == "name" {
+		delete(columns, "id")
+		if _, ok := columns["name"]; !ok {
+			return nil, errors.New("a name column is required when matching by name")
+		}
+	}
+	_, hasLat := columns["latitude"]
+	_, hasLon := columns["longitude"]
+	if hasLat != hasLon {
+		return nil, errors.New("latitude and longitude columns must be provided together")
+	}
+	return columns, nil
+}
+
+// parseRoadRows 解析并校验每一行，空行会被跳过，空单元格表示不设置该字段
+func parseRoadRows(rows [][]string, columns map[string]int, match string, crs geo.CRS) ([]tableRow, []rowError) {
+	var parsed []tableRow
+	var errs []rowError
+	keys := make(map[interface{}]int)
+	for i, cells := range rows[1:] {
+		rowNumber := i + 2
+		values := make(map[string]string, len(columns))
+		for field, column := range columns {
+			if column < len(cells) {
+				if v := strings.TrimSpace(cells[column]); v != "" {
+					values[field] = v
+				}
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		row := tableRow{roadImport: roadImport{index: rowNumber}, set: make(map[string]bool, len(values))}
+		road := &row.road
+		fail := func(field, format string, args ...interface{}) {
+			errs = append(errs, rowError{Row: rowNumber, Column: field, Error: fmt.Sprintf(format, args...)})
+		}
+		valid := true
+		for _, field := range roadTableFields {
+			v, ok := values[field]
+			if !ok {
+				continue
+			}
+			switch field {
+			case "id":
+				id, err := strconv.ParseUint(v, 10, 32)
+				if err != nil || id == 0 {
+					fail(field, "%q is not a valid road ID", v)
+					valid = false
+					continue
+				}
+				row.key = id
+			case "name":
+				road.Name = v
+				if match == "name" {
+					row.key = v
+				}
+			case "latitude", "longitude":
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+					fail(field, "%q is not a number", v)
+					valid = false
+					continue
+				}
+				if field == "latitude" {
+					road.Latitude = f
+				} else {
+					road.Longitude = f
+				}
+			case "length":
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					fail(field, "%q is not a number", v)
+					valid = false
+					continue
+				}
+				road.Length = f
+			case "type":
+				road.Type = v
+			case "surface_material":
+				road.SurfaceMaterial = v
+			case "construction_year":
+				// XLSX 中的数字可能带有小数部分，例如 2005.0
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil || f != math.Trunc(f) || math.Abs(f) > math.MaxInt32 {
+					fail(field, "%q is not a year", v)
+					valid = false
+					continue
+				}
+				road.ConstructionYear = int(f)
+			}
+			row.set[field] = true
+		}
+		if fieldErrs := road.Validate(); len(fieldErrs) > 0 {
+			errs = append(errs, fieldRowErrors(rowNumber, fieldErrs)...)
+			valid = false
+		}
+		if row.set["latitude"] != row.set["longitude"] {
+			fail("", "latitude and longitude must be provided together")
+			valid = false
+		} else if row.set["latitude"] {
+			road.ConvertCRS(crs, geo.WGS84)
+		}
+		if row.key != nil {
+			if first, ok := keys[row.key]; ok {
+				fail(match, "duplicate %s %v, first used in row %d", match, row.key, first)
+				valid = false
+			} else {
+				keys[row.key] = rowNumber
+			}
+		}
+		if valid {
+			parsed = append(parsed, row)
+		}
+	}
+	return parsed, errs
+}
+
+// fieldRowErrors 将一行的字段校验错误按字段在表格中的顺序转换为 rowError
+func fieldRowErrors(rowNumber int, fieldErrs model.FieldErrors) []rowError {
+	var errs []rowError
+	for _, field := range roadTableFields {
+		if message, ok := fieldErrs[field]; ok {
+			errs = append(errs, rowError{Row: rowNumber, Column: field, Error: message})
+		}
+	}
+	return errs
+}
+
+// resolveRoadRows 将每一行的类型和路面材料与租户词表比对，查找对应的已有道路，并将行中有值的字段合并到已有道路上
+// 调用方需持有 config.DbMutex
+func resolveRoadRows(db *gorm.DB, rows []tableRow, match string) ([]rowResult, []rowError, error) {
+	vocabulary, err := loadVocabulary(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	results := make([]rowResult, 0, len(rows))
+	var errs []rowError
+	for i := range rows {
+		row := &rows[i]
+		fieldErrs := model.FieldErrors{}
+		if vocabulary.NormalizeRoad(&row.road, fieldErrs); len(fieldErrs) > 0 {
+			errs = append(errs, fieldRowErrors(row.index, fieldErrs)...)
+			continue
+		}
+		if err := resolveRoadImport(db, &row.roadImport, match); err != nil {
+			if !errors.Is(err, errRoadImportKey) {
+				return nil, nil, err
+			}
+			errs = append(errs, rowError{Row: row.index, Column: match, Error: err.Error()})
+			continue
+		}
+
+		road := row.road
+		action := "create"
+		if road.ID != 0 {
+			action = "update"
+			var existing model.Road
+			if err := db.Where("id = ?", road.ID).First(&existing).Error; err != nil {
+				return nil, nil, err
+			}
+			if existing.Geometry != nil && (row.set["latitude"] || row.set["length"]) {
+				errs = append(errs, rowError{Row: row.index, Error: "coordinates and length of a road with geometry are computed from the geometry"})
+				continue
+			}
+			road = mergeRoadRow(existing, row.road, row.set)
+		} else if road.Name == "" {
+			errs = append(errs, rowError{Row: row.index, Column: "name", Error: "name is required for a new road"})
+			continue
+		}
+		if err := road.ApplyGeometry(); err != nil {
+			errs = append(errs, rowError{Row: row.index, Error: err.Error()})
+			continue
+		}
+		results = append(results, rowResult{Row: row.index, Action: action, Road: road})
+	}
+	return results, errs, nil
+}
+
+// mergeRoadRow 将行中有值的字段写入已有道路
+func mergeRoadRow(existing, road model.Road, set map[string]bool) model.Road {
+	if set["name"] {
+		existing.Name = road.Name
+	}
+	if set["latitude"] {
+		existing.Latitude, existing.Longitude = road.Latitude, road.Longitude
+	}
+	if set["length"] {
+		existing.Length = road.Length
+	}
+	if set["type"] {
+		existing.Type = road.Type
+	}
+	if set["surface_material"] {
+		existing.SurfaceMaterial = road.SurfaceMaterial
+	}
+	if set["construction_year"] {
+		existing.ConstructionYear = road.ConstructionYear
+	}
+	return existing
+}
@@ -0,0 +1,276 @@
+package handler
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/rbac"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errRoleNameTaken = errors.New("role name already exists")
+
+type RoleDetail struct {
+	model.Role
+	Permissions []string `json:"permissions"`
+	Builtin     bool     `json:"builtin"`
+}
+
+type RoleDetailJSON struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// Validate 检查角色名称和权限是否合法
+func (r *RoleDetailJSON) Validate() error {
+	if r.Name == "" {
+		return errors.New("role name is required")
+	}
+	if rbac.IsBuiltinRole(r.Name) {
+		return errors.New("role name is reserved for a builtin role")
+	}
+	for _, p := range r.Permissions {
+		if !rbac.IsValidPermission(p) {
+			return errors.New("unknown permission: " + p)
+		}
+	}
+	return nil
+}
+
+// checkRoleNameFree 检查租户内没有其他角色使用该名称，exceptID 为正在修改的角色ID
+func checkRoleNameFree(tx *gorm.DB, name string, exceptID uint) error {
+	var count int64
+	if err := tx.Model(&model.Role{}).Where("name = ? AND id <> ?", name, exceptID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errRoleNameTaken
+	}
+	return nil
+}
+
+func toRolePermissions(roleID uint, permissions []string) []model.RolePermission {
+	seen := make(map[string]bool)
+	rows := make([]model.RolePermission, 0, len(permissions))
+	for _, p := range permissions {
+		if !seen[p] {
+			seen[p] = true
+			rows = append(rows, model.RolePermission{RoleID: roleID, Permission: p})
+		}
+	}
+	return rows
+}
+
+func toRoleDetail(role model.Role) RoleDetail {
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		permissions = append(permissions, p.Permission)
+	}
+	sort.Strings(permissions)
+	return RoleDetail{Role: role, Permissions: permissions}
+}
+
+// GetPermissions 获取所有可分配的权限
+func GetPermissions(c *gin.Context) {
+	c.JSON(200, rbac.Permissions)
+}
+
+// GetRoles 获取租户内的全部角色（包括内置角色）及其权限
+func GetRoles(c *gin.Context) {
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+
+	var roles []model.Role
+	config.DbMutex.Lock()
+	result := db.Preload("Permissions").Find(&roles)
+	config.DbMutex.Unlock()
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	builtinNames := make([]string, 0, len(rbac.BuiltinRoles))
+	for name := range rbac.BuiltinRoles {
+		builtinNames = append(builtinNames, name)
+	}
+	sort.Strings(builtinNames)
+
+	roleDetails := make([]RoleDetail, 0, len(builtinNames)+len(roles))
+	for _, name := range builtinNames {
+		roleDetails = append(roleDetails, RoleDetail{
+			Role:        model.Role{TenantID: tenantID, Name: name},
+			Permissions: rbac.BuiltinRoles[name],
+			Builtin:     true,
+		})
+	}
+	for _, role := range roles {
+		roleDetails = append(roleDetails, toRoleDetail(role))
+	}
+
+	c.JSON(200, roleDetails)
+}
+
+// AddRole 添加新的自定义角色
+func AddRole(c *gin.Context) {
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	var roleJSON RoleDetailJSON
+	if err := c.ShouldBindJSON(&roleJSON); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := roleJSON.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := model.Role{TenantID: tenantID, Name: roleJSON.Name, Description: roleJSON.Description}
+	config.DbMutex.Lock()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkRoleNameFree(tx, role.Name, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		role.Permissions = toRolePermissions(role.ID, roleJSON.Permissions)
+		if len(role.Permissions) == 0 {
+			return nil
+		}
+		return tx.Create(&role.Permissions).Error
+	})
+	config.DbMutex.Unlock()
+	if err != nil {
+		if errors.Is(err, errRoleNameTaken) {
+			c.JSON(409, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	rbac.Invalidate(tenantID)
+
+	c.JSON(201, toRoleDetail(role))
+}
+
+// UpdateRole 更新自定义角色的名称、描述和权限
+func UpdateRole(c *gin.Context) {
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+	var roleJSON RoleDetailJSON
+	if err := c.ShouldBindJSON(&roleJSON); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := roleJSON.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var role model.Role
+	config.DbMutex.Lock()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", id).First(&role).Error; err != nil {
+			return err
+		}
+		if err := checkRoleNameFree(tx, roleJSON.Name, role.ID); err != nil {
+			return err
+		}
+		oldName := role.Name
+		role.Name = roleJSON.Name
+		role.Description = roleJSON.Description
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		// 重命名角色时同步更新已分配该角色的用户
+		if oldName != role.Name {
+			if err := tx.Model(&model.User{}).Where("role = ?", oldName).Update("role", role.Name).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("role_id = ?", role.ID).Delete(&model.RolePermission{}).Error; err != nil {
+			return err
+		}
+		role.Permissions = toRolePermissions(role.ID, roleJSON.Permissions)
+		if len(role.Permissions) == 0 {
+			return nil
+		}
+		return tx.Create(&role.Permissions).Error
+	})
+	config.DbMutex.Unlock()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "no role found with given ID"})
+		} else if errors.Is(err, errRoleNameTaken) {
+			c.JSON(409, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	rbac.Invalidate(tenantID)
+
+	c.JSON(200, toRoleDetail(role))
+}
+
+// DeleteRole 删除自定义角色，仍有用户使用该角色时拒绝删除
+func DeleteRole(c *gin.Context) {
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+
+	var role model.Role
+	config.DbMutex.Lock()
+	result := db.Where("id = ?", id).First(&role)
+	config.DbMutex.Unlock()
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "no role found with given ID"})
+		} else {
+			c.JSON(500, gin.H{"error": result.Error.Error()})
+		}
+		return
+	}
+
+	var userCount int64
+	config.DbMutex.Lock()
+	db.Model(&model.User{}).Where("role = ?", role.Name).Count(&userCount)
+	config.DbMutex.Unlock()
+	if userCount > 0 {
+		c.JSON(409, gin.H{"error": "role is still assigned to users", "users": userCount})
+		return
+	}
+
+	config.DbMutex.Lock()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.ID).Delete(&model.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	config.DbMutex.Unlock()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	rbac.Invalidate(tenantID)
+
+	c.JSON(200, gin.H{"message": "Role deleted"})
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/rbac"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPermissionDenied(t *testing.T) {
+	tenantID := newTenant(t)
+	newUser(t, tenantID, "admin", "admin")
+	newUser(t, tenantID, "inspector", "inspector")
+	newUser(t, tenantID, "viewer", "viewer")
+	adminToken, _ := login(t, tenantID, "admin")
+
+	if w := doRequest("POST", "/role", adminToken, gin.H{"name": "viewer", "permissions": []string{rbac.RoadRead}}); w.Code != 201 {
+		t.Fatalf("POST /role: %d %s", w.Code, w.Body.String())
+	}
+	inspectorToken, _ := login(t, tenantID, "inspector")
+	viewerToken, _ := login(t, tenantID, "viewer")
+
+	tests := []struct {
+		name        string
+		accessToken string
+		method      string
+		path        string
+		body        interface{}
+		want        int
+	}{
+		{"inspector reads roads", inspectorToken, "GET", "/roads", nil, 200},
+		{"inspector cannot add roads", inspectorToken, "POST", "/road", gin.H{"name": "road"}, 403},
+		{"inspector cannot add users", inspectorToken, "POST", "/user", gin.H{"username": "u", "password": "Denied-Test-2024", "role": "inspector"}, 403},
+		{"inspector cannot manage roles", inspectorToken, "POST", "/role", gin.H{"name": "custom"}, 403},
+		{"inspector cannot manage tenants", inspectorToken, "POST", "/tenant", gin.H{"name": "other"}, 403},
+		{"admin cannot manage tenants", adminToken, "POST", "/tenant", gin.H{"name": "other"}, 403},
+		{"custom role reads roads", viewerToken, "GET", "/roads", nil, 200},
+		{"custom role cannot read users", viewerToken, "GET", "/users", nil, 403},
+		{"custom role cannot add plans", viewerToken, "POST", "/plan", gin.H{"status": "pending"}, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(tt.method, tt.path, tt.accessToken, tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.want)
+			}
+			if tt.want == 403 {
+				if body := decode(t, w); body["required_permission"] == nil {
+					t.Errorf("403 response has no required_permission: %s", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRoleNameTaken(t *testing.T) {
+	tenantID := newTenant(t)
+	newUser(t, tenantID, "admin", "admin")
+	accessToken, _ := login(t, tenantID, "admin")
+
+	if w := doRequest("POST", "/role", accessToken, gin.H{"name": "surveyor"}); w.Code != 201 {
+		t.Fatalf("POST /role: %d %s", w.Code, w.Body.String())
+	}
+	w := doRequest("POST", "/role", accessToken, gin.H{"name": "auditor"})
+	if w.Code != 201 {
+		t.Fatalf("POST /role: %d %s", w.Code, w.Body.String())
+	}
+	auditorID := uintString(uint(decode(t, w)["id"].(float64)))
+
+	if w := doRequest("POST", "/role", accessToken, gin.H{"name": "surveyor"}); w.Code != 409 {
+		t.Errorf("POST /role with a taken name = %d %s, want 409", w.Code, w.Body.String())
+	}
+	if w := doRequest("PUT", "/role/"+auditorID, accessToken, gin.H{"name": "surveyor"}); w.Code != 409 {
+		t.Errorf("PUT /role/%s to a taken name = %d %s, want 409", auditorID, w.Code, w.Body.String())
+	}
+	if w := doRequest("PUT", "/role/"+auditorID, accessToken, gin.H{"name": "auditor", "description": "unchanged name"}); w.Code != 200 {
+		t.Errorf("PUT /role/%s keeping its name = %d %s, want 200", auditorID, w.Code, w.Body.String())
+	}
+
+	// 其他租户可以使用相同的角色名
+	otherID := newTenant(t)
+	newUser(t, otherID, "admin", "admin")
+	otherToken, _ := login(t, otherID, "admin")
+	if w := doRequest("POST", "/role", otherToken, gin.H{"name": "surveyor"}); w.Code != 201 {
+		t.Errorf("POST /role in another tenant = %d %s, want 201", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/Slinet6056/road-patrol-backend/pkg/middleware"
+	"github.com/Slinet6056/road-patrol-backend/pkg/token"
+	"github.com/gin-gonic/gin"
+)
+
+var errRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// issueTokens 为用户签发访问令牌和刷新令牌并持久化刷新令牌
+// familyID 为空时开启一个新的会话，否则在原会话中轮换
+func issueTokens(user model.User, familyID string) (gin.H, error) {
+	if familyID == "" {
+		familyID = token.NewID()
+	}
+
+	accessClaims := token.NewClaims(user, token.TypeAccess, token.AccessTokenTTL)
+	accessClaims.SessionID = familyID
+	accessToken, err := token.Sign(accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshClaims := token.NewClaims(user, token.TypeRefresh, token.RefreshTokenTTL)
+	refreshClaims.SessionID = familyID
+	refreshToken, err := token.Sign(refreshClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	db := tenancy.Scoped(config.DB, user.TenantID)
+	config.DbMutex.Lock()
+	// 顺带清理该用户已过期的刷新令牌
+	if err := db.Where("user_id = ? AND expires_at < ?", user.ID, time.Now()).Delete(&model.RefreshToken{}).Error; err != nil {
+		logger.Error("Failed to delete expired refresh tokens: " + err.Error())
+	}
+	err = db.Create(&model.RefreshToken{
+		UserID:    user.ID,
+		TokenID:   refreshClaims.ID,
+		FamilyID:  familyID,
+		ExpiresAt: refreshClaims.ExpiresAt.Time,
+	}).Error
+	config.DbMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"username":     user.Username,
+		"roles":        []string{user.Role},
+		"accessToken":  accessToken,
+		"refreshToken": refreshToken,
+		"expires":      accessClaims.ExpiresAt.Format("2006/01/02 15:04:05"),
+	}, nil
+}
+
+// rotateRefreshToken 校验刷新令牌仍然有效并将其标记为已轮换
+// 已轮换或已吊销的令牌再次出现时，吊销整个令牌族
+func rotateRefreshToken(claims *token.Claims) error {
+	var stored model.RefreshToken
+	db := tenancy.Scoped(config.DB, claims.TenantID)
+	config.DbMutex.Lock()
+	defer config.DbMutex.Unlock()
+
+	if err := db.Where("token_id = ? AND user_id = ?", claims.ID, claims.UserID).First(&stored).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result := db.Model(&model.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", stored.ID).
+		Updates(map[string]interface{}{"revoked_at": now, "rotated": true})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// 因注销或修改密码而吊销的令牌直接拒绝，只有已轮换的令牌再次出现才视为重放
+		if !stored.Rotated {
+			return errors.New("refresh token has been revoked")
+		}
+		db.Model(&model.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", stored.FamilyID).
+			Update("revoked_at", now)
+		return errRefreshTokenReused
+	}
+	return nil
+}
+
+// revokeFamily 吊销一个会话的全部刷新令牌
+func revokeFamily(tenantID uint, familyID string) error {
+	config.DbMutex.Lock()
+	defer config.DbMutex.Unlock()
+	return tenancy.Scoped(config.DB, tenantID).Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeUserSessions 吊销用户除 exceptFamilyID 之外的全部会话
+func revokeUserSessions(tenantID uint, userID uint, exceptFamilyID string) error {
+	config.DbMutex.Lock()
+	defer config.DbMutex.Unlock()
+	query := tenancy.Scoped(config.DB, tenantID).Model(&model.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptFamilyID != "" {
+		query = query.Where("family_id <> ?", exceptFamilyID)
+	}
+	return query.Update("revoked_at", time.Now()).Error
+}
+
+// Logout 注销当前会话，吊销所提交刷新令牌所在的令牌族
+func Logout(c *gin.Context) {
+	var tokenParams struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&tokenParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	claims, err := token.Parse(tokenParams.RefreshToken, token.TypeRefresh)
+	if err != nil || claims.SessionID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Invalid or expired refresh token"})
+		return
+	}
+
+	if err := revokeFamily(claims.TenantID, claims.SessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+		logger.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// LogoutAll 注销当前用户的全部会话
+func LogoutAll(c *gin.Context) {
+	tenantID, ok := middleware.GetTenantID(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+		logger.Error(tenancy.ErrNoTenant.Error())
+		return
+	}
+	if err := revokeUserSessions(tenantID, middleware.GetUserID(c), ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+		logger.Error(err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// refresh 使用刷新令牌换取新令牌，返回状态码和新的刷新令牌
+func refresh(t *testing.T, refreshToken string) (int, string) {
+	t.Helper()
+	w := doRequest("POST", "/refresh-token", "", gin.H{"refreshToken": refreshToken})
+	if w.Code != 200 {
+		return w.Code, ""
+	}
+	data, _ := decode(t, w)["data"].(map[string]interface{})
+	newToken, _ := data["refreshToken"].(string)
+	return w.Code, newToken
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	tenantID := newTenant(t)
+	newUser(t, tenantID, "rotator", "inspector")
+	_, first := login(t, tenantID, "rotator")
+
+	code, second := refresh(t, first)
+	if code != 200 || second == "" {
+		t.Fatalf("refresh with a fresh token = %d, want 200 and a new token", code)
+	}
+
+	// 已轮换的令牌再次出现视为重放，整个令牌族被吊销
+	if code, _ := refresh(t, first); code != 401 {
+		t.Errorf("reusing a rotated refresh token = %d, want 401", code)
+	}
+	if code, _ := refresh(t, second); code != 401 {
+		t.Errorf("refresh after reuse was detected = %d, want 401", code)
+	}
+
+	// 其他会话不受影响
+	_, other := login(t, tenantID, "rotator")
+	if code, _ := refresh(t, other); code != 200 {
+		t.Errorf("refresh in another session = %d, want 200", code)
+	}
+}
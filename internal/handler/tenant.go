@@ -0,0 +1,345 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/rbac"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/Slinet6056/road-patrol-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// conflictingTenant 检查请求体中显式传入的 tenant_id 是否与令牌中的租户冲突，冲突时直接返回 403
+func conflictingTenant(c *gin.Context, tenantID uint) bool {
+	if current, _ := middleware.GetTenantID(c); tenantID != 0 && tenantID != current {
+		c.JSON(403, gin.H{"error": "tenant_id does not match the token"})
+		return true
+	}
+	return false
+}
+
+var (
+	errTenantNotFound     = errors.New("no tenant found with given ID")
+	errTenantNameTaken    = errors.New("tenant name already exists")
+	errTenantNotSuspended = errors.New("tenant must be suspended before it can be deleted")
+)
+
+// TenantJSON 定义创建租户时的请求参数，可以同时创建该租户的第一个管理员
+type TenantJSON struct {
+	Name          string `json:"name" binding:"required"`
+	AdminUsername string `json:"admin_username"`
+	AdminPassword string `json:"admin_password"`
+	AdminEmail    string `json:"admin_email"`
+}
+
+// rejectInactiveTenant 检查用户所属租户是否处于启用状态，否则直接返回 403
+func rejectInactiveTenant(c *gin.Context, tenantID uint) bool {
+	err := tenancy.CheckActive(tenantID)
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, tenancy.ErrTenantSuspended) || errors.Is(err, tenancy.ErrTenantNotFound) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "租户已停用"})
+		logger.Warn("Rejected login for tenant ", strconv.FormatUint(uint64(tenantID), 10), ": ", err.Error())
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+		logger.Error(err.Error())
+	}
+	return true
+}
+
+// GetTenants 获取所有租户
+func GetTenants(c *gin.Context) {
+	tenantsChan := make(chan []model.Tenant)
+	errChan := make(chan error)
+
+	go func() {
+		var tenants []model.Tenant
+		config.DbMutex.Lock()
+		result := config.DB.Order("id").Find(&tenants)
+		config.DbMutex.Unlock()
+		if result.Error != nil {
+			errChan <- result.Error
+			return
+		}
+		tenantsChan <- tenants
+	}()
+
+	select {
+	case tenants := <-tenantsChan:
+		c.JSON(200, tenants)
+	case err := <-errChan:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// AddTenant 创建新的租户，提供管理员用户名和密码时同时创建该租户的管理员
+func AddTenant(c *gin.Context) {
+	var tenantJSON TenantJSON
+	if err := c.ShouldBindJSON(&tenantJSON); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var admin *model.User
+	if tenantJSON.AdminUsername != "" || tenantJSON.AdminPassword != "" {
+		if tenantJSON.AdminUsername == "" || tenantJSON.AdminPassword == "" {
+			c.JSON(400, gin.H{"error": "admin_username and admin_password must be provided together"})
+			return
+		}
+		user, err := (&UserJSON{
+			Username: tenantJSON.AdminUsername,
+			Password: tenantJSON.AdminPassword,
+			Role:     "admin",
+			Email:    tenantJSON.AdminEmail,
+		}).ToUser()
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		admin = &user
+	}
+
+	tenant := model.Tenant{
+		Name:           tenantJSON.Name,
+		Status:         model.TenantActive,
+		CreatedBy:      middleware.GetUserID(c),
+		MaxUsers:       config.QuotaMaxUsers,
+		MaxRoads:       config.QuotaMaxRoads,
+		MaxActivePlans: config.QuotaMaxActivePlans,
+	}
+
+	tenantChan := make(chan model.Tenant)
+	errChan := make(chan error)
+
+	go func() {
+		config.DbMutex.Lock()
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			var count int64
+			if err := tx.Model(&model.Tenant{}).Where("name = ?", tenant.Name).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return errTenantNameTaken
+			}
+			if err := tx.Create(&tenant).Error; err != nil {
+				return err
+			}
+			if err := seedVocabulary(tenancy.Scoped(tx, tenant.ID)); err != nil {
+				return err
+			}
+			if admin != nil {
+				return tenancy.Scoped(tx, tenant.ID).Create(admin).Error
+			}
+			return nil
+		})
+		config.DbMutex.Unlock()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		tenantChan <- tenant
+	}()
+
+	select {
+	case createdTenant := <-tenantChan:
+		c.JSON(201, createdTenant)
+	case err := <-errChan:
+		if errors.Is(err, errTenantNameTaken) {
+			c.JSON(409, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// UpdateTenant 修改租户名称
+func UpdateTenant(c *gin.Context) {
+	var params struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant, err := updateTenant(c.Param("id"), func(tx *gorm.DB, tenant *model.Tenant) error {
+		var count int64
+		if err := tx.Model(&model.Tenant{}).Where("name = ? AND id <> ?", params.Name, tenant.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errTenantNameTaken
+		}
+		tenant.Name = params.Name
+		return tx.Model(tenant).Update("name", params.Name).Error
+	})
+	respondTenant(c, tenant, err)
+}
+
+// SuspendTenant 停用租户，该租户的用户无法登录，已签发的令牌立即失效
+func SuspendTenant(c *gin.Context) {
+	tenant, err := updateTenant(c.Param("id"), func(tx *gorm.DB, tenant *model.Tenant) error {
+		tenant.Status = model.TenantSuspended
+		if err := tx.Model(tenant).Update("status", model.TenantSuspended).Error; err != nil {
+			return err
+		}
+		return tenancy.Scoped(tx, tenant.ID).Model(&model.RefreshToken{}).
+			Where("revoked_at IS NULL").
+			Update("revoked_at", time.Now()).Error
+	})
+	if err == nil {
+		logger.Info("Tenant ", strconv.FormatUint(uint64(tenant.ID), 10), " suspended by user ", middleware.GetUsername(c))
+	}
+	respondTenant(c, tenant, err)
+}
+
+// ActivateTenant 重新启用被停用的租户
+func ActivateTenant(c *gin.Context) {
+	tenant, err := updateTenant(c.Param("id"), func(tx *gorm.DB, tenant *model.Tenant) error {
+		tenant.Status = model.TenantActive
+		return tx.Model(tenant).Update("status", model.TenantActive).Error
+	})
+	if err == nil {
+		logger.Info("Tenant ", strconv.FormatUint(uint64(tenant.ID), 10), " activated by user ", middleware.GetUsername(c))
+	}
+	respondTenant(c, tenant, err)
+}
+
+// DeleteTenant 删除租户及其全部数据，只能删除已停用的租户
+func DeleteTenant(c *gin.Context) {
+	id := c.Param("id")
+
+	resultChan := make(chan error)
+
+	go func() {
+		config.DbMutex.Lock()
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			var tenant model.Tenant
+			if err := tx.Where("id = ?", id).First(&tenant).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errTenantNotFound
+				}
+				return err
+			}
+			if tenant.Status != model.TenantSuspended {
+				return errTenantNotSuspended
+			}
+			return deleteTenantData(tx, tenant.ID)
+		})
+		config.DbMutex.Unlock()
+		resultChan <- err
+	}()
+
+	if err := <-resultChan; err != nil {
+		if errors.Is(err, errTenantNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else if errors.Is(err, errTenantNotSuspended) {
+			c.JSON(409, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if tenantID, err := strconv.ParseUint(id, 10, 32); err == nil {
+		tenancy.Invalidate(uint(tenantID))
+		rbac.Invalidate(uint(tenantID))
+	}
+	logger.Info("Tenant ", id, " deleted by user ", middleware.GetUsername(c))
+
+	c.JSON(200, gin.H{"message": "Tenant deleted"})
+}
+
+// deleteTenantData 删除租户本身及其名下的全部数据
+func deleteTenantData(tx *gorm.DB, tenantID uint) error {
+	db := tenancy.Scoped(tx, tenantID)
+	err := db.Where("role_id IN (?)", db.Model(&model.Role{}).Select("id")).
+		Delete(&model.RolePermission{}).Error
+	if err != nil {
+		return err
+	}
+	// 租户限定的会话会自动为每条删除语句加上 tenant_id 条件
+	for _, table := range []interface{}{
+		&model.PlanRoad{}, &model.PlanSegment{}, &model.ReportAsset{}, &model.Report{}, &model.Plan{},
+		&model.Asset{}, &model.RoadSegment{}, &model.Road{}, &model.RoadVersion{}, &model.Zone{},
+		&model.VocabularyTerm{}, &model.RefreshToken{}, &model.RecoveryCode{}, &model.PasswordResetToken{},
+		&model.Role{}, &model.TenantSetting{}, &model.User{},
+	} {
+		if err := db.Delete(table).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&model.Tenant{}, tenantID).Error
+}
+
+// updateTenant 读取租户并在事务中执行修改，修改后清除租户状态缓存
+func updateTenant(id string, update func(tx *gorm.DB, tenant *model.Tenant) error) (model.Tenant, error) {
+	var tenant model.Tenant
+
+	resultChan := make(chan error)
+
+	go func() {
+		config.DbMutex.Lock()
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("id = ?", id).First(&tenant).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errTenantNotFound
+				}
+				return err
+			}
+			return update(tx, &tenant)
+		})
+		config.DbMutex.Unlock()
+		resultChan <- err
+	}()
+
+	err := <-resultChan
+	if err == nil {
+		tenancy.Invalidate(tenant.ID)
+	}
+	return tenant, err
+}
+
+// respondTenant 返回修改后的租户或对应的错误
+func respondTenant(c *gin.Context, tenant model.Tenant, err error) {
+	switch {
+	case err == nil:
+		c.JSON(200, tenant)
+	case errors.Is(err, errTenantNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, errTenantNameTaken):
+		c.JSON(409, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// tenantDB 返回限定在当前请求租户内的数据库会话
+// 请求中没有租户时不回退到平台租户，返回的会话上的所有操作都会以 tenancy.ErrNoTenant 失败
+func tenantDB(c *gin.Context) *gorm.DB {
+	tenantID, ok := middleware.GetTenantID(c)
+	if !ok {
+		db := config.DB.Session(&gorm.Session{})
+		_ = db.AddError(tenancy.ErrNoTenant)
+		return db
+	}
+	return tenancy.Scoped(config.DB, tenantID)
+}
+
+// requestTenant 返回当前请求的租户ID，请求中没有租户时（路由缺少 JWTAuth）返回 500
+func requestTenant(c *gin.Context) (uint, bool) {
+	tenantID, ok := middleware.GetTenantID(c)
+	if !ok {
+		c.JSON(500, gin.H{"error": tenancy.ErrNoTenant.Error()})
+		logger.Error("No tenant in request context for ", c.FullPath())
+	}
+	return tenantID, ok
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTenantDBWithoutTenant(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/roads", nil)
+
+	var roads []model.Road
+	if err := tenantDB(c).Find(&roads).Error; !errors.Is(err, tenancy.ErrNoTenant) {
+		t.Errorf("tenantDB().Find() error = %v, want ErrNoTenant", err)
+	}
+	var tenants []model.Tenant
+	if err := tenantDB(c).Find(&tenants).Error; !errors.Is(err, tenancy.ErrNoTenant) {
+		t.Errorf("tenantDB().Find() on an unscoped table error = %v, want ErrNoTenant", err)
+	}
+	if _, ok := requestTenant(c); ok || w.Code != 500 {
+		t.Errorf("requestTenant() = %v with status %d, want false with 500", ok, w.Code)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	tenantA, tenantB := newTenant(t), newTenant(t)
+	newUser(t, tenantA, "admin", "admin")
+	newUser(t, tenantB, "admin", "admin")
+	tokenA, _ := login(t, tenantA, "admin")
+	tokenB, _ := login(t, tenantB, "admin")
+
+	w := doRequest("POST", "/road", tokenA, gin.H{"name": "tenant A road", "latitude": 39.9, "longitude": 116.4})
+	if w.Code != 201 && w.Code != 200 {
+		t.Fatalf("POST /road: %d %s", w.Code, w.Body.String())
+	}
+	roadID := strconv.FormatFloat(decode(t, w)["id"].(float64), 'f', 0, 64)
+
+	if w := doRequest("GET", "/road/"+roadID, tokenA, nil); w.Code != 200 {
+		t.Errorf("owner GET /road/%s = %d, want 200", roadID, w.Code)
+	}
+	if w := doRequest("GET", "/road/"+roadID, tokenB, nil); w.Code != 404 {
+		t.Errorf("other tenant GET /road/%s = %d, want 404", roadID, w.Code)
+	}
+	w = doRequest("GET", "/roads", tokenA, nil)
+	if roads, _ := decode(t, w)["data"].([]interface{}); w.Code != 200 || len(roads) != 1 {
+		t.Errorf("owner GET /roads = %d %s, want one road", w.Code, w.Body.String())
+	}
+	w = doRequest("GET", "/roads", tokenB, nil)
+	if roads, ok := decode(t, w)["data"].([]interface{}); w.Code != 200 || !ok || len(roads) != 0 {
+		t.Errorf("other tenant GET /roads = %d %s, want no roads", w.Code, w.Body.String())
+	}
+
+	// 租户只能来自令牌，显式传入其他租户视为越权
+	otherTenant := uintString(tenantB)
+	if w := doRequest("GET", "/roads?tenant_id="+otherTenant, tokenA, nil); w.Code != 403 {
+		t.Errorf("GET /roads?tenant_id=%s = %d, want 403", otherTenant, w.Code)
+	}
+	if w := doRequest("POST", "/road", tokenA, gin.H{"name": "smuggled", "tenant_id": tenantB}); w.Code != 403 {
+		t.Errorf("POST /road with tenant_id %d = %d, want 403", tenantB, w.Code)
+	}
+}
@@ -4,16 +4,61 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/Slinet6056/road-patrol-backend/internal/config"
 	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/rbac"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
 	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/Slinet6056/road-patrol-backend/pkg/password"
+	"github.com/Slinet6056/road-patrol-backend/pkg/token"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
+type UserJSON struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+}
+
+// ToUser 将请求体转换为用户模型，非空的密码会被哈希后保存
+func (u *UserJSON) ToUser() (model.User, error) {
+	user := model.User{
+		Username: u.Username,
+		Role:     u.Role,
+		Email:    u.Email,
+		Phone:    u.Phone,
+	}
+	if u.Password != "" {
+		if err := password.Validate(u.Password, u.Username); err != nil {
+			return model.User{}, err
+		}
+		hashed, err := password.Hash(u.Password)
+		if err != nil {
+			return model.User{}, err
+		}
+		user.Password = hashed
+	}
+	return user, nil
+}
+
+// validRole 检查角色在租户内是否存在，不存在时直接返回 400
+func validRole(c *gin.Context, tenantID uint, role string) bool {
+	exists, err := rbac.RoleExists(tenantID, role)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return false
+	}
+	if !exists {
+		c.JSON(400, gin.H{"error": "Unknown role: " + role})
+		return false
+	}
+	return true
+}
+
 // Login 用户登录
 func Login(c *gin.Context) {
 	var loginParams struct {
@@ -25,60 +70,97 @@ func Login(c *gin.Context) {
 		logger.Error(err.Error())
 		return
 	}
+	if loginParams.Password == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "用户名或密码错误"})
+		return
+	}
 
-	tenantID := c.Query("tenant_id")
+	// 租户ID只解析一次，计数键和查询使用同一个值，避免 01、+1 等不同写法绕过账户锁定
+	parsedTenantID, parseErr := strconv.ParseUint(c.Query("tenant_id"), 10, 32)
+	tenantID := uint(parsedTenantID)
+	if !guardLogin(c, tenantID, loginParams.Username) {
+		return
+	}
+	db := tenancy.Scoped(config.DB, tenantID)
 
 	userChan := make(chan model.User)
 	errChan := make(chan error)
 
 	go func() {
+		// 租户ID格式错误时按用户不存在处理
+		if parseErr != nil {
+			errChan <- parseErr
+			return
+		}
+
 		var user model.User
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ? AND username = ? AND password = ?", tenantID, loginParams.Username, loginParams.Password).First(&user)
+		result := db.Where("username = ?", loginParams.Username).First(&user)
 		config.DbMutex.Unlock()
 		if result.Error != nil {
 			errChan <- result.Error
 			return
 		}
+
+		ok, needsRehash := password.Verify(user.Password, loginParams.Password)
+		if !ok {
+			errChan <- errors.New("password mismatch for user " + user.Username)
+			return
+		}
+
+		// 历史遗留的明文密码在首次登录成功后透明地升级为哈希
+		if needsRehash {
+			hashed, err := password.Hash(loginParams.Password)
+			if err == nil {
+				config.DbMutex.Lock()
+				err = db.Model(&model.User{}).Where("id = ?", user.ID).Update("password", hashed).Error
+				config.DbMutex.Unlock()
+			}
+			if err != nil {
+				logger.Error("Could not rehash password: ", err.Error())
+			}
+		}
 		userChan <- user
 	}()
 
 	select {
 	case user := <-userChan:
-		exp := time.Now().Add(time.Hour * 2)
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"username": user.Username,
-			"role":     user.Role,
-			"exp":      exp.Unix(),
-		})
+		if rejectInactiveTenant(c, user.TenantID) {
+			return
+		}
 
-		refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"username": user.Username,
-			"role":     user.Role,
-			"exp":      time.Now().Add(time.Hour * 24 * 30).Unix(),
-		})
-		refreshTokenString, _ := refreshToken.SignedString([]byte(config.JWTSecret))
+		// 需要两步验证时只返回挑战令牌，失败计数在第二步完成后才清除
+		required, err := mfaRequired(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+			logger.Error(err.Error())
+			return
+		}
+		if required {
+			// 密码正确，本次尝试不计为失败
+			releaseLoginAttempt(tenantID, loginParams.Username)
+			challenge, err := mfaChallenge(user)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+				logger.Error("Could not generate token: ", err.Error())
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"success": true, "data": challenge})
+			return
+		}
 
-		tokenString, err := token.SignedString([]byte(config.JWTSecret))
+		recordLoginSuccess(tenantID, loginParams.Username)
+		data, err := issueTokens(user, "")
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
-			logger.Error("Could not generate token")
+			logger.Error("Could not generate token: ", err.Error())
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"data": gin.H{
-				"username":     user.Username,
-				"roles":        []string{user.Role},
-				"accessToken":  tokenString,
-				"refreshToken": refreshTokenString,
-				"expires":      exp.Format("2006/01/02 15:04:05"),
-			},
-		})
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 	case err := <-errChan:
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "用户名或密码错误"})
-		logger.Error(err.Error())
+		logger.Warn("Login failed for user ", loginParams.Username, " in tenant ", c.Query("tenant_id"), " from ", c.ClientIP(), ": ", err.Error())
 	}
 }
 
@@ -93,63 +175,87 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
-	token, err := jwt.Parse(tokenParams.RefreshToken, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWTSecret), nil
-	})
-	if err != nil {
+	claims, err := token.Parse(tokenParams.RefreshToken, token.TypeRefresh)
+	if err != nil || claims.SessionID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Invalid or expired refresh token"})
 		return
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		exp := time.Now().Add(time.Hour * 2)
-		newToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"username": claims["username"],
-			"role":     claims["role"],
-			"exp":      exp.Unix(),
-		})
-		newTokenString, err := newToken.SignedString([]byte(config.JWTSecret))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not generate token"})
-			logger.Error("Could not generate token")
-			return
+	if err := rotateRefreshToken(claims); err != nil {
+		if errors.Is(err, errRefreshTokenReused) {
+			logger.Warn("Refresh token reuse detected, session revoked: user ", claims.Username, ", session ", claims.SessionID)
 		}
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Invalid or expired refresh token"})
+		return
+	}
 
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"data": gin.H{
-				"accessToken":  newTokenString,
-				"refreshToken": tokenParams.RefreshToken,
-				"expires":      exp.Format("2006/01/02 15:04:05"),
-			},
-		})
-	} else {
+	// 重新读取用户，确保用户仍然存在并使用其当前角色
+	var user model.User
+	config.DbMutex.Lock()
+	result := tenancy.Scoped(config.DB, claims.TenantID).Where("id = ?", claims.UserID).First(&user)
+	config.DbMutex.Unlock()
+	if result.Error != nil {
+		if err := revokeFamily(claims.TenantID, claims.SessionID); err != nil {
+			logger.Error(err.Error())
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Invalid or expired refresh token"})
+		return
+	}
+	if rejectInactiveTenant(c, user.TenantID) {
+		return
+	}
+
+	data, err := issueTokens(user, claims.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not generate token"})
+		logger.Error("Could not generate token: ", err.Error())
+		return
 	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
 }
 
-// GetUsers 获取所有用户
+// userListSpec 为 GetUsers 允许的筛选参数和排序字段
+var userListSpec = listSpec[model.User]{
+	filters: map[string]listFilter{
+		"role": equalFilter("role", parseString),
+	},
+	sorts: map[string]listSort[model.User]{
+		"id":       {"id", func(u *model.User) interface{} { return u.ID }},
+		"username": {"username", func(u *model.User) interface{} { return u.Username }},
+		"role":     {"role", func(u *model.User) interface{} { return u.Role }},
+	},
+	defaultSort: "id",
+	id:          func(u *model.User) uint { return u.ID },
+}
+
+// GetUsers 分页获取用户，可以按角色筛选
 func GetUsers(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
+	list, ok := parseListQuery(c, &userListSpec)
+	if !ok {
+		return
+	}
 
-	usersChan := make(chan []model.User)
+	pageChan := make(chan ListPage)
 	errChan := make(chan error)
 
 	go func() {
 		var users []model.User
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ?", tenantID).Find(&users)
+		result := list.apply(db).Find(&users)
 		config.DbMutex.Unlock()
 		if result.Error != nil {
 			errChan <- result.Error
 			return
 		}
-		usersChan <- users
+		users, next := list.page(users)
+		pageChan <- ListPage{Data: users, NextCursor: next}
 	}()
 
 	select {
-	case users := <-usersChan:
-		c.JSON(200, users)
+	case page := <-pageChan:
+		c.JSON(200, page)
 	case err := <-errChan:
 		c.JSON(500, gin.H{"error": err.Error()})
 	}
@@ -157,21 +263,44 @@ func GetUsers(c *gin.Context) {
 
 // AddUser 添加新的用户
 func AddUser(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
-	var user model.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	var userJSON UserJSON
+	if err := c.ShouldBindJSON(&userJSON); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if userJSON.Password == "" {
+		c.JSON(400, gin.H{"error": "Password is required"})
+		return
+	}
+	if userJSON.Role == "" {
+		c.JSON(400, gin.H{"error": "Role is required"})
+		return
+	}
+	if !validRole(c, tenantID, userJSON.Role) {
+		return
+	}
+	user, err := userJSON.ToUser()
+	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	parsedTenantID, _ := strconv.ParseUint(tenantID, 10, 64)
-	user.TenantID = uint(parsedTenantID)
 
 	userChan := make(chan model.User)
 	errChan := make(chan error)
 
 	go func() {
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ?", tenantID).Create(&user)
+		if err := checkQuota(db, tenantID, quotaUsers, 1); err != nil {
+			config.DbMutex.Unlock()
+			errChan <- err
+			return
+		}
+		result := db.Create(&user)
 		config.DbMutex.Unlock()
 		if result.Error != nil {
 			errChan <- result.Error
@@ -179,7 +308,7 @@ func AddUser(c *gin.Context) {
 		}
 		var createdUser model.User
 		config.DbMutex.Lock()
-		config.DB.Where("id = ?", user.ID).First(&createdUser)
+		db.Where("id = ?", user.ID).First(&createdUser)
 		config.DbMutex.Unlock()
 		userChan <- createdUser
 	}()
@@ -188,21 +317,33 @@ func AddUser(c *gin.Context) {
 	case createdUser := <-userChan:
 		c.JSON(201, createdUser)
 	case err := <-errChan:
-		c.JSON(500, gin.H{"error": err.Error()})
+		if !respondQuotaExceeded(c, err) {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
 	}
 }
 
 // UpdateUser 更新用户信息
 func UpdateUser(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
-	var user model.User
+	db := tenantDB(c)
+	tenantID, ok := requestTenant(c)
+	if !ok {
+		return
+	}
+	var userJSON UserJSON
 	id := c.Param("id")
-	if err := c.ShouldBindJSON(&user); err != nil {
+	if err := c.ShouldBindJSON(&userJSON); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if userJSON.Role != "" && !validRole(c, tenantID, userJSON.Role) {
+		return
+	}
+	user, err := userJSON.ToUser()
+	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	parsedTenantID, _ := strconv.ParseUint(tenantID, 10, 64)
-	user.TenantID = uint(parsedTenantID)
 
 	userChan := make(chan model.User)
 	errChan := make(chan error)
@@ -210,7 +351,7 @@ func UpdateUser(c *gin.Context) {
 	go func() {
 		var existingUser model.User
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&existingUser)
+		result := db.Where("id = ?", id).First(&existingUser)
 		config.DbMutex.Unlock()
 		if result.Error != nil {
 			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
@@ -221,18 +362,24 @@ func UpdateUser(c *gin.Context) {
 			return
 		}
 		config.DbMutex.Lock()
-		result = config.DB.Where("tenant_id = ?", tenantID).Model(&model.User{}).Where("id = ?", id).Updates(user)
+		result = db.Model(&model.User{}).Where("id = ?", id).Updates(user)
 		config.DbMutex.Unlock()
 		if result.Error != nil {
 			errChan <- result.Error
 			return
 		}
+		// 管理员重置密码后，该用户已有的会话全部失效
+		if user.Password != "" {
+			if err := revokeUserSessions(existingUser.TenantID, existingUser.ID, ""); err != nil {
+				logger.Error("Could not revoke sessions: ", err.Error())
+			}
+		}
 		if result.RowsAffected == 0 {
 			userChan <- existingUser
 		} else {
 			var updatedUser model.User
 			config.DbMutex.Lock()
-			config.DB.Where("id = ?", id).First(&updatedUser)
+			db.Where("id = ?", id).First(&updatedUser)
 			config.DbMutex.Unlock()
 			userChan <- updatedUser
 		}
@@ -254,24 +401,77 @@ func UpdateUser(c *gin.Context) {
 	}
 }
 
-// DeleteUser 删除用户
+// DeleteUser 删除用户，用户仍是巡检任务的巡检员时返回 409 和这些任务的ID，除非指定以下参数之一：
+// cascade=true 同时删除这些任务及其报告；reassign_to 为另一个用户的ID时，这些任务改派给该用户
 func DeleteUser(c *gin.Context) {
-	tenantID := c.Query("tenant_id")
+	db := tenantDB(c)
 	id := c.Param("id")
+	options, ok := parseDeleteOptions(c)
+	if !ok {
+		return
+	}
 
 	resultChan := make(chan error)
+	blockedChan := make(chan dependents)
 
 	go func() {
 		config.DbMutex.Lock()
-		result := config.DB.Where("tenant_id = ?", tenantID).Delete(&model.User{}, id)
-		config.DbMutex.Unlock()
-		resultChan <- result.Error
+		defer config.DbMutex.Unlock()
+		var blocked dependents
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var user model.User
+			if err := tx.Where("id = ?", id).Limit(1).Find(&user).Error; err != nil {
+				return err
+			}
+			if user.ID == 0 {
+				return nil
+			}
+			var planIDs []uint
+			if err := tx.Model(&model.Plan{}).Where("inspector_id = ?", user.ID).Order("id").Pluck("id", &planIDs).Error; err != nil {
+				return err
+			}
+			deps := dependents{"plans": planIDs}
+			if options.blocks(deps) {
+				blocked = deps
+				return nil
+			}
+			if options.reassignTo != 0 {
+				if options.reassignTo == user.ID {
+					return errReassignTarget
+				}
+				if err := checkRecordsExist(tx, &model.User{}, []uint{options.reassignTo}, errReassignTarget); err != nil {
+					return err
+				}
+				if err := tx.Model(&model.Plan{}).Where("inspector_id = ?", user.ID).Update("inspector_id", options.reassignTo).Error; err != nil {
+					return err
+				}
+			} else if err := deletePlans(tx, planIDs); err != nil {
+				return err
+			}
+			for _, table := range []interface{}{&model.RefreshToken{}, &model.RecoveryCode{}, &model.PasswordResetToken{}} {
+				if err := tx.Where("user_id = ?", user.ID).Delete(table).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Delete(&user).Error
+		})
+		if err == nil && blocked != nil {
+			blockedChan <- blocked
+			return
+		}
+		resultChan <- err
 	}()
 
-	if err := <-resultChan; err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+	select {
+	case deps := <-blockedChan:
+		respondDependents(c, "user is still the inspector of plans", deps)
+	case err := <-resultChan:
+		if errors.Is(err, errReassignTarget) {
+			c.JSON(400, gin.H{"error": err.Error()})
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(200, gin.H{"message": "User deleted"})
+		}
 	}
-
-	c.JSON(200, gin.H{"message": "User deleted"})
 }
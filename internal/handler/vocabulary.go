@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/history"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// vocabularyField 为词表约束的字段，model 为字段所在的模型
+type vocabularyField struct {
+	model  interface{}
+	column string
+}
+
+// vocabularyFields 为各种类词表约束的字段
+var vocabularyFields = map[string]vocabularyField{
+	model.VocabularyRoadType:        {&model.Road{}, "type"},
+	model.VocabularySurfaceMaterial: {&model.Road{}, "surface_material"},
+	model.VocabularyAssetType:       {&model.Asset{}, "type"},
+}
+
+var errVocabularyConflict = errors.New("value or alias is already used by another term")
+
+type VocabularyTermJSON struct {
+	Kind    string   `json:"kind"`
+	Value   string   `json:"value"`
+	Aliases []string `json:"aliases"`
+}
+
+// Validate 检查词条的种类和值是否合法，并去除值和别名两端的空白及重复的别名
+func (t *VocabularyTermJSON) Validate() error {
+	if _, ok := vocabularyFields[t.Kind]; !ok {
+		return errors.New("kind must be one of " + strings.Join(model.VocabularyKinds, ", "))
+	}
+	t.Value = strings.TrimSpace(t.Value)
+	if t.Value == "" {
+		return errors.New("value is required")
+	}
+	if len(t.Value) > 64 {
+		return errors.New("value must be at most 64 characters")
+	}
+	term := model.VocabularyTerm{Value: t.Value}
+	aliases := make([]string, 0, len(t.Aliases))
+	for _, alias := range t.Aliases {
+		alias = strings.TrimSpace(alias)
+		if alias == "" || term.Matches(alias) {
+			continue
+		}
+		if len(alias) > 64 {
+			return errors.New("aliases must be at most 64 characters")
+		}
+		term.Aliases = append(term.Aliases, alias)
+		aliases = append(aliases, alias)
+	}
+	t.Aliases = aliases
+	return nil
+}
+
+// GetVocabularies 获取租户的受控词表，kind 参数只返回一种词表
+func GetVocabularies(c *gin.Context) {
+	db := tenantDB(c)
+	query := db.Order("kind").Order("value")
+	if kind := c.Query("kind"); kind != "" {
+		if _, ok := vocabularyFields[kind]; !ok {
+			c.JSON(400, gin.H{"error": "kind must be one of " + strings.Join(model.VocabularyKinds, ", ")})
+			return
+		}
+		query = query.Where("kind = ?", kind)
+	}
+
+	terms := []model.VocabularyTerm{}
+	config.DbMutex.Lock()
+	result := query.Find(&terms)
+	config.DbMutex.Unlock()
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": result.Error.Error()})
+		return
+	}
+	c.JSON(200, terms)
+}
+
+// AddVocabularyTerm 添加词条，值或别名与同种类的其他词条重复时返回 409
+// 道路或设施中与新词条的值或别名匹配的字段会统一为词条的值
+func AddVocabularyTerm(c *gin.Context) {
+	db := tenantDB(c)
+	userID := changedBy(c)
+	var termJSON VocabularyTermJSON
+	if err := c.ShouldBindJSON(&termJSON); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := termJSON.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	term := model.VocabularyTerm{Kind: termJSON.Kind, Value: termJSON.Value, Aliases: termJSON.Aliases}
+	config.DbMutex.Lock()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkVocabularyConflict(tx, &term); err != nil {
+			return err
+		}
+		if err := tx.Create(&term).Error; err != nil {
+			return err
+		}
+		return normalizeTermUsages(tx, &term, userID)
+	})
+	config.DbMutex.Unlock()
+	if err != nil {
+		if errors.Is(err, errVocabularyConflict) {
+			c.JSON(409, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(201, term)
+}
+
+// UpdateVocabularyTerm 更新词条的值和别名，种类不能修改
+// 修改值时同步更新使用旧值的道路或设施，并统一与新的值或别名匹配的字段
+func UpdateVocabularyTerm(c *gin.Context) {
+	db := tenantDB(c)
+	userID := changedBy(c)
+	id := c.Param("id")
+	var termJSON VocabularyTermJSON
+	if err := c.ShouldBindJSON(&termJSON); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var term model.VocabularyTerm
+	config.DbMutex.Lock()
+	result := db.Where("id = ?", id).First(&term)
+	config.DbMutex.Unlock()
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "no vocabulary term found with given ID"})
+		} else {
+			c.JSON(500, gin.H{"error": result.Error.Error()})
+		}
+		return
+	}
+	if termJSON.Kind != "" && termJSON.Kind != term.Kind {
+		c.JSON(400, gin.H{"error": "kind cannot be changed"})
+		return
+	}
+	termJSON.Kind = term.Kind
+	if err := termJSON.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	oldValue := term.Value
+	term.Value = termJSON.Value
+	term.Aliases = termJSON.Aliases
+	config.DbMutex.Lock()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkVocabularyConflict(tx, &term); err != nil {
+			return err
+		}
+		if err := tx.Save(&term).Error; err != nil {
+			return err
+		}
+		if oldValue != term.Value {
+			field := vocabularyFields[term.Kind]
+			if err := field.update(tx, term.Value, userID, field.column+" = ?", oldValue); err != nil {
+				return err
+			}
+		}
+		return normalizeTermUsages(tx, &term, userID)
+	})
+	config.DbMutex.Unlock()
+	if err != nil {
+		if errors.Is(err, errVocabularyConflict) {
+			c.JSON(409, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(200, term)
+}
+
+// DeleteVocabularyTerm 删除词条，仍有道路或设施使用该词条时拒绝删除
+func DeleteVocabularyTerm(c *gin.Context) {
+	db := tenantDB(c)
+	id := c.Param("id")
+
+	var term model.VocabularyTerm
+	config.DbMutex.Lock()
+	result := db.Where("id = ?", id).First(&term)
+	config.DbMutex.Unlock()
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "no vocabulary term found with given ID"})
+		} else {
+			c.JSON(500, gin.H{"error": result.Error.Error()})
+		}
+		return
+	}
+
+	var usages int64
+	field := vocabularyFields[term.Kind]
+	config.DbMutex.Lock()
+	db.Model(field.model).Where(field.column+" = ?", term.Value).Count(&usages)
+	config.DbMutex.Unlock()
+	if usages > 0 {
+		if term.Kind == model.VocabularyAssetType {
+			c.JSON(409, gin.H{"error": "term is still used by assets", "assets": usages})
+		} else {
+			c.JSON(409, gin.H{"error": "term is still used by roads", "roads": usages})
+		}
+		return
+	}
+
+	config.DbMutex.Lock()
+	err := db.Delete(&term).Error
+	config.DbMutex.Unlock()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Vocabulary term deleted"})
+}
+
+// seedVocabulary 为新建的租户写入配置中的默认词条，调用方需持有 config.DbMutex
+func seedVocabulary(db *gorm.DB) error {
+	defaults := map[string][]string{
+		model.VocabularyRoadType:        config.RoadTypes,
+		model.VocabularySurfaceMaterial: config.RoadSurfaceMaterials,
+		model.VocabularyAssetType:       config.AssetTypes,
+	}
+	var terms []model.VocabularyTerm
+	for _, kind := range model.VocabularyKinds {
+		seen := map[string]bool{}
+		for _, value := range defaults[kind] {
+			value = strings.TrimSpace(value)
+			if value == "" || seen[strings.ToLower(value)] {
+				continue
+			}
+			seen[strings.ToLower(value)] = true
+			terms = append(terms, model.VocabularyTerm{Kind: kind, Value: value})
+		}
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+	return db.Create(&terms).Error
+}
+
+// loadVocabulary 读取租户的全部词条，调用方需持有 config.DbMutex
+func loadVocabulary(db *gorm.DB) (model.Vocabulary, error) {
+	var terms []model.VocabularyTerm
+	if err := db.Find(&terms).Error; err != nil {
+		return nil, err
+	}
+	return model.NewVocabulary(terms), nil
+}
+
+// checkVocabularyConflict 检查词条的值和别名没有被同种类的其他词条使用，调用方需持有 config.DbMutex
+func checkVocabularyConflict(db *gorm.DB, term *model.VocabularyTerm) error {
+	var others []model.VocabularyTerm
+	if err := db.Where("kind = ? AND id <> ?", term.Kind, term.ID).Find(&others).Error; err != nil {
+		return err
+	}
+	for i := range others {
+		for _, name := range term.Names() {
+			if others[i].Matches(name) {
+				return errVocabularyConflict
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeTermUsages 将道路或设施中与词条的值或别名匹配（不区分大小写）的字段统一为词条的值，调用方需持有 config.DbMutex
+func normalizeTermUsages(db *gorm.DB, term *model.VocabularyTerm, changedBy *uint) error {
+	names := term.Names()
+	for i := range names {
+		names[i] = strings.ToLower(names[i])
+	}
+	field := vocabularyFields[term.Kind]
+	return field.update(db, term.Value, changedBy, "LOWER("+field.column+") IN ? AND "+field.column+" <> ?", names, term.Value)
+}
+
+// update 将满足条件的记录的字段改为 value，修改的是道路时为每条受影响的道路记录版本
+func (f vocabularyField) update(db *gorm.DB, value string, changedBy *uint, query string, args ...interface{}) error {
+	if _, ok := f.model.(*model.Road); !ok {
+		return db.Model(f.model).Where(query, args...).Update(f.column, value).Error
+	}
+	var roadIDs []uint
+	if err := db.Model(f.model).Where(query, args...).Pluck("id", &roadIDs).Error; err != nil {
+		return err
+	}
+	if len(roadIDs) == 0 {
+		return nil
+	}
+	if err := db.Model(f.model).Where("id IN ?", roadIDs).Update(f.column, value).Error; err != nil {
+		return err
+	}
+	return history.RecordRoads(db, roadIDs, model.RoadChangeUpdate, changedBy)
+}
+
+// respondFieldErrors 返回按字段的校验错误
+func respondFieldErrors(c *gin.Context, message string, errs model.FieldErrors) {
+	c.JSON(400, gin.H{"error": message, "fields": errs})
+}
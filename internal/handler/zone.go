@@ -0,0 +1,418 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/history"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errZoneNotFound = errors.New("no zone found with given ID")
+
+// zoneInUse 为删除区域时仍然引用该区域的下级区域数和道路数
+type zoneInUse struct {
+	Zones int64
+	Roads int64
+}
+
+// ZoneAssignJSON 为按边界划分道路的请求格式
+// RoadIDs 为空时处理全部道路；Overwrite 为 false 时只处理尚未划入区域的道路
+type ZoneAssignJSON struct {
+	RoadIDs   []uint `json:"road_ids"`
+	Overwrite bool   `json:"overwrite"`
+}
+
+// GetZones 获取租户的全部区域，通过 parent_id 组成上下级关系
+// crs 参数指定返回结果中边界坐标使用的坐标系
+func GetZones(c *gin.Context) {
+	db := tenantDB(c)
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+
+	zoneChan := make(chan []model.Zone)
+	errChan := make(chan error)
+
+	go func() {
+		zones := []model.Zone{}
+		config.DbMutex.Lock()
+		result := db.Order("id").Find(&zones)
+		config.DbMutex.Unlock()
+		if result.Error != nil {
+			errChan <- result.Error
+			return
+		}
+		zoneChan <- zones
+	}()
+
+	select {
+	case zones := <-zoneChan:
+		for i := range zones {
+			zones[i].ConvertCRS(geo.WGS84, crs)
+		}
+		c.JSON(200, zones)
+	case err := <-errChan:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// AddZone 添加区域，parent_id 指定上级区域，boundary 为可选的 GeoJSON Polygon 边界
+// crs 参数指定请求和响应中坐标使用的坐标系
+func AddZone(c *gin.Context) {
+	db := tenantDB(c)
+	var zone model.Zone
+	if err := c.ShouldBindJSON(&zone); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if conflictingTenant(c, zone.TenantID) {
+		return
+	}
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+	zone.ID = 0
+	fieldErrs := zone.Validate()
+	if zone.Name == "" {
+		fieldErrs["name"] = "is required"
+	}
+	if zone.ParentID != nil && *zone.ParentID == 0 {
+		zone.ParentID = nil
+	}
+	if len(fieldErrs) > 0 {
+		respondFieldErrors(c, "Invalid zone", fieldErrs)
+		return
+	}
+	zone.ConvertCRS(crs, geo.WGS84)
+
+	zoneChan := make(chan model.Zone)
+	errChan := make(chan error)
+	invalidChan := make(chan model.FieldErrors)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		if zone.ParentID != nil {
+			tree, err := loadZoneTree(db)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			if !tree.Has(*zone.ParentID) {
+				invalidChan <- model.FieldErrors{"parent_id": "zone not found"}
+				return
+			}
+		}
+		if err := db.Create(&zone).Error; err != nil {
+			errChan <- err
+			return
+		}
+		zoneChan <- zone
+	}()
+
+	select {
+	case zone := <-zoneChan:
+		zone.ConvertCRS(geo.WGS84, crs)
+		c.JSON(201, zone)
+	case fieldErrs := <-invalidChan:
+		respondFieldErrors(c, "Invalid zone", fieldErrs)
+	case err := <-errChan:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// UpdateZone 更新区域，只修改请求中提供的字段，boundary 提供时整体替换
+// parent_id 为 0 时改为顶级区域，上级区域不能是区域本身或其下级区域
+func UpdateZone(c *gin.Context) {
+	db := tenantDB(c)
+	id := c.Param("id")
+	var update model.Zone
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if conflictingTenant(c, update.TenantID) {
+		return
+	}
+	crs, ok := requestCRS(c)
+	if !ok {
+		return
+	}
+	if fieldErrs := update.Validate(); len(fieldErrs) > 0 {
+		respondFieldErrors(c, "Invalid zone", fieldErrs)
+		return
+	}
+	update.ConvertCRS(crs, geo.WGS84)
+
+	zoneChan := make(chan model.Zone)
+	errChan := make(chan error)
+	invalidChan := make(chan model.FieldErrors)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		var zone model.Zone
+		if err := db.Where("id = ?", id).First(&zone).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				errChan <- errZoneNotFound
+			} else {
+				errChan <- err
+			}
+			return
+		}
+		if update.Name != "" {
+			zone.Name = update.Name
+		}
+		if update.Kind != "" {
+			zone.Kind = update.Kind
+		}
+		if update.Boundary != nil {
+			zone.Boundary = update.Boundary
+		}
+		if update.ParentID != nil {
+			if *update.ParentID == 0 {
+				zone.ParentID = nil
+			} else {
+				tree, err := loadZoneTree(db)
+				if err != nil {
+					errChan <- err
+					return
+				}
+				if !tree.Has(*update.ParentID) {
+					invalidChan <- model.FieldErrors{"parent_id": "zone not found"}
+					return
+				}
+				for _, descendant := range tree.Descendants(zone.ID) {
+					if descendant == *update.ParentID {
+						invalidChan <- model.FieldErrors{"parent_id": "must not be the zone itself or one of its sub-zones"}
+						return
+					}
+				}
+				zone.ParentID = update.ParentID
+			}
+		}
+		if err := db.Save(&zone).Error; err != nil {
+			errChan <- err
+			return
+		}
+		zoneChan <- zone
+	}()
+
+	select {
+	case zone := <-zoneChan:
+		zone.ConvertCRS(geo.WGS84, crs)
+		c.JSON(200, zone)
+	case fieldErrs := <-invalidChan:
+		respondFieldErrors(c, "Invalid zone", fieldErrs)
+	case err := <-errChan:
+		if errors.Is(err, errZoneNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// DeleteZone 删除区域，区域还有下级区域或道路时返回 409
+func DeleteZone(c *gin.Context) {
+	db := tenantDB(c)
+	id := c.Param("id")
+
+	resultChan := make(chan error)
+	inUseChan := make(chan zoneInUse)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		var zone model.Zone
+		if err := db.Where("id = ?", id).First(&zone).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				resultChan <- errZoneNotFound
+			} else {
+				resultChan <- err
+			}
+			return
+		}
+		var inUse zoneInUse
+		if err := db.Model(&model.Zone{}).Where("parent_id = ?", zone.ID).Count(&inUse.Zones).Error; err != nil {
+			resultChan <- err
+			return
+		}
+		if err := db.Model(&model.Road{}).Where("zone_id = ?", zone.ID).Count(&inUse.Roads).Error; err != nil {
+			resultChan <- err
+			return
+		}
+		if inUse.Zones > 0 || inUse.Roads > 0 {
+			inUseChan <- inUse
+			return
+		}
+		resultChan <- db.Delete(&zone).Error
+	}()
+
+	select {
+	case inUse := <-inUseChan:
+		c.JSON(409, gin.H{"error": "zone still has sub-zones or roads", "zones": inUse.Zones, "roads": inUse.Roads})
+	case err := <-resultChan:
+		if err == nil {
+			c.JSON(200, gin.H{"message": "Zone deleted"})
+		} else if errors.Is(err, errZoneNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(500, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// AssignRoadZones 按区域边界把道路划入包含其代表点的最深一级区域，请求体为 ZoneAssignJSON
+// 没有坐标或不在任何区域边界内的道路保持不变，其 ID 在 unmatched 中返回
+func AssignRoadZones(c *gin.Context) {
+	db := tenantDB(c)
+	userID := changedBy(c)
+	var request ZoneAssignJSON
+	// 请求体可以省略，此时处理全部尚未划入区域的道路
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	type assignResult struct {
+		Assigned  int    `json:"assigned"`
+		Unmatched []uint `json:"unmatched"`
+	}
+	resultChan := make(chan assignResult)
+	errChan := make(chan error)
+
+	go func() {
+		config.DbMutex.Lock()
+		defer config.DbMutex.Unlock()
+		tree, err := loadZoneTree(db)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		query := db.Order("id")
+		if len(request.RoadIDs) > 0 {
+			query = query.Where("id IN ?", request.RoadIDs)
+		}
+		if !request.Overwrite {
+			query = query.Where("zone_id IS NULL")
+		}
+		var roads []model.Road
+		if err := query.Find(&roads).Error; err != nil {
+			errChan <- err
+			return
+		}
+
+		result := assignResult{Unmatched: []uint{}}
+		assignments := make(map[uint][]uint)
+		for i := range roads {
+			road := &roads[i]
+			var zone *model.Zone
+			if road.Latitude != 0 || road.Longitude != 0 {
+				zone = tree.Locate(road.Point())
+			}
+			if zone == nil {
+				result.Unmatched = append(result.Unmatched, road.ID)
+				continue
+			}
+			result.Assigned++
+			if road.ZoneID == nil || *road.ZoneID != zone.ID {
+				assignments[zone.ID] = append(assignments[zone.ID], road.ID)
+			}
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for zoneID, roadIDs := range assignments {
+				if err := tx.Model(&model.Road{}).Where("id IN ?", roadIDs).Update("zone_id", zoneID).Error; err != nil {
+					return err
+				}
+				if err := history.RecordRoads(tx, roadIDs, model.RoadChangeUpdate, userID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			errChan <- err
+			return
+		}
+		resultChan <- result
+	}()
+
+	select {
+	case result := <-resultChan:
+		c.JSON(200, result)
+	case err := <-errChan:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// loadZoneTree 读取租户的全部区域并建立区域树，调用方需持有 config.DbMutex
+func loadZoneTree(db *gorm.DB) (*model.ZoneTree, error) {
+	var zones []model.Zone
+	if err := db.Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	return model.NewZoneTree(zones), nil
+}
+
+// checkRoadZone 检查道路指定的区域存在，不存在时在 errs 中记录，调用方需持有 config.DbMutex
+func checkRoadZone(db *gorm.DB, zoneID *uint, errs model.FieldErrors) error {
+	if zoneID == nil || *zoneID == 0 {
+		return nil
+	}
+	var count int64
+	if err := db.Model(&model.Zone{}).Where("id = ?", *zoneID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		errs["zone_id"] = "zone not found"
+	}
+	return nil
+}
+
+// zoneFilter 解析 zone_id 查询参数，返回该区域及其全部下级区域的 ID，没有该参数时返回 nil
+// 参数不合法时返回 400 并返回 false；区域不存在时只包含该 ID，因此筛选结果为空
+func zoneFilter(c *gin.Context, db *gorm.DB) ([]uint, bool) {
+	value := c.Query("zone_id")
+	if value == "" {
+		return nil, true
+	}
+	id, err := strconv.ParseUint(value, 10, 0)
+	if err != nil || id == 0 {
+		c.JSON(400, gin.H{"error": "Invalid zone_id"})
+		return nil, false
+	}
+	config.DbMutex.Lock()
+	tree, err := loadZoneTree(db)
+	config.DbMutex.Unlock()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return tree.Descendants(uint(id)), true
+}
+
+// zoneRoadIDs 返回属于给定区域的道路 ID 子查询
+func zoneRoadIDs(db *gorm.DB, zoneIDs []uint) *gorm.DB {
+	return db.Model(&model.Road{}).Select("id").Where("zone_id IN ?", zoneIDs)
+}
+
+// zoneSegmentIDs 返回给定区域内道路上的路段 ID 子查询
+func zoneSegmentIDs(db *gorm.DB, zoneIDs []uint) *gorm.DB {
+	return db.Model(&model.RoadSegment{}).Select("id").Where("road_id IN (?)", zoneRoadIDs(db, zoneIDs))
+}
+
+// zonePlanIDs 返回涉及给定区域内道路（或这些道路上的路段）的巡检任务 ID 子查询
+func zonePlanIDs(db *gorm.DB, zoneIDs []uint) *gorm.DB {
+	return db.Model(&model.Plan{}).Select("id").Where("(id IN (?) OR id IN (?))",
+		db.Model(&model.PlanRoad{}).Select("plan_id").Where("road_id IN (?)", zoneRoadIDs(db, zoneIDs)),
+		db.Model(&model.PlanSegment{}).Select("plan_id").Where("segment_id IN (?)", zoneSegmentIDs(db, zoneIDs)))
+}
@@ -0,0 +1,104 @@
+// Package history 记录道路的变更历史，并按时间点还原道路的状态
+// 每次变更后保存道路的完整状态作为一个新版本，调用方负责在修改道路的同一事务中记录版本
+package history
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// ErrNoVersion 表示道路在指定时间点还不存在，或者没有任何历史版本
+var ErrNoVersion = errors.New("no version of the road exists at the given time")
+
+// RecordRoad 为道路记录变更后的状态，changedBy 为变更人，命令行等没有用户的场景为 nil
+// 与上一个版本相比没有变化的修改不记录
+func RecordRoad(db *gorm.DB, road *model.Road, action string, changedBy *uint) error {
+	var previous model.RoadVersion
+	err := db.Where("road_id = ?", road.ID).Order("version DESC").Limit(1).Find(&previous).Error
+	if err != nil {
+		return err
+	}
+	version := model.RoadVersion{
+		TenantID:  road.TenantID,
+		RoadID:    road.ID,
+		Version:   previous.Version + 1,
+		Action:    action,
+		Road:      model.RoadSnapshot(*road),
+		ChangedBy: changedBy,
+		ChangedAt: time.Now(),
+	}
+	version.Road.Distance = nil
+	if previous.ID != 0 {
+		previousRoad := model.Road(previous.Road)
+		version.Changes = model.RoadChanges(&previousRoad, road)
+		if action == model.RoadChangeUpdate && len(version.Changes) == 0 {
+			return nil
+		}
+	}
+	return db.Create(&version).Error
+}
+
+// RecordRoads 读取道路的当前状态并逐条记录版本，用于批量修改道路之后
+func RecordRoads(db *gorm.DB, roadIDs []uint, action string, changedBy *uint) error {
+	if len(roadIDs) == 0 {
+		return nil
+	}
+	var roads []model.Road
+	if err := db.Where("id IN ?", roadIDs).Find(&roads).Error; err != nil {
+		return err
+	}
+	for i := range roads {
+		if err := RecordRoad(db, &roads[i], action, changedBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Versions 返回道路的全部历史版本，按版本号升序排列
+func Versions(db *gorm.DB, roadID uint) ([]model.RoadVersion, error) {
+	versions := []model.RoadVersion{}
+	err := db.Where("road_id = ?", roadID).Order("version").Find(&versions).Error
+	return versions, err
+}
+
+// AsOf 返回道路在时间点 t 的版本，即 t 之前（含）最后一个版本
+// t 早于全部版本时，若最早的版本为开始记录历史时的状态，则视为该状态；道路在 t 时已被删除时返回 ErrNoVersion
+func AsOf(db *gorm.DB, roadID uint, t time.Time) (*model.RoadVersion, error) {
+	var version model.RoadVersion
+	err := db.Where("road_id = ? AND changed_at <= ?", roadID, t).Order("version DESC").Limit(1).Find(&version).Error
+	if err != nil {
+		return nil, err
+	}
+	if version.ID == 0 {
+		err := db.Where("road_id = ?", roadID).Order("version").Limit(1).Find(&version).Error
+		if err != nil {
+			return nil, err
+		}
+		if version.ID == 0 || version.Action != model.RoadChangeBaseline {
+			return nil, ErrNoVersion
+		}
+	}
+	if version.Action == model.RoadChangeDelete {
+		return nil, ErrNoVersion
+	}
+	return &version, nil
+}
+
+// Backfill 为还没有任何版本的道路记录当前状态作为基线版本，用于升级后首次启动
+func Backfill(db *gorm.DB) error {
+	var roads []model.Road
+	err := db.Where("id NOT IN (?)", db.Model(&model.RoadVersion{}).Select("road_id")).Find(&roads).Error
+	if err != nil {
+		return err
+	}
+	for i := range roads {
+		if err := RecordRoad(db, &roads[i], model.RoadChangeBaseline, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
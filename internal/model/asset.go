@@ -0,0 +1,148 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+)
+
+// 设施状况
+const (
+	AssetConditionGood   = "good"
+	AssetConditionFair   = "fair"
+	AssetConditionPoor   = "poor"
+	AssetConditionFailed = "failed"
+)
+
+// AssetConditions 为全部设施状况，从好到坏排列
+var AssetConditions = []string{AssetConditionGood, AssetConditionFair, AssetConditionPoor, AssetConditionFailed}
+
+// Asset 定义道路附属设施（标志、护栏、排水设施、路灯、桥梁等）的结构体
+// 设施属于一条道路，可以进一步指定所在的路段和桩号；Attributes 为按设施类型自定义的属性
+type Asset struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	TenantID    uint          `json:"tenant_id"`
+	RoadID      uint          `json:"road_id" gorm:"index"`
+	SegmentID   *uint         `json:"segment_id" gorm:"index"`
+	Type        string        `json:"type" gorm:"size:64"`
+	Name        string        `json:"name"`
+	Latitude    float64       `json:"latitude"`
+	Longitude   float64       `json:"longitude"`
+	Chainage    *geo.Chainage `json:"chainage"`
+	InstallDate *time.Time    `json:"install_date"`
+	Condition   string        `json:"condition" gorm:"size:16"`
+	Attributes  Attributes    `json:"attributes" gorm:"type:text"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+
+	Road    Road         `json:"-" gorm:"foreignKey:RoadID"`
+	Segment *RoadSegment `json:"-" gorm:"foreignKey:SegmentID"`
+}
+
+// Validate 检查设施字段的取值范围，零值表示未设置，不做检查，因此也适用于部分更新
+// 类型需要与租户词表比对，道路和路段需要查询数据库，不在此检查
+func (a *Asset) Validate() FieldErrors {
+	errs := FieldErrors{}
+	if len(a.Name) > 255 {
+		errs["name"] = "must be at most 255 characters"
+	}
+	if len(a.Type) > 64 {
+		errs["type"] = "must be at most 64 characters"
+	}
+	if a.Latitude < -90 || a.Latitude > 90 {
+		errs["latitude"] = "must be between -90 and 90"
+	}
+	if a.Longitude < -180 || a.Longitude > 180 {
+		errs["longitude"] = "must be between -180 and 180"
+	}
+	if a.Chainage != nil && *a.Chainage < 0 {
+		errs["chainage"] = "must not be negative"
+	}
+	if a.InstallDate != nil && a.InstallDate.After(time.Now()) {
+		errs["install_date"] = "must not be in the future"
+	}
+	if a.Condition != "" && !IsAssetCondition(a.Condition) {
+		errs["condition"] = "must be one of " + strings.Join(AssetConditions, ", ")
+	}
+	if err := a.Attributes.Validate(); err != nil {
+		errs["attributes"] = err.Error()
+	}
+	return errs
+}
+
+// Point 返回设施的位置
+func (a *Asset) Point() geo.Point {
+	return geo.Point{a.Longitude, a.Latitude}
+}
+
+// ConvertCRS 将设施的位置从坐标系 from 转换到坐标系 to，经纬度均为 0 表示没有位置，不做转换
+func (a *Asset) ConvertCRS(from, to geo.CRS) {
+	if a.Latitude != 0 || a.Longitude != 0 {
+		p := geo.Convert(a.Point(), from, to)
+		a.Longitude, a.Latitude = p.Lon(), p.Lat()
+	}
+}
+
+// IsAssetCondition 判断是否为合法的设施状况
+func IsAssetCondition(condition string) bool {
+	for _, c := range AssetConditions {
+		if c == condition {
+			return true
+		}
+	}
+	return false
+}
+
+// maxAttributes 为一个设施的自定义属性个数上限
+const maxAttributes = 50
+
+// Attributes 为以 JSON 对象保存的自定义属性，值只能是字符串、数字或布尔值
+type Attributes map[string]interface{}
+
+// Validate 检查属性名不为空，属性值为字符串、数字或布尔值
+func (a Attributes) Validate() error {
+	if len(a) > maxAttributes {
+		return errors.New("too many attributes")
+	}
+	for key, value := range a {
+		if key == "" || len(key) > 64 {
+			return errors.New("attribute names must be 1 to 64 characters")
+		}
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			return errors.New("attribute " + key + " must be a string, number or boolean")
+		}
+	}
+	return nil
+}
+
+// Value 实现 driver.Valuer
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(map[string]interface{}(a))
+	return string(data), err
+}
+
+// Scan 实现 sql.Scanner
+func (a *Attributes) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return errors.New("unsupported type for Attributes")
+	}
+	return json.Unmarshal(data, (*map[string]interface{})(a))
+}
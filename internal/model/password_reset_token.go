@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// PasswordResetToken 定义密码重置令牌的结构体，只保存令牌的哈希，使用后即失效
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TenantID  uint       `json:"tenant_id"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,11 @@
+package model
+
+// PlanSegment 定义巡检任务和路段之间多对多关系的结构体
+type PlanSegment struct {
+	TenantID  uint `json:"tenant_id" gorm:"primaryKey"`
+	PlanID    uint `json:"plan_id" gorm:"primaryKey"`
+	SegmentID uint `json:"segment_id" gorm:"primaryKey"`
+
+	Plan    Plan        `json:"-" gorm:"foreignKey:PlanID"`
+	Segment RoadSegment `json:"-" gorm:"foreignKey:SegmentID"`
+}
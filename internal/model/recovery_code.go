@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// RecoveryCode 定义两步验证恢复码的结构体，只保存恢复码的哈希
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TenantID  uint       `json:"tenant_id"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	CodeHash  string     `json:"-" gorm:"size:64;index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// RefreshToken 定义已签发刷新令牌的结构体，同一登录会话轮换出的令牌属于同一个 FamilyID
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TenantID  uint       `json:"tenant_id"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	TokenID   string     `json:"-" gorm:"size:64;uniqueIndex"`
+	FamilyID  string     `json:"family_id" gorm:"size:64;index"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	// Rotated 表示令牌是因为轮换而失效的，再次出现即为重放
+	Rotated   bool      `json:"rotated"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+)
 
 // Report 定义巡检报告的结构体
 type Report struct {
@@ -10,6 +14,13 @@ type Report struct {
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// ApprovedBy 和 ApprovedAt 只能通过审核接口设置
+	ApprovedBy *uint      `json:"approved_by"`
+	ApprovedAt *time.Time `json:"approved_at"`
+	// SegmentID 和 Chainage 为可选的发现位置，设置 Chainage 时必须同时设置路段，且里程在路段的起止桩号之间
+	SegmentID *uint         `json:"segment_id" gorm:"index"`
+	Chainage  *geo.Chainage `json:"chainage"`
 
-	Plan Plan `gorm:"foreignKey:PlanID"`
+	Plan    Plan         `gorm:"foreignKey:PlanID"`
+	Segment *RoadSegment `json:"-" gorm:"foreignKey:SegmentID"`
 }
@@ -0,0 +1,11 @@
+package model
+
+// ReportAsset 定义巡检报告和所检查的设施之间多对多关系的结构体
+type ReportAsset struct {
+	TenantID uint `json:"tenant_id" gorm:"primaryKey"`
+	ReportID uint `json:"report_id" gorm:"primaryKey"`
+	AssetID  uint `json:"asset_id" gorm:"primaryKey"`
+
+	Report Report `json:"-" gorm:"foreignKey:ReportID"`
+	Asset  Asset  `json:"-" gorm:"foreignKey:AssetID"`
+}
@@ -1,14 +1,165 @@
 package model
 
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+)
+
+// MinConstructionYear 为道路建成年份允许的最小值，最大值为当前年份
+const MinConstructionYear = 1900
+
+// FieldErrors 为按字段记录的校验错误，键为字段的 JSON 名称
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for i, field := range fields {
+		fields[i] = field + ": " + e[field]
+	}
+	return strings.Join(fields, "; ")
+}
+
 // Road 定义道路信息的结构体
+// 设置了 Geometry 时，Length 由几何形状计算（单位为米），Latitude 和 Longitude 为沿线中点
 type Road struct {
-	ID               uint    `json:"id" gorm:"primaryKey"`
-	TenantID         uint    `json:"tenant_id"`
-	Name             string  `json:"name"`
-	Latitude         float64 `json:"latitude"`
-	Longitude        float64 `json:"longitude"`
-	Length           float64 `json:"length"`
-	Type             string  `json:"type"`
-	SurfaceMaterial  string  `json:"surface_material"`
-	ConstructionYear int     `json:"construction_year"`
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	TenantID         uint           `json:"tenant_id"`
+	Name             string         `json:"name"`
+	Latitude         float64        `json:"latitude"`
+	Longitude        float64        `json:"longitude"`
+	Geometry         geo.LineString `json:"geometry" gorm:"type:text"`
+	Length           float64        `json:"length"`
+	Type             string         `json:"type"`
+	SurfaceMaterial  string         `json:"surface_material"`
+	ConstructionYear int            `json:"construction_year"`
+
+	// ZoneID 为道路所属的管理区域，可以手动指定，也可以按区域边界自动划分
+	ZoneID *uint `json:"zone_id" gorm:"index"`
+	Zone   *Zone `json:"-" gorm:"foreignKey:ZoneID"`
+
+	// 外包矩形，用于按范围筛选道路，由 ApplyGeometry 计算，没有坐标的道路为 NULL
+	MinLon *float64 `json:"-" gorm:"index:idx_roads_bbox,priority:1"`
+	MinLat *float64 `json:"-" gorm:"index:idx_roads_bbox,priority:3"`
+	MaxLon *float64 `json:"-" gorm:"index:idx_roads_bbox,priority:2"`
+	MaxLat *float64 `json:"-" gorm:"index:idx_roads_bbox,priority:4"`
+
+	// Distance 为按位置查询时道路到查询点的距离，单位为米，不存入数据库
+	Distance *float64 `json:"distance,omitempty" gorm:"-"`
+}
+
+// RoadBBoxColumns 为外包矩形对应的数据库字段
+var RoadBBoxColumns = []string{"min_lon", "min_lat", "max_lon", "max_lat"}
+
+// ApplyGeometry 校验道路的几何形状，并据此计算长度、代表点和外包矩形
+// 没有几何形状时以 Latitude 和 Longitude 作为外包矩形，两者均为 0 表示没有坐标，外包矩形为 NULL
+func (r *Road) ApplyGeometry() error {
+	if r.Geometry == nil {
+		if r.Latitude == 0 && r.Longitude == 0 {
+			r.SetBounds(nil)
+		} else {
+			b := geo.PointBBox(r.Point())
+			r.SetBounds(&b)
+		}
+		return nil
+	}
+	if err := r.Geometry.Validate(); err != nil {
+		return err
+	}
+	r.Length = r.Geometry.Length()
+	midpoint := r.Geometry.Midpoint()
+	r.Longitude, r.Latitude = midpoint.Lon(), midpoint.Lat()
+	b := r.Geometry.Bounds()
+	r.SetBounds(&b)
+	return nil
+}
+
+// Validate 检查道路字段的取值范围，零值表示未设置，不做检查，因此也适用于部分更新
+// 类型和路面材料需要与租户词表比对，不在此检查
+func (r *Road) Validate() FieldErrors {
+	errs := FieldErrors{}
+	if len(r.Name) > 255 {
+		errs["name"] = "must be at most 255 characters"
+	}
+	if r.Latitude < -90 || r.Latitude > 90 || math.IsNaN(r.Latitude) {
+		errs["latitude"] = "must be between -90 and 90"
+	}
+	if r.Longitude < -180 || r.Longitude > 180 || math.IsNaN(r.Longitude) {
+		errs["longitude"] = "must be between -180 and 180"
+	}
+	if r.Geometry != nil {
+		if err := r.Geometry.Validate(); err != nil {
+			errs["geometry"] = err.Error()
+		}
+	}
+	if r.Length < 0 || math.IsNaN(r.Length) || math.IsInf(r.Length, 0) {
+		errs["length"] = "must be a non-negative number"
+	}
+	if len(r.Type) > 64 {
+		errs["type"] = "must be at most 64 characters"
+	}
+	if len(r.SurfaceMaterial) > 64 {
+		errs["surface_material"] = "must be at most 64 characters"
+	}
+	if year := time.Now().Year(); r.ConstructionYear != 0 && (r.ConstructionYear < MinConstructionYear || r.ConstructionYear > year) {
+		errs["construction_year"] = fmt.Sprintf("must be between %d and %d", MinConstructionYear, year)
+	}
+	return errs
+}
+
+// Point 返回道路的代表点
+func (r *Road) Point() geo.Point {
+	return geo.Point{r.Longitude, r.Latitude}
+}
+
+// Bounds 返回道路的外包矩形，没有坐标的道路返回 false
+func (r *Road) Bounds() (geo.BBox, bool) {
+	if r.MinLon == nil || r.MinLat == nil || r.MaxLon == nil || r.MaxLat == nil {
+		return geo.BBox{}, false
+	}
+	return geo.BBox{MinLon: *r.MinLon, MinLat: *r.MinLat, MaxLon: *r.MaxLon, MaxLat: *r.MaxLat}, true
+}
+
+// SetBounds 设置道路的外包矩形，b 为 nil 表示道路没有坐标
+func (r *Road) SetBounds(b *geo.BBox) {
+	if b == nil {
+		r.MinLon, r.MinLat, r.MaxLon, r.MaxLat = nil, nil, nil, nil
+		return
+	}
+	minLon, minLat, maxLon, maxLat := b.MinLon, b.MinLat, b.MaxLon, b.MaxLat
+	r.MinLon, r.MinLat, r.MaxLon, r.MaxLat = &minLon, &minLat, &maxLon, &maxLat
+}
+
+// DistanceTo 返回点到道路的最短距离，有几何形状时按折线计算，否则按代表点计算，单位为米
+func (r *Road) DistanceTo(p geo.Point) float64 {
+	if r.Geometry != nil {
+		return r.Geometry.DistanceTo(p)
+	}
+	return geo.Distance(p, r.Point())
+}
+
+// IntersectsBBox 判断道路是否与外包矩形相交
+func (r *Road) IntersectsBBox(b geo.BBox) bool {
+	if r.Geometry != nil {
+		return r.Geometry.IntersectsBBox(b)
+	}
+	return b.Contains(r.Point())
+}
+
+// ConvertCRS 将道路的代表点和几何形状从坐标系 from 转换到坐标系 to
+// 经纬度均为 0 表示没有坐标，不做转换；外包矩形始终为 WGS84，不做转换
+func (r *Road) ConvertCRS(from, to geo.CRS) {
+	if r.Latitude != 0 || r.Longitude != 0 {
+		p := geo.Convert(r.Point(), from, to)
+		r.Longitude, r.Latitude = p.Lon(), p.Lat()
+	}
+	r.Geometry = r.Geometry.Convert(from, to)
 }
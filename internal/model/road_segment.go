@@ -0,0 +1,62 @@
+package model
+
+import (
+	"math"
+
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+)
+
+// RoadSegment 定义路段的结构体，路段为道路上起止桩号之间的部分
+// Geometry 为生成路段时从道路几何形状中截取的部分，道路几何形状修改后需要重新生成路段
+type RoadSegment struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	TenantID      uint           `json:"tenant_id"`
+	RoadID        uint           `json:"road_id" gorm:"index"`
+	Name          string         `json:"name"`
+	StartChainage geo.Chainage   `json:"start_chainage"`
+	EndChainage   geo.Chainage   `json:"end_chainage"`
+	Length        float64        `json:"length"`
+	Geometry      geo.LineString `json:"geometry" gorm:"type:text"`
+
+	Road Road `json:"-" gorm:"foreignKey:RoadID"`
+}
+
+// Contains 判断里程是否在路段范围内（含两端）
+func (s *RoadSegment) Contains(chainage geo.Chainage) bool {
+	return chainage >= s.StartChainage && chainage <= s.EndChainage
+}
+
+// ConvertCRS 将路段的几何形状从坐标系 from 转换到坐标系 to
+func (s *RoadSegment) ConvertCRS(from, to geo.CRS) {
+	s.Geometry = s.Geometry.Convert(from, to)
+}
+
+// SplitRoad 按固定间隔将道路的几何形状划分为路段，start 为道路起点的桩号
+// 分段点取 interval 的整数倍，因此起点桩号不是 interval 整数倍时第一段较短，最后一段为剩余的长度
+func SplitRoad(road *Road, start geo.Chainage, interval float64) []RoadSegment {
+	length := road.Geometry.Length()
+	if length == 0 || interval <= 0 {
+		return nil
+	}
+	end := start + geo.Chainage(length)
+	var segments []RoadSegment
+	k := math.Floor(float64(start)/interval) + 1
+	for from := start; from < end; k++ {
+		to := geo.Chainage(k * interval)
+		// 不足一厘米的剩余部分并入当前路段
+		if end-to < 0.01 {
+			to = end
+		}
+		geometry := road.Geometry.Slice(float64(from-start), float64(to-start))
+		segments = append(segments, RoadSegment{
+			RoadID:        road.ID,
+			Name:          from.String() + "-" + to.String(),
+			StartChainage: from,
+			EndChainage:   to,
+			Length:        float64(to - from),
+			Geometry:      geometry,
+		})
+		from = to
+	}
+	return segments
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// 道路变更的类型
+const (
+	// RoadChangeBaseline 为开始记录历史时道路已有的状态，变更时间为记录的时间，视为此前一直有效
+	RoadChangeBaseline = "baseline"
+	RoadChangeCreate   = "create"
+	RoadChangeUpdate   = "update"
+	RoadChangeDelete   = "delete"
+)
+
+// RoadVersion 定义道路历史版本的结构体，记录每次变更后道路的完整状态、变更人和变更时间
+// 删除道路时记录删除前的状态，道路删除后其历史仍然保留
+type RoadVersion struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	TenantID uint   `json:"tenant_id"`
+	RoadID   uint   `json:"road_id" gorm:"index:idx_road_version,priority:1"`
+	Version  int    `json:"version"`
+	Action   string `json:"action" gorm:"size:16"`
+	// Changes 为与上一个版本相比发生变化的字段，使用 JSON 名称
+	Changes   StringList   `json:"changes" gorm:"type:text"`
+	Road      RoadSnapshot `json:"road" gorm:"type:mediumtext"`
+	ChangedBy *uint        `json:"changed_by"`
+	ChangedAt time.Time    `json:"changed_at" gorm:"index:idx_road_version,priority:2"`
+}
+
+// RoadSnapshot 为以 JSON 保存的道路状态，外包矩形不保存
+type RoadSnapshot Road
+
+// Value 实现 driver.Valuer
+func (s RoadSnapshot) Value() (driver.Value, error) {
+	data, err := json.Marshal(Road(s))
+	return string(data), err
+}
+
+// Scan 实现 sql.Scanner
+func (s *RoadSnapshot) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return errors.New("unsupported type for RoadSnapshot")
+	}
+	return json.Unmarshal(data, (*Road)(s))
+}
+
+// RoadChanges 返回两个道路状态之间发生变化的字段，使用 JSON 名称并按字母顺序排列
+func RoadChanges(before, after *Road) []string {
+	var b, a map[string]interface{}
+	data, _ := json.Marshal(before)
+	_ = json.Unmarshal(data, &b)
+	data, _ = json.Marshal(after)
+	_ = json.Unmarshal(data, &a)
+	var changes []string
+	for field, value := range a {
+		if !reflect.DeepEqual(b[field], value) {
+			changes = append(changes, field)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
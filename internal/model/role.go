@@ -0,0 +1,16 @@
+package model
+
+// Role 定义租户自定义角色的结构体
+type Role struct {
+	ID          uint             `json:"id" gorm:"primaryKey"`
+	TenantID    uint             `json:"tenant_id" gorm:"uniqueIndex:idx_role_tenant_name"`
+	Name        string           `json:"name" gorm:"size:64;uniqueIndex:idx_role_tenant_name"`
+	Description string           `json:"description"`
+	Permissions []RolePermission `json:"-" gorm:"foreignKey:RoleID;constraint:OnDelete:CASCADE"`
+}
+
+// RolePermission 定义角色与权限之间多对多关系的结构体
+type RolePermission struct {
+	RoleID     uint   `json:"role_id" gorm:"primaryKey"`
+	Permission string `json:"permission" gorm:"primaryKey;size:64"`
+}
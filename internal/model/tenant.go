@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+const (
+	TenantActive    = "active"
+	TenantSuspended = "suspended"
+)
+
+// Tenant 定义租户的结构体，其他模型中的 TenantID 均指向该表
+type Tenant struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"size:191;uniqueIndex"`
+	Status    string    `json:"status" gorm:"size:16;default:active"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// 租户配额，0 表示不限制
+	MaxUsers       int `json:"max_users"`
+	MaxRoads       int `json:"max_roads"`
+	MaxActivePlans int `json:"max_active_plans"`
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// TenantSetting 定义租户级安全设置的结构体
+type TenantSetting struct {
+	TenantID        uint      `json:"tenant_id" gorm:"primaryKey;autoIncrement:false"`
+	RequireAdminMFA bool      `json:"require_admin_mfa"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
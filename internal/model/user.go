@@ -2,9 +2,17 @@ package model
 
 // User 定义用户的结构体
 type User struct {
-	ID       uint   `json:"id" gorm:"primaryKey"`
-	TenantID uint   `json:"tenant_id"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Role     string `json:"role"`
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	TenantID    uint   `json:"tenant_id"`
+	Username    string `json:"username"`
+	Password    string `json:"-"`
+	Role        string `json:"role"`
+	Email       string `json:"email"`
+	Phone       string `json:"phone"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// TOTPSecret 在启用前保存待确认的密钥，启用后保存正式密钥
+	TOTPSecret   string `json:"-"`
+	TOTPLastStep int64  `json:"-"`
+	// MFAChallengeID 为最近签发的两步验证挑战令牌的ID，两步验证完成后清空，使挑战令牌只能使用一次
+	MFAChallengeID string `json:"-" gorm:"size:64"`
 }
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// 受控词表的种类
+const (
+	VocabularyRoadType        = "road_type"
+	VocabularySurfaceMaterial = "surface_material"
+	VocabularyAssetType       = "asset_type"
+)
+
+// VocabularyKinds 为全部词表种类
+var VocabularyKinds = []string{VocabularyRoadType, VocabularySurfaceMaterial, VocabularyAssetType}
+
+// VocabularyTerm 定义租户受控词表中的一个词条
+// 道路的类型、路面材料或设施的类型与 Value 或任一别名相同（不区分大小写）时视为该词条，保存为 Value 的写法
+type VocabularyTerm struct {
+	ID       uint       `json:"id" gorm:"primaryKey"`
+	TenantID uint       `json:"tenant_id" gorm:"uniqueIndex:idx_vocabulary_term"`
+	Kind     string     `json:"kind" gorm:"size:32;uniqueIndex:idx_vocabulary_term"`
+	Value    string     `json:"value" gorm:"size:64;uniqueIndex:idx_vocabulary_term"`
+	Aliases  StringList `json:"aliases" gorm:"type:text"`
+}
+
+// Matches 判断 v 是否为该词条的值或别名
+func (t *VocabularyTerm) Matches(v string) bool {
+	if strings.EqualFold(t.Value, v) {
+		return true
+	}
+	for _, alias := range t.Aliases {
+		if strings.EqualFold(alias, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Names 返回词条的值和全部别名
+func (t *VocabularyTerm) Names() []string {
+	return append([]string{t.Value}, t.Aliases...)
+}
+
+// StringList 为以 JSON 数组保存的字符串列表
+type StringList []string
+
+// Value 实现 driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(l))
+	return string(data), err
+}
+
+// Scan 实现 sql.Scanner
+func (l *StringList) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return errors.New("unsupported type for StringList")
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+// Vocabulary 为租户的全部词条，按种类分组
+type Vocabulary map[string][]VocabularyTerm
+
+// NewVocabulary 将词条按种类分组
+func NewVocabulary(terms []VocabularyTerm) Vocabulary {
+	v := Vocabulary{}
+	for _, term := range terms {
+		v[term.Kind] = append(v[term.Kind], term)
+	}
+	return v
+}
+
+// Normalize 返回与 value 匹配的词条的值，种类没有任何词条时不做限制，原样返回
+func (v Vocabulary) Normalize(kind, value string) (string, bool) {
+	terms := v[kind]
+	if len(terms) == 0 {
+		return value, true
+	}
+	for i := range terms {
+		if terms[i].Matches(value) {
+			return terms[i].Value, true
+		}
+	}
+	return value, false
+}
+
+// NormalizeRoad 将道路的类型和路面材料统一为词表中的写法，不在词表中的值记入 errs，空值表示未设置，不做检查
+func (v Vocabulary) NormalizeRoad(road *Road, errs FieldErrors) {
+	v.normalizeField(errs, "type", VocabularyRoadType, &road.Type)
+	v.normalizeField(errs, "surface_material", VocabularySurfaceMaterial, &road.SurfaceMaterial)
+}
+
+// NormalizeAsset 将设施的类型统一为词表中的写法，不在词表中的值记入 errs，空值表示未设置，不做检查
+func (v Vocabulary) NormalizeAsset(asset *Asset, errs FieldErrors) {
+	v.normalizeField(errs, "type", VocabularyAssetType, &asset.Type)
+}
+
+func (v Vocabulary) normalizeField(errs FieldErrors, field, kind string, value *string) {
+	if *value == "" {
+		return
+	}
+	normalized, ok := v.Normalize(kind, *value)
+	if !ok {
+		errs[field] = "must be one of " + strings.Join(v.values(kind), ", ")
+		return
+	}
+	*value = normalized
+}
+
+func (v Vocabulary) values(kind string) []string {
+	values := make([]string, 0, len(v[kind]))
+	for _, term := range v[kind] {
+		values = append(values, term.Value)
+	}
+	return values
+}
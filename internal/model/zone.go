@@ -0,0 +1,102 @@
+package model
+
+import (
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/pkg/geo"
+)
+
+// Zone 定义管理区域的结构体，区域按 ParentID 组成树，例如片区下设养护工区
+// Boundary 为可选的区域边界，用于按位置把道路自动划入区域
+type Zone struct {
+	ID        uint        `json:"id" gorm:"primaryKey"`
+	TenantID  uint        `json:"tenant_id"`
+	ParentID  *uint       `json:"parent_id" gorm:"index"`
+	Name      string      `json:"name" gorm:"size:128"`
+	Kind      string      `json:"kind" gorm:"size:32"`
+	Boundary  geo.Polygon `json:"boundary" gorm:"type:text"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// Validate 检查区域字段的取值范围，零值表示未设置，不做检查，因此也适用于部分更新
+// 上级区域需要查询数据库，不在此检查
+func (z *Zone) Validate() FieldErrors {
+	errs := FieldErrors{}
+	if len(z.Name) > 128 {
+		errs["name"] = "must be at most 128 characters"
+	}
+	if len(z.Kind) > 32 {
+		errs["kind"] = "must be at most 32 characters"
+	}
+	if z.Boundary != nil {
+		if err := z.Boundary.Validate(); err != nil {
+			errs["boundary"] = err.Error()
+		}
+	}
+	return errs
+}
+
+// ConvertCRS 将区域边界从坐标系 from 转换到坐标系 to
+func (z *Zone) ConvertCRS(from, to geo.CRS) {
+	z.Boundary = z.Boundary.Convert(from, to)
+}
+
+// ZoneTree 为租户全部区域按上下级关系建立的索引
+type ZoneTree struct {
+	zones    map[uint]*Zone
+	children map[uint][]uint
+}
+
+// NewZoneTree 根据区域列表建立区域树
+func NewZoneTree(zones []Zone) *ZoneTree {
+	tree := &ZoneTree{zones: make(map[uint]*Zone, len(zones)), children: make(map[uint][]uint)}
+	for i := range zones {
+		zone := &zones[i]
+		tree.zones[zone.ID] = zone
+		if zone.ParentID != nil {
+			tree.children[*zone.ParentID] = append(tree.children[*zone.ParentID], zone.ID)
+		}
+	}
+	return tree
+}
+
+// Has 判断区域是否存在
+func (t *ZoneTree) Has(id uint) bool {
+	_, ok := t.zones[id]
+	return ok
+}
+
+// Descendants 返回区域本身及其全部下级区域的 ID
+func (t *ZoneTree) Descendants(id uint) []uint {
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, t.children[ids[i]]...)
+	}
+	return ids
+}
+
+// Depth 返回区域在树中的层级，顶级区域为 0
+func (t *ZoneTree) Depth(id uint) int {
+	depth := 0
+	for zone := t.zones[id]; zone != nil && zone.ParentID != nil && depth <= len(t.zones); zone = t.zones[*zone.ParentID] {
+		depth++
+	}
+	return depth
+}
+
+// Locate 返回包含点的层级最深的区域，没有区域包含该点时返回 nil，层级相同时取 ID 较小的区域
+func (t *ZoneTree) Locate(p geo.Point) *Zone {
+	var found *Zone
+	foundDepth := -1
+	for id, zone := range t.zones {
+		if zone.Boundary == nil || !zone.Boundary.Contains(p) {
+			continue
+		}
+		depth := t.Depth(id)
+		if depth > foundDepth || depth == foundDepth && zone.ID < found.ID {
+			found, foundDepth = zone, depth
+		}
+	}
+	return found
+}
@@ -0,0 +1,34 @@
+package rbac
+
+import (
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/password"
+)
+
+// BootstrapSuperAdmin 在平台租户中还没有超级管理员时，使用配置中的用户名和密码创建一个
+func BootstrapSuperAdmin() error {
+	if config.SuperAdminUsername == "" || config.SuperAdminPassword == "" {
+		return nil
+	}
+
+	db := tenancy.Scoped(config.DB, tenancy.PlatformTenantID)
+	config.DbMutex.Lock()
+	defer config.DbMutex.Unlock()
+	var count int64
+	err := db.Model(&model.User{}).Where("role = ?", SuperAdminRole).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+
+	hashed, err := password.Hash(config.SuperAdminPassword)
+	if err != nil {
+		return err
+	}
+	return db.Create(&model.User{
+		Username: config.SuperAdminUsername,
+		Password: hashed,
+		Role:     SuperAdminRole,
+	}).Error
+}
@@ -0,0 +1,160 @@
+package rbac
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+)
+
+// 权限以 "资源:操作" 的形式命名
+// plan:manage_all 和 report:manage_all 允许修改他人的巡检任务和报告，没有这两个权限时只能修改分配给自己的任务及其报告
+const (
+	RoadRead        = "road:read"
+	RoadWrite       = "road:write"
+	UserRead        = "user:read"
+	UserWrite       = "user:write"
+	PlanRead        = "plan:read"
+	PlanWrite       = "plan:write"
+	PlanManageAll   = "plan:manage_all"
+	ReportRead      = "report:read"
+	ReportWrite     = "report:write"
+	ReportApprove   = "report:approve"
+	ReportManageAll = "report:manage_all"
+	RoleManage      = "role:manage"
+	TenantConfig    = "tenant:config"
+)
+
+// Permissions 为租户内可分配的全部权限
+var Permissions = []string{
+	RoadRead, RoadWrite,
+	UserRead, UserWrite,
+	PlanRead, PlanWrite, PlanManageAll,
+	ReportRead, ReportWrite, ReportApprove, ReportManageAll,
+	RoleManage, TenantConfig,
+}
+
+// 平台租户（tenancy.PlatformTenantID）中只有管理全部租户的超级管理员
+const (
+	SuperAdminRole = "superadmin"
+	// TenantManage 允许创建、停用和删除租户，只授予平台租户中的角色，不能分配给租户内的角色
+	TenantManage = "tenant:manage"
+)
+
+// PlatformRoles 为平台租户中的角色
+var PlatformRoles = map[string][]string{
+	SuperAdminRole: {TenantManage},
+}
+
+// BuiltinRoles 为每个租户都存在的内置角色，不能修改或删除
+var BuiltinRoles = map[string][]string{
+	"admin": Permissions,
+	"inspector": {
+		RoadRead,
+		UserRead,
+		PlanRead, PlanWrite,
+		ReportRead, ReportWrite,
+	},
+}
+
+// cacheTTL 为权限缓存的有效期，多实例部署时其他实例的角色修改最多延迟这么久生效
+const cacheTTL = 30 * time.Second
+
+type cacheEntry struct {
+	permissions map[string]bool
+	expiresAt   time.Time
+}
+
+var (
+	cacheMutex sync.Mutex
+	cache      = make(map[string]cacheEntry)
+)
+
+// IsValidPermission 判断权限名称是否存在
+func IsValidPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBuiltinRole 判断角色是否为内置角色
+func IsBuiltinRole(role string) bool {
+	_, ok := BuiltinRoles[role]
+	return ok
+}
+
+// RoleExists 判断角色在租户内是否存在（内置角色或自定义角色）
+func RoleExists(tenantID uint, role string) (bool, error) {
+	if IsBuiltinRole(role) {
+		return true, nil
+	}
+	var count int64
+	config.DbMutex.Lock()
+	err := tenancy.Scoped(config.DB, tenantID).Model(&model.Role{}).Where("name = ?", role).Count(&count).Error
+	config.DbMutex.Unlock()
+	return count > 0, err
+}
+
+// RolePermissions 返回租户内某个角色拥有的权限集合
+func RolePermissions(tenantID uint, role string) (map[string]bool, error) {
+	key := cacheKey(tenantID, role)
+	cacheMutex.Lock()
+	entry, ok := cache[key]
+	cacheMutex.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.permissions, nil
+	}
+
+	permissions := make(map[string]bool)
+	if tenantID == tenancy.PlatformTenantID {
+		for _, p := range PlatformRoles[role] {
+			permissions[p] = true
+		}
+	} else if builtin, ok := BuiltinRoles[role]; ok {
+		for _, p := range builtin {
+			permissions[p] = true
+		}
+	} else {
+		var names []string
+		config.DbMutex.Lock()
+		err := config.DB.Model(&model.RolePermission{}).
+			Joins("JOIN roles ON roles.id = role_permissions.role_id").
+			Where("roles.tenant_id = ? AND roles.name = ?", tenantID, role).
+			Pluck("role_permissions.permission", &names).Error
+		config.DbMutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range names {
+			permissions[p] = true
+		}
+	}
+
+	cacheMutex.Lock()
+	cache[key] = cacheEntry{permissions: permissions, expiresAt: time.Now().Add(cacheTTL)}
+	cacheMutex.Unlock()
+	return permissions, nil
+}
+
+// Invalidate 清除租户内全部角色的权限缓存，应在修改角色后调用
+func Invalidate(tenantID uint) {
+	prefix := strconv.FormatUint(uint64(tenantID), 10) + ":"
+	cacheMutex.Lock()
+	for key := range cache {
+		if strings.HasPrefix(key, prefix) {
+			delete(cache, key)
+		}
+	}
+	cacheMutex.Unlock()
+}
+
+func cacheKey(tenantID uint, role string) string {
+	return strconv.FormatUint(uint64(tenantID), 10) + ":" + role
+}
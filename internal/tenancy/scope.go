@@ -0,0 +1,137 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrNoTenant 表示对带有 tenant_id 的表执行操作时上下文中没有租户
+var ErrNoTenant = errors.New("tenancy: no tenant in context for a tenant-scoped query")
+
+// ErrTenantMismatch 表示创建的记录中显式设置了与上下文不一致的租户
+var ErrTenantMismatch = errors.New("tenancy: record belongs to a different tenant")
+
+const tenantColumn = "tenant_id"
+
+type tenantKey struct{}
+
+type allTenantsKey struct{}
+
+// WithTenant 返回携带租户ID的上下文
+func WithTenant(ctx context.Context, tenantID uint) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext 读取上下文中的租户ID
+func TenantFromContext(ctx context.Context) (uint, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(uint)
+	return tenantID, ok
+}
+
+// Scoped 返回限定在指定租户内的数据库会话，所有查询、更新和删除都只作用于该租户的数据，创建的记录自动归属该租户
+func Scoped(db *gorm.DB, tenantID uint) *gorm.DB {
+	return db.WithContext(WithTenant(statementContext(db), tenantID))
+}
+
+// AllTenants 返回不做租户限定的数据库会话，只用于确实需要跨租户的场景（如按令牌哈希查找、租户管理和数据迁移）
+func AllTenants(db *gorm.DB) *gorm.DB {
+	return db.WithContext(context.WithValue(statementContext(db), allTenantsKey{}, true))
+}
+
+func statementContext(db *gorm.DB) context.Context {
+	if db.Statement != nil && db.Statement.Context != nil {
+		return db.Statement.Context
+	}
+	return context.Background()
+}
+
+// Register 在数据库上注册租户限定的回调
+// 对于带有 TenantID 字段的模型：查询、更新和删除自动追加 tenant_id 条件，更新时不允许修改 tenant_id，
+// 创建时自动写入租户；上下文中既没有租户也没有声明 AllTenants 时直接返回 ErrNoTenant
+// 原生 SQL（Raw、Exec）不经过这些回调，需要自行处理租户条件
+func Register(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("tenancy:query", scopeCondition); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("tenancy:row", scopeCondition); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("tenancy:update", scopeUpdate); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("tenancy:delete", scopeCondition); err != nil {
+		return err
+	}
+	return db.Callback().Create().Before("gorm:create").Register("tenancy:create", stampCreate)
+}
+
+// tenantField 返回语句所操作模型的 TenantID 字段，模型没有该字段或需要跳过时返回 nil
+func tenantField(db *gorm.DB) (*schema.Field, uint, bool) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return nil, 0, false
+	}
+	field := stmt.Schema.LookUpField(tenantColumn)
+	if field == nil {
+		return nil, 0, false
+	}
+	if skip, _ := stmt.Context.Value(allTenantsKey{}).(bool); skip {
+		return nil, 0, false
+	}
+	tenantID, ok := TenantFromContext(stmt.Context)
+	if !ok {
+		_ = db.AddError(ErrNoTenant)
+		return nil, 0, false
+	}
+	return field, tenantID, true
+}
+
+func scopeCondition(db *gorm.DB) {
+	field, tenantID, ok := tenantField(db)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenantID},
+	}})
+}
+
+func scopeUpdate(db *gorm.DB) {
+	field, _, ok := tenantField(db)
+	if !ok {
+		return
+	}
+	db.Statement.Omits = append(db.Statement.Omits, field.DBName)
+	scopeCondition(db)
+}
+
+func stampCreate(db *gorm.DB) {
+	field, tenantID, ok := tenantField(db)
+	if !ok {
+		return
+	}
+	stamp := func(rv reflect.Value) {
+		if value, zero := field.ValueOf(db.Statement.Context, rv); !zero && value != tenantID {
+			_ = db.AddError(ErrTenantMismatch)
+			return
+		}
+		if err := field.Set(db.Statement.Context, rv, tenantID); err != nil {
+			_ = db.AddError(err)
+		}
+	}
+
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			stamp(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		stamp(rv)
+	}
+}
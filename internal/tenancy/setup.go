@@ -0,0 +1,102 @@
+package tenancy
+
+import (
+	"strconv"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// Backfill 为已有数据中出现过、但还没有对应租户记录的 tenant_id 补建租户
+func Backfill() error {
+	config.DbMutex.Lock()
+	defer config.DbMutex.Unlock()
+
+	seen := make(map[uint]bool)
+	for _, table := range []interface{}{&model.User{}, &model.Road{}, &model.Plan{}, &model.Report{}} {
+		var ids []uint
+		if err := AllTenants(config.DB).Model(table).Distinct().Pluck("tenant_id", &ids).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if id != PlatformTenantID {
+				seen[id] = true
+			}
+		}
+	}
+
+	for id := range seen {
+		var count int64
+		if err := config.DB.Model(&model.Tenant{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		tenant := model.Tenant{ID: id, Name: "tenant-" + strconv.FormatUint(uint64(id), 10), Status: model.TenantActive}
+		if err := config.DB.Create(&tenant).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AdoptPlatformData 将平台租户中的业务数据移入一个新建的租户，返回新租户的ID，没有需要移动的数据时返回 0
+// 引入租户之前，缺少 tenant_id 的请求会把数据写入 tenant_id 为 0 的记录，而 0 现在是平台租户，这些数据需要移到真正的租户中
+// platformRoles 为平台租户自身的角色，拥有这些角色的用户及其令牌留在平台租户中
+func AdoptPlatformData(platformRoles []string) (uint, error) {
+	config.DbMutex.Lock()
+	defer config.DbMutex.Unlock()
+
+	db := AllTenants(config.DB)
+	platformUsers := db.Model(&model.User{}).Select("id").Where("tenant_id = ? AND role IN ?", PlatformTenantID, platformRoles)
+	var count int64
+	if err := db.Model(&model.User{}).Where("tenant_id = ? AND role NOT IN ?", PlatformTenantID, platformRoles).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	for _, table := range []interface{}{&model.Road{}, &model.Plan{}, &model.Report{}} {
+		var n int64
+		if err := db.Model(table).Where("tenant_id = ?", PlatformTenantID).Count(&n).Error; err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	var tenantID uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		tenant := model.Tenant{Name: "tenant-0", Status: model.TenantActive}
+		if err := tx.Create(&tenant).Error; err != nil {
+			return err
+		}
+		tenantID = tenant.ID
+
+		// 令牌和恢复码跟随所属用户，需要在移动用户之前处理
+		for _, table := range []interface{}{&model.RefreshToken{}, &model.RecoveryCode{}, &model.PasswordResetToken{}} {
+			err := tx.Model(table).Where("tenant_id = ? AND user_id NOT IN (?)", PlatformTenantID, platformUsers).
+				Update("tenant_id", tenantID).Error
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Model(&model.User{}).Where("tenant_id = ? AND role NOT IN ?", PlatformTenantID, platformRoles).
+			Update("tenant_id", tenantID).Error
+		if err != nil {
+			return err
+		}
+		for _, table := range []interface{}{
+			&model.Road{}, &model.RoadSegment{}, &model.RoadVersion{}, &model.Asset{}, &model.Zone{},
+			&model.Plan{}, &model.PlanRoad{}, &model.PlanSegment{}, &model.Report{}, &model.ReportAsset{},
+			&model.VocabularyTerm{}, &model.TenantSetting{}, &model.Role{},
+		} {
+			if err := tx.Model(table).Where("tenant_id = ?", PlatformTenantID).Update("tenant_id", tenantID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return tenantID, err
+}
@@ -0,0 +1,124 @@
+package tenancy
+
+import (
+	"testing"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB 打开一个内存中的 SQLite 数据库作为 config.DB，迁移全部表并注册租户回调
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接各自独立，只保留一个连接
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	err = db.AutoMigrate(&model.Road{}, &model.User{}, &model.Plan{}, &model.Report{}, &model.PlanRoad{}, &model.RoadSegment{}, &model.PlanSegment{}, &model.Asset{}, &model.ReportAsset{}, &model.VocabularyTerm{}, &model.Zone{}, &model.RoadVersion{}, &model.RefreshToken{}, &model.RecoveryCode{}, &model.TenantSetting{}, &model.Role{}, &model.RolePermission{}, &model.PasswordResetToken{}, &model.Tenant{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db); err != nil {
+		t.Fatal(err)
+	}
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() { config.DB = previous })
+	return db
+}
+
+func TestAdoptPlatformData(t *testing.T) {
+	db := openTestDB(t)
+	platform := Scoped(db, PlatformTenantID)
+	superAdmin := model.User{Username: "root", Password: "x", Role: "superadmin"}
+	admin := model.User{Username: "admin", Password: "x", Role: "admin"}
+	for _, user := range []*model.User{&superAdmin, &admin} {
+		if err := platform.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := platform.Create(&model.RefreshToken{UserID: user.ID, TokenID: user.Username}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	road := model.Road{Name: "road"}
+	if err := platform.Create(&road).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := platform.Create(&model.Plan{InspectorID: admin.ID, Status: "pending"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tenantID, err := AdoptPlatformData([]string{"superadmin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenantID == PlatformTenantID {
+		t.Fatal("AdoptPlatformData() did not create a tenant")
+	}
+	var tenant model.Tenant
+	if err := db.First(&tenant, tenantID).Error; err != nil || tenant.Name != "tenant-0" || tenant.Status != model.TenantActive {
+		t.Errorf("created tenant = %+v, %v", tenant, err)
+	}
+
+	moved := Scoped(db, tenantID)
+	for _, tt := range []struct {
+		name  string
+		db    *gorm.DB
+		model interface{}
+		want  int64
+	}{
+		{"platform users", platform, &model.User{}, 1},
+		{"platform refresh tokens", platform, &model.RefreshToken{}, 1},
+		{"platform roads", platform, &model.Road{}, 0},
+		{"moved users", moved, &model.User{}, 1},
+		{"moved refresh tokens", moved, &model.RefreshToken{}, 1},
+		{"moved roads", moved, &model.Road{}, 1},
+		{"moved plans", moved, &model.Plan{}, 1},
+	} {
+		var count int64
+		if err := tt.db.Model(tt.model).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != tt.want {
+			t.Errorf("%s: count = %d, want %d", tt.name, count, tt.want)
+		}
+	}
+	var user model.User
+	if err := platform.First(&user).Error; err != nil || user.ID != superAdmin.ID {
+		t.Errorf("platform user = %+v, %v, want the super admin", user, err)
+	}
+
+	// 再次启动时平台租户中只剩超级管理员，不再新建租户
+	again, err := AdoptPlatformData([]string{"superadmin"})
+	if err != nil || again != 0 {
+		t.Errorf("second AdoptPlatformData() = %d, %v, want 0", again, err)
+	}
+}
+
+func TestAdoptPlatformDataNothingToMove(t *testing.T) {
+	db := openTestDB(t)
+	if err := Scoped(db, PlatformTenantID).Create(&model.User{Username: "root", Password: "x", Role: "superadmin"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := Scoped(db, 1).Create(&model.Road{Name: "road"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	tenantID, err := AdoptPlatformData([]string{"superadmin"})
+	if err != nil || tenantID != 0 {
+		t.Errorf("AdoptPlatformData() = %d, %v, want 0", tenantID, err)
+	}
+	var count int64
+	if err := db.Model(&model.Tenant{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("tenants = %d, %v, want none", count, err)
+	}
+}
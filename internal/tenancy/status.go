@@ -0,0 +1,72 @@
+package tenancy
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// PlatformTenantID 为平台租户，不属于任何业务租户，只用于存放管理全部租户的超级管理员
+const PlatformTenantID uint = 0
+
+var (
+	ErrTenantNotFound  = errors.New("tenant does not exist")
+	ErrTenantSuspended = errors.New("tenant is suspended")
+)
+
+// cacheTTL 为租户状态缓存的有效期，多实例部署时其他实例停用租户最多延迟这么久生效
+const cacheTTL = 30 * time.Second
+
+type cacheEntry struct {
+	status    string
+	expiresAt time.Time
+}
+
+var (
+	cacheMutex sync.Mutex
+	cache      = make(map[uint]cacheEntry)
+)
+
+// CheckActive 检查租户是否存在且处于启用状态，平台租户始终视为启用
+func CheckActive(tenantID uint) error {
+	if tenantID == PlatformTenantID {
+		return nil
+	}
+
+	cacheMutex.Lock()
+	entry, ok := cache[tenantID]
+	cacheMutex.Unlock()
+	if !ok || time.Now().After(entry.expiresAt) {
+		var tenant model.Tenant
+		config.DbMutex.Lock()
+		err := config.DB.Select("status").Where("id = ?", tenantID).First(&tenant).Error
+		config.DbMutex.Unlock()
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		entry = cacheEntry{status: tenant.Status, expiresAt: time.Now().Add(cacheTTL)}
+		cacheMutex.Lock()
+		cache[tenantID] = entry
+		cacheMutex.Unlock()
+	}
+
+	switch entry.status {
+	case model.TenantActive:
+		return nil
+	case "":
+		return ErrTenantNotFound
+	default:
+		return ErrTenantSuspended
+	}
+}
+
+// Invalidate 清除租户状态缓存，应在修改租户状态后调用
+func Invalidate(tenantID uint) {
+	cacheMutex.Lock()
+	delete(cache, tenantID)
+	cacheMutex.Unlock()
+}
@@ -0,0 +1,209 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// metersPerDegree 为赤道上一度经度（或任意位置一度纬度）对应的近似米数
+const metersPerDegree = 111320.0
+
+// BBox 为经纬度外包矩形，不支持跨越 180 度经线的矩形
+type BBox struct {
+	MinLon float64
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+}
+
+// ParseBBox 解析 minLon,minLat,maxLon,maxLat 格式的外包矩形
+func ParseBBox(s string) (BBox, error) {
+	values, err := parseFloats(s, 4)
+	if err != nil {
+		return BBox{}, err
+	}
+	b := BBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	if err := (Point{b.MinLon, b.MinLat}).Validate(); err != nil {
+		return BBox{}, err
+	}
+	if err := (Point{b.MaxLon, b.MaxLat}).Validate(); err != nil {
+		return BBox{}, err
+	}
+	if b.MinLon > b.MaxLon || b.MinLat > b.MaxLat {
+		return BBox{}, fmt.Errorf("bbox %q must be minLon,minLat,maxLon,maxLat", s)
+	}
+	return b, nil
+}
+
+// ParseLatLon 解析 lat,lon 格式的坐标，注意顺序为纬度在前
+func ParseLatLon(s string) (Point, error) {
+	values, err := parseFloats(s, 2)
+	if err != nil {
+		return Point{}, err
+	}
+	p := Point{values[1], values[0]}
+	return p, p.Validate()
+}
+
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d comma-separated numbers, got %q", n, s)
+	}
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", part)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// PointBBox 返回只包含一个点的外包矩形
+func PointBBox(p Point) BBox {
+	return BBox{MinLon: p.Lon(), MinLat: p.Lat(), MaxLon: p.Lon(), MaxLat: p.Lat()}
+}
+
+// Bounds 返回折线的外包矩形
+func (l LineString) Bounds() BBox {
+	if len(l) == 0 {
+		return BBox{}
+	}
+	b := PointBBox(l[0])
+	for _, p := range l[1:] {
+		b.MinLon = math.Min(b.MinLon, p.Lon())
+		b.MinLat = math.Min(b.MinLat, p.Lat())
+		b.MaxLon = math.Max(b.MaxLon, p.Lon())
+		b.MaxLat = math.Max(b.MaxLat, p.Lat())
+	}
+	return b
+}
+
+// Around 返回以 p 为中心、覆盖半径 radius 米范围的外包矩形，覆盖到极点时经度取全部范围
+func Around(p Point, radius float64) BBox {
+	dLat := radius / metersPerDegree
+	b := BBox{MinLat: p.Lat() - dLat, MaxLat: p.Lat() + dLat, MinLon: -180, MaxLon: 180}
+	if b.MinLat <= -90 || b.MaxLat >= 90 {
+		b.MinLat, b.MaxLat = math.Max(b.MinLat, -90), math.Min(b.MaxLat, 90)
+		return b
+	}
+	// 取纬度绝对值较大的一侧计算经度跨度，保证覆盖整个圆
+	cos := math.Cos(toRadians(math.Max(math.Abs(b.MinLat), math.Abs(b.MaxLat))))
+	dLon := radius / (metersPerDegree * cos)
+	if dLon < 180 {
+		b.MinLon, b.MaxLon = math.Max(p.Lon()-dLon, -180), math.Min(p.Lon()+dLon, 180)
+	}
+	return b
+}
+
+// Inside 返回以 p 为中心、完全落在半径 radius 米范围内的外包矩形，矩形内任意一点到 p 的距离都小于 radius
+// 矩形取圆的内接正方形并留出一成余量；覆盖到极点或跨越 180 度经线时返回 false
+func Inside(p Point, radius float64) (BBox, bool) {
+	half := radius / math.Sqrt2 * 0.9
+	dLat := half / metersPerDegree
+	b := BBox{MinLat: p.Lat() - dLat, MaxLat: p.Lat() + dLat}
+	if b.MinLat <= -90 || b.MaxLat >= 90 {
+		return BBox{}, false
+	}
+	// 取纬度绝对值较小的一侧计算经度跨度，保证矩形在圆内
+	cos := 1.0
+	if b.MinLat > 0 || b.MaxLat < 0 {
+		cos = math.Cos(toRadians(math.Min(math.Abs(b.MinLat), math.Abs(b.MaxLat))))
+	}
+	dLon := half / (metersPerDegree * cos)
+	b.MinLon, b.MaxLon = p.Lon()-dLon, p.Lon()+dLon
+	if b.MinLon < -180 || b.MaxLon > 180 {
+		return BBox{}, false
+	}
+	return b, true
+}
+
+// Center 返回外包矩形的中心点
+func (b BBox) Center() Point {
+	return Point{(b.MinLon + b.MaxLon) / 2, (b.MinLat + b.MaxLat) / 2}
+}
+
+// Contains 判断点是否在外包矩形内（含边界）
+func (b BBox) Contains(p Point) bool {
+	return p.Lon() >= b.MinLon && p.Lon() <= b.MaxLon && p.Lat() >= b.MinLat && p.Lat() <= b.MaxLat
+}
+
+// Intersects 判断两个外包矩形是否相交（含边界）
+func (b BBox) Intersects(o BBox) bool {
+	return b.MinLon <= o.MaxLon && b.MaxLon >= o.MinLon && b.MinLat <= o.MaxLat && b.MaxLat >= o.MinLat
+}
+
+// IntersectsBBox 判断折线是否与外包矩形相交，即有顶点落在矩形内或有线段穿过矩形
+func (l LineString) IntersectsBBox(b BBox) bool {
+	if len(l) == 1 {
+		return b.Contains(l[0])
+	}
+	for i := 1; i < len(l); i++ {
+		if segmentIntersectsBBox(l[i-1], l[i], b) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentIntersectsBBox 使用 Liang-Barsky 算法判断线段是否与矩形相交
+func segmentIntersectsBBox(a, c Point, b BBox) bool {
+	t0, t1 := 0.0, 1.0
+	dx, dy := c.Lon()-a.Lon(), c.Lat()-a.Lat()
+	clip := func(p, q float64) bool {
+		if p == 0 {
+			return q >= 0
+		}
+		r := q / p
+		if p < 0 {
+			if r > t1 {
+				return false
+			}
+			t0 = math.Max(t0, r)
+		} else {
+			if r < t0 {
+				return false
+			}
+			t1 = math.Min(t1, r)
+		}
+		return true
+	}
+	return clip(-dx, a.Lon()-b.MinLon) && clip(dx, b.MaxLon-a.Lon()) &&
+		clip(-dy, a.Lat()-b.MinLat) && clip(dy, b.MaxLat-a.Lat())
+}
+
+// DistanceTo 返回点到折线的最短距离，单位为米
+// 在点附近使用等距圆柱投影求出每条线段上的最近点，再用 Vincenty 公式计算到该点的距离
+func (l LineString) DistanceTo(p Point) float64 {
+	if len(l) == 0 {
+		return math.Inf(1)
+	}
+	if len(l) == 1 {
+		return Distance(p, l[0])
+	}
+	best := math.Inf(1)
+	for i := 1; i < len(l); i++ {
+		if d := Distance(p, closestOnSegment(p, l[i-1], l[i])); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+// closestOnSegment 返回线段 ab 上离 p 最近的点
+func closestOnSegment(p, a, b Point) Point {
+	scale := math.Cos(toRadians(p.Lat()))
+	ax, ay := (a.Lon()-p.Lon())*scale, a.Lat()-p.Lat()
+	bx, by := (b.Lon()-p.Lon())*scale, b.Lat()-p.Lat()
+	dx, dy := bx-ax, by-ay
+	lengthSq := dx*dx + dy*dy
+	if lengthSq == 0 {
+		return a
+	}
+	t := math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lengthSq))
+	return Point{a.Lon() + (b.Lon()-a.Lon())*t, a.Lat() + (b.Lat()-a.Lat())*t}
+}
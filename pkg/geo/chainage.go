@@ -0,0 +1,63 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Chainage 为沿道路的里程，单位为米，通常写作桩号，例如 3200 米为 K3+200
+type Chainage float64
+
+var chainagePattern = regexp.MustCompile(`^[Kk](\d+)\+(\d{1,3}(?:\.\d+)?)$`)
+
+// ParseChainage 解析桩号（如 K3+200、K3+200.5）或以米为单位的数字
+func ParseChainage(s string) (Chainage, error) {
+	s = strings.TrimSpace(s)
+	if m := chainagePattern.FindStringSubmatch(s); m != nil {
+		km, _ := strconv.ParseFloat(m[1], 64)
+		meters, _ := strconv.ParseFloat(m[2], 64)
+		if meters < 1000 {
+			return Chainage(km*1000 + meters), nil
+		}
+	} else if v, err := strconv.ParseFloat(s, 64); err == nil && v >= 0 && !math.IsInf(v, 0) {
+		return Chainage(v), nil
+	}
+	return 0, fmt.Errorf("invalid chainage %q, expected a form like K3+200 or a number of meters", s)
+}
+
+// String 返回桩号形式的里程，不足一米的部分保留到厘米
+func (c Chainage) String() string {
+	cm := int64(math.Round(float64(c) * 100))
+	km, rest := cm/100000, cm%100000
+	s := fmt.Sprintf("K%d+%03d", km, rest/100)
+	if rest%100 != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%02d", rest%100), "0")
+	}
+	return s
+}
+
+// UnmarshalJSON 接受以米为单位的数字或桩号字符串
+func (c *Chainage) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := ParseChainage(s)
+		if err != nil {
+			return err
+		}
+		*c = parsed
+		return nil
+	}
+	var v float64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid chainage %s", data)
+	}
+	if v < 0 {
+		return fmt.Errorf("chainage cannot be negative")
+	}
+	*c = Chainage(v)
+	return nil
+}
@@ -0,0 +1,148 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// CRS 为坐标参考系
+// WGS84 为 GPS 使用的国际标准；GCJ02 为国内地图（高德、腾讯等）使用的加偏坐标；BD09 为百度地图在 GCJ02 基础上再次加偏的坐标
+type CRS string
+
+const (
+	WGS84 CRS = "wgs84"
+	GCJ02 CRS = "gcj02"
+	BD09  CRS = "bd09"
+)
+
+// ParseCRS 解析坐标参考系名称，不区分大小写，空字符串视为 WGS84
+func ParseCRS(s string) (CRS, error) {
+	switch strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(s)) {
+	case "", "wgs84", "epsg:4326":
+		return WGS84, nil
+	case "gcj02":
+		return GCJ02, nil
+	case "bd09", "bd09ll":
+		return BD09, nil
+	}
+	return "", fmt.Errorf("unsupported crs %q, expected wgs84, gcj02 or bd09", s)
+}
+
+// Convert 将点从坐标系 from 转换到坐标系 to
+// GCJ02 的加偏只作用于中国境内，境外的点在 WGS84 和 GCJ02 之间保持不变
+func Convert(p Point, from, to CRS) Point {
+	if from == to {
+		return p
+	}
+	switch from {
+	case GCJ02:
+		p = gcj02ToWGS84(p)
+	case BD09:
+		p = gcj02ToWGS84(bd09ToGCJ02(p))
+	}
+	switch to {
+	case GCJ02:
+		p = wgs84ToGCJ02(p)
+	case BD09:
+		p = gcj02ToBD09(wgs84ToGCJ02(p))
+	}
+	return p
+}
+
+// Convert 将折线的每个点从坐标系 from 转换到坐标系 to
+func (l LineString) Convert(from, to CRS) LineString {
+	if l == nil || from == to {
+		return l
+	}
+	converted := make(LineString, len(l))
+	for i, p := range l {
+		converted[i] = Convert(p, from, to)
+	}
+	return converted
+}
+
+// GCJ02 使用的克拉索夫斯基椭球参数
+const (
+	krasovskyA  = 6378245.0
+	krasovskyEE = 0.00669342162296594323
+	bd09XPi     = math.Pi * 3000.0 / 180.0
+)
+
+func outOfChina(p Point) bool {
+	return p.Lon() < 72.004 || p.Lon() > 137.8347 || p.Lat() < 0.8293 || p.Lat() > 55.8271
+}
+
+func wgs84ToGCJ02(p Point) Point {
+	if outOfChina(p) {
+		return p
+	}
+	dLat := transformLat(p.Lon()-105, p.Lat()-35)
+	dLon := transformLon(p.Lon()-105, p.Lat()-35)
+	radLat := toRadians(p.Lat())
+	magic := math.Sin(radLat)
+	magic = 1 - krasovskyEE*magic*magic
+	sqrtMagic := math.Sqrt(magic)
+	dLat = (dLat * 180) / ((krasovskyA * (1 - krasovskyEE)) / (magic * sqrtMagic) * math.Pi)
+	dLon = (dLon * 180) / (krasovskyA / sqrtMagic * math.Cos(radLat) * math.Pi)
+	return Point{p.Lon() + dLon, p.Lat() + dLat}
+}
+
+// gcj02ToWGS84 通过迭代求 wgs84ToGCJ02 的反函数，误差小于 1e-9 度
+func gcj02ToWGS84(p Point) Point {
+	if outOfChina(p) {
+		return p
+	}
+	w := p
+	for i := 0; i < 30; i++ {
+		g := wgs84ToGCJ02(w)
+		dLon, dLat := g.Lon()-p.Lon(), g.Lat()-p.Lat()
+		w = Point{w.Lon() - dLon, w.Lat() - dLat}
+		if math.Abs(dLon) < 1e-9 && math.Abs(dLat) < 1e-9 {
+			break
+		}
+	}
+	return w
+}
+
+func gcj02ToBD09(p Point) Point {
+	x, y := p.Lon(), p.Lat()
+	z := math.Sqrt(x*x+y*y) + 0.00002*math.Sin(y*bd09XPi)
+	theta := math.Atan2(y, x) + 0.000003*math.Cos(x*bd09XPi)
+	return Point{z*math.Cos(theta) + 0.0065, z*math.Sin(theta) + 0.006}
+}
+
+func bd09ToGCJ02(p Point) Point {
+	x, y := p.Lon()-0.0065, p.Lat()-0.006
+	z := math.Sqrt(x*x+y*y) - 0.00002*math.Sin(y*bd09XPi)
+	theta := math.Atan2(y, x) - 0.000003*math.Cos(x*bd09XPi)
+	return Point{z * math.Cos(theta), z * math.Sin(theta)}
+}
+
+func transformLat(x, y float64) float64 {
+	ret := -100 + 2*x + 3*y + 0.2*y*y + 0.1*x*y + 0.2*math.Sqrt(math.Abs(x))
+	ret += (20*math.Sin(6*x*math.Pi) + 20*math.Sin(2*x*math.Pi)) * 2 / 3
+	ret += (20*math.Sin(y*math.Pi) + 40*math.Sin(y/3*math.Pi)) * 2 / 3
+	ret += (160*math.Sin(y/12*math.Pi) + 320*math.Sin(y*math.Pi/30)) * 2 / 3
+	return ret
+}
+
+func transformLon(x, y float64) float64 {
+	ret := 300 + x + 2*y + 0.1*x*x + 0.1*x*y + 0.1*math.Sqrt(math.Abs(x))
+	ret += (20*math.Sin(6*x*math.Pi) + 20*math.Sin(2*x*math.Pi)) * 2 / 3
+	ret += (20*math.Sin(x*math.Pi) + 40*math.Sin(x/3*math.Pi)) * 2 / 3
+	ret += (150*math.Sin(x/12*math.Pi) + 300*math.Sin(x/30*math.Pi)) * 2 / 3
+	return ret
+}
+
+// ConvertBBox 将外包矩形从坐标系 from 转换到坐标系 to，转换四个角点后取新的外包矩形
+// 偏移量在矩形范围内变化很小，结果足够用于筛选
+func ConvertBBox(b BBox, from, to CRS) BBox {
+	if from == to {
+		return b
+	}
+	corners := LineString{
+		{b.MinLon, b.MinLat}, {b.MaxLon, b.MinLat}, {b.MaxLon, b.MaxLat}, {b.MinLon, b.MaxLat},
+	}
+	return corners.Convert(from, to).Bounds()
+}
@@ -0,0 +1,96 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+// 参考值来自常用的 coordtransform 实现，以天安门附近的 (116.404, 39.915) 为输入
+func TestConvertReferencePoints(t *testing.T) {
+	input := Point{116.404, 39.915}
+	tests := []struct {
+		name     string
+		from, to CRS
+		want     Point
+	}{
+		{"wgs84 to gcj02", WGS84, GCJ02, Point{116.41024449916938, 39.91640428150164}},
+		{"gcj02 to bd09", GCJ02, BD09, Point{116.41036949371029, 39.92133699351022}},
+		{"bd09 to gcj02", BD09, GCJ02, Point{116.39762729119315, 39.90865673957631}},
+		{"same crs", GCJ02, GCJ02, input},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Convert(input, tt.from, tt.to)
+			if !closeTo(got, tt.want, 1e-8) {
+				t.Errorf("Convert(%v, %s, %s) = %v, want %v", input, tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	points := []Point{
+		{116.404, 39.915},
+		{121.4737, 31.2304},
+		{113.2644, 23.1291},
+		{87.6168, 43.8256},
+	}
+	crss := []CRS{WGS84, GCJ02, BD09}
+	for _, p := range points {
+		for _, from := range crss {
+			for _, to := range crss {
+				// GCJ02 的反算是迭代求解的，BD09 的反算使用通行的近似公式，误差约为 1e-6 度（0.1 米左右）
+				tolerance := 1e-8
+				if from == BD09 || to == BD09 {
+					tolerance = 1e-5
+				}
+				back := Convert(Convert(p, from, to), to, from)
+				if !closeTo(back, p, tolerance) {
+					t.Errorf("%v %s -> %s -> %s = %v", p, from, to, from, back)
+				}
+			}
+		}
+	}
+}
+
+func TestConvertOutOfChina(t *testing.T) {
+	for _, p := range []Point{{-0.1276, 51.5072}, {139.6917, 35.6895}, {0, 0}} {
+		if got := Convert(p, WGS84, GCJ02); got != p {
+			t.Errorf("Convert(%v, wgs84, gcj02) = %v, want unchanged", p, got)
+		}
+		if got := Convert(p, GCJ02, WGS84); got != p {
+			t.Errorf("Convert(%v, gcj02, wgs84) = %v, want unchanged", p, got)
+		}
+	}
+}
+
+func TestParseCRS(t *testing.T) {
+	tests := []struct {
+		input string
+		want  CRS
+	}{
+		{"", WGS84},
+		{"WGS84", WGS84},
+		{"wgs-84", WGS84},
+		{"EPSG:4326", WGS84},
+		{"gcj02", GCJ02},
+		{"GCJ-02", GCJ02},
+		{"bd09", BD09},
+		{"bd09ll", BD09},
+	}
+	for _, tt := range tests {
+		got, err := ParseCRS(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseCRS(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+	for _, invalid := range []string{"bd09mc", "epsg:3857", "mercator"} {
+		if _, err := ParseCRS(invalid); err == nil {
+			t.Errorf("ParseCRS(%q) returned no error", invalid)
+		}
+	}
+}
+
+func closeTo(a, b Point, tolerance float64) bool {
+	return math.Abs(a.Lon()-b.Lon()) <= tolerance && math.Abs(a.Lat()-b.Lat()) <= tolerance
+}
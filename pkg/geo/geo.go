@@ -0,0 +1,176 @@
+// Package geo 提供道路几何相关的类型和大地测量计算，坐标均为 WGS-84 经纬度，顺序与 GeoJSON 一致（经度在前）
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// WGS-84 椭球参数
+const (
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+	wgs84B = wgs84A * (1 - wgs84F)
+
+	// meanRadius 为地球平均半径，Vincenty 公式不收敛时使用球面距离
+	meanRadius = 6371008.8
+)
+
+// Point 为一个经纬度坐标，Point[0] 为经度，Point[1] 为纬度
+type Point [2]float64
+
+// Lon 返回经度
+func (p Point) Lon() float64 { return p[0] }
+
+// Lat 返回纬度
+func (p Point) Lat() float64 { return p[1] }
+
+// Validate 检查坐标是否在合法范围内
+func (p Point) Validate() error {
+	if math.IsNaN(p[0]) || math.IsNaN(p[1]) || p[0] < -180 || p[0] > 180 || p[1] < -90 || p[1] > 90 {
+		return fmt.Errorf("coordinate [%g, %g] is out of range", p[0], p[1])
+	}
+	return nil
+}
+
+// LineString 为由若干坐标点依次连接而成的折线
+type LineString []Point
+
+// ErrTooFewPoints 表示折线少于两个点
+var ErrTooFewPoints = errors.New("a LineString needs at least two points")
+
+// Validate 检查折线至少有两个点且每个点的坐标合法
+func (l LineString) Validate() error {
+	if len(l) < 2 {
+		return ErrTooFewPoints
+	}
+	for _, p := range l {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Length 返回折线在 WGS-84 椭球面上的长度，单位为米
+func (l LineString) Length() float64 {
+	total := 0.0
+	for i := 1; i < len(l); i++ {
+		total += Distance(l[i-1], l[i])
+	}
+	return total
+}
+
+// Midpoint 返回沿折线走过一半长度处的点，用作道路的代表点
+func (l LineString) Midpoint() Point {
+	return l.PointAt(l.Length() / 2)
+}
+
+// PointAt 返回沿折线走过 distance 米处的点，超出折线范围时返回最近的端点
+// 两个顶点之间按经纬度线性插值，对道路这样的短线段误差可以忽略
+func (l LineString) PointAt(distance float64) Point {
+	if len(l) == 0 {
+		return Point{}
+	}
+	walked := 0.0
+	for i := 1; i < len(l); i++ {
+		d := Distance(l[i-1], l[i])
+		if d > 0 && walked+d >= distance {
+			return interpolate(l[i-1], l[i], math.Max(distance-walked, 0)/d)
+		}
+		walked += d
+	}
+	if distance <= 0 {
+		return l[0]
+	}
+	return l[len(l)-1]
+}
+
+// Slice 返回折线上沿线距离（从第一个点起算，单位为米）在 [from, to] 之间的部分
+// 两端超出折线范围时截取到折线的端点，from 不小于 to 时返回 nil
+func (l LineString) Slice(from, to float64) LineString {
+	if len(l) < 2 || from >= to {
+		return nil
+	}
+	from = math.Max(from, 0)
+	var sliced LineString
+	walked := 0.0
+	for i := 1; i < len(l); i++ {
+		d := Distance(l[i-1], l[i])
+		start, end := walked, walked+d
+		walked = end
+		if d == 0 || end <= from {
+			continue
+		}
+		if sliced == nil {
+			sliced = append(sliced, interpolate(l[i-1], l[i], (from-start)/d))
+		}
+		if end >= to {
+			return append(sliced, interpolate(l[i-1], l[i], (to-start)/d))
+		}
+		sliced = append(sliced, l[i])
+	}
+	return sliced
+}
+
+// interpolate 按经纬度在 a、b 之间线性插值，t 为 0 时返回 a，为 1 时返回 b
+func interpolate(a, b Point, t float64) Point {
+	return Point{a[0] + (b[0]-a[0])*t, a[1] + (b[1]-a[1])*t}
+}
+
+// Distance 使用 Vincenty 反算公式计算两点在 WGS-84 椭球面上的距离，单位为米
+// 对于几乎对跖的两点公式可能不收敛，此时退化为球面距离
+func Distance(p1, p2 Point) float64 {
+	if p1 == p2 {
+		return 0
+	}
+	L := toRadians(p2.Lon() - p1.Lon())
+	U1 := math.Atan((1 - wgs84F) * math.Tan(toRadians(p1.Lat())))
+	U2 := math.Atan((1 - wgs84F) * math.Tan(toRadians(p2.Lat())))
+	sinU1, cosU1 := math.Sincos(U1)
+	sinU2, cosU2 := math.Sincos(U2)
+
+	lambda := L
+	for i := 0; i < 200; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma := math.Sqrt(math.Pow(cosU2*sinLambda, 2) + math.Pow(cosU1*sinU2-sinU1*cosU2*cosLambda, 2))
+		if sinSigma == 0 {
+			return 0
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha := 1 - sinAlpha*sinAlpha
+		cos2SigmaM := 0.0
+		if cosSqAlpha != 0 {
+			// 两点都在赤道上时 cosSqAlpha 为 0
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+		C := wgs84F / 16 * cosSqAlpha * (4 + wgs84F*(4-3*cosSqAlpha))
+		prev := lambda
+		lambda = L + (1-C)*wgs84F*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prev) < 1e-12 {
+			uSq := cosSqAlpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+			A := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+			B := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+			deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+				B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+			return wgs84B * A * (sigma - deltaSigma)
+		}
+	}
+	return haversine(p1, p2)
+}
+
+// haversine 计算两点在球面上的大圆距离，单位为米
+func haversine(p1, p2 Point) float64 {
+	lat1, lat2 := toRadians(p1.Lat()), toRadians(p2.Lat())
+	dLat := lat2 - lat1
+	dLon := toRadians(p2.Lon() - p1.Lon())
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * meanRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
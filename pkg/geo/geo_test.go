@@ -0,0 +1,181 @@
+package geo
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// dms 将度分秒转换为度，南纬和西经传入负的度数
+func dms(deg, min, sec float64) float64 {
+	if deg < 0 {
+		return deg - min/60 - sec/3600
+	}
+	return deg + min/60 + sec/3600
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name      string
+		p1, p2    Point
+		want      float64
+		tolerance float64
+	}{
+		// Vincenty 原论文中的 Flinders Peak 到 Buninyong 算例
+		{"flinders peak to buninyong", Point{dms(144, 25, 29.52440), dms(-37, 57, 3.72030)}, Point{dms(143, 55, 35.38390), dms(-37, 39, 10.15610)}, 54972.271, 0.001},
+		{"one degree along the equator", Point{0, 0}, Point{1, 0}, 111319.491, 0.001},
+		{"one degree along a meridian", Point{0, 0}, Point{0, 1}, 110574.389, 0.001},
+		{"pole to pole", Point{0, -90}, Point{0, 90}, 20003931.458, 0.001},
+		{"same point", Point{116.3, 39.9}, Point{116.3, 39.9}, 0, 0},
+		// 赤道上的对跖点不收敛，退化为球面距离，误差在千分之一以内
+		{"antipodal on the equator", Point{0, 0}, Point{180, 0}, 20003931.458, 20003931.458 * 0.001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Distance(tt.p1, tt.p2)
+			if math.Abs(got-tt.want) > tt.tolerance {
+				t.Errorf("Distance(%v, %v) = %.3f, want %.3f", tt.p1, tt.p2, got, tt.want)
+			}
+			if back := Distance(tt.p2, tt.p1); math.Abs(back-got) > 1e-6 {
+				t.Errorf("Distance is not symmetric: %.6f and %.6f", got, back)
+			}
+		})
+	}
+}
+
+func TestInside(t *testing.T) {
+	tests := []struct {
+		name   string
+		center Point
+		radius float64
+	}{
+		{"city", Point{116.3, 39.9}, 500},
+		{"equator", Point{0, 0}, 100000},
+		{"southern hemisphere", Point{144.9, -37.8}, 20000},
+		{"high latitude", Point{25.7, 66.5}, 50000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, ok := Inside(tt.center, tt.radius)
+			if !ok {
+				t.Fatalf("Inside(%v, %v) returned false", tt.center, tt.radius)
+			}
+			if !b.Contains(tt.center) {
+				t.Errorf("box %+v does not contain the center", b)
+			}
+			for _, corner := range []Point{{b.MinLon, b.MinLat}, {b.MaxLon, b.MinLat}, {b.MaxLon, b.MaxLat}, {b.MinLon, b.MaxLat}} {
+				if d := Distance(tt.center, corner); d >= tt.radius {
+					t.Errorf("corner %v is %.1f m away, want less than %v", corner, d, tt.radius)
+				}
+			}
+		})
+	}
+
+	if _, ok := Inside(Point{0, 89.99}, 10000); ok {
+		t.Error("box reaching the pole should not be returned")
+	}
+	if _, ok := Inside(Point{179.99, 0}, 10000); ok {
+		t.Error("box crossing the antimeridian should not be returned")
+	}
+}
+
+func TestLineString(t *testing.T) {
+	line := LineString{{0, 0}, {1, 0}, {2, 0}}
+	if got, want := line.Length(), 2*111319.491; math.Abs(got-want) > 0.01 {
+		t.Errorf("Length() = %.3f, want %.3f", got, want)
+	}
+	if got := line.Midpoint(); math.Abs(got.Lon()-1) > 1e-9 || got.Lat() != 0 {
+		t.Errorf("Midpoint() = %v, want [1 0]", got)
+	}
+
+	tests := []struct {
+		distance float64
+		want     Point
+	}{
+		{-10, Point{0, 0}},
+		{0, Point{0, 0}},
+		{111319.491 / 2, Point{0.5, 0}},
+		{111319.491 * 1.5, Point{1.5, 0}},
+		{1e9, Point{2, 0}},
+	}
+	for _, tt := range tests {
+		got := line.PointAt(tt.distance)
+		if math.Abs(got.Lon()-tt.want.Lon()) > 1e-6 || math.Abs(got.Lat()-tt.want.Lat()) > 1e-6 {
+			t.Errorf("PointAt(%g) = %v, want %v", tt.distance, got, tt.want)
+		}
+	}
+
+	slice := line.Slice(111319.491/2, 111319.491*1.5)
+	if len(slice) != 3 || math.Abs(slice[0].Lon()-0.5) > 1e-6 || slice[1] != (Point{1, 0}) || math.Abs(slice[2].Lon()-1.5) > 1e-6 {
+		t.Errorf("Slice() = %v, want [[0.5 0] [1 0] [1.5 0]]", slice)
+	}
+	if got := line.Slice(10, 10); got != nil {
+		t.Errorf("Slice(10, 10) = %v, want nil", got)
+	}
+}
+
+func TestLineStringValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  LineString
+		valid bool
+	}{
+		{"two points", LineString{{116.3, 39.9}, {116.4, 39.9}}, true},
+		{"one point", LineString{{116.3, 39.9}}, false},
+		{"empty", nil, false},
+		{"longitude out of range", LineString{{181, 0}, {0, 0}}, false},
+		{"latitude out of range", LineString{{0, 0}, {0, -91}}, false},
+		{"not a number", LineString{{math.NaN(), 0}, {0, 0}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.line.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestLineStringJSON(t *testing.T) {
+	line := LineString{{116.3, 39.9}, {116.4, 39.95}}
+	data, err := json.Marshal(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"type":"LineString","coordinates":[[116.3,39.9],[116.4,39.95]]}`; string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+	var decoded LineString
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[0] != line[0] || decoded[1] != line[1] {
+		t.Errorf("Unmarshal() = %v, want %v", decoded, line)
+	}
+
+	for _, invalid := range []string{
+		`{"type":"Point","coordinates":[116.3,39.9]}`,
+		`{"type":"LineString","coordinates":"none"}`,
+		`{"coordinates":[[116.3,39.9],[116.4,39.95]]}`,
+	} {
+		var l LineString
+		if err := json.Unmarshal([]byte(invalid), &l); err == nil {
+			t.Errorf("Unmarshal(%s) returned no error", invalid)
+		}
+	}
+}
+
+func TestParseFeatures(t *testing.T) {
+	collection := `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"name":"A"},"geometry":{"type":"LineString","coordinates":[[0,0],[1,0]]}},{"type":"Feature","properties":{"name":"B"},"geometry":{"type":"LineString","coordinates":[[1,0],[2,0]]}}]}`
+	features, err := ParseFeatures([]byte(collection))
+	if err != nil || len(features) != 2 {
+		t.Fatalf("ParseFeatures(collection) = %d features, %v", len(features), err)
+	}
+	feature := `{"type":"Feature","properties":{"name":"A"},"geometry":{"type":"LineString","coordinates":[[0,0],[1,0]]}}`
+	if features, err := ParseFeatures([]byte(feature)); err != nil || len(features) != 1 {
+		t.Errorf("ParseFeatures(feature) = %d features, %v", len(features), err)
+	}
+	for _, invalid := range []string{`not json`, `{"type":"LineString","coordinates":[[0,0],[1,0]]}`, `[]`} {
+		if _, err := ParseFeatures([]byte(invalid)); err == nil {
+			t.Errorf("ParseFeatures(%s) returned no error", invalid)
+		}
+	}
+}
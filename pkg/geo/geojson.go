@@ -0,0 +1,137 @@
+package geo
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	TypeFeatureCollection = "FeatureCollection"
+	TypeFeature           = "Feature"
+	TypePoint             = "Point"
+	TypeLineString        = "LineString"
+	TypePolygon           = "Polygon"
+)
+
+// Geometry 为 GeoJSON 几何对象的通用形式
+type Geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// Feature 为 GeoJSON 要素
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id,omitempty"`
+	Geometry   *Geometry              `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// FeatureCollection 为 GeoJSON 要素集合
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// NewPointGeometry 返回点的 GeoJSON 几何对象
+func NewPointGeometry(p Point) *Geometry {
+	coordinates, _ := json.Marshal(p)
+	return &Geometry{Type: TypePoint, Coordinates: coordinates}
+}
+
+// Geometry 返回折线的 GeoJSON 几何对象
+func (l LineString) Geometry() *Geometry {
+	coordinates, _ := json.Marshal([]Point(l))
+	return &Geometry{Type: TypeLineString, Coordinates: coordinates}
+}
+
+// LineString 将几何对象解析为折线，几何类型不是 LineString 时返回错误
+func (g *Geometry) LineString() (LineString, error) {
+	if g == nil {
+		return nil, errors.New("geometry is missing")
+	}
+	if g.Type != TypeLineString {
+		return nil, fmt.Errorf("unsupported geometry type %q, expected LineString", g.Type)
+	}
+	var points []Point
+	if err := json.Unmarshal(g.Coordinates, &points); err != nil {
+		return nil, fmt.Errorf("invalid LineString coordinates: %w", err)
+	}
+	return LineString(points), nil
+}
+
+// ParseFeatures 解析 GeoJSON 文本，接受 FeatureCollection 或单个 Feature
+func ParseFeatures(data []byte) ([]Feature, error) {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	switch header.Type {
+	case TypeFeatureCollection:
+		var collection FeatureCollection
+		if err := json.Unmarshal(data, &collection); err != nil {
+			return nil, err
+		}
+		return collection.Features, nil
+	case TypeFeature:
+		var feature Feature
+		if err := json.Unmarshal(data, &feature); err != nil {
+			return nil, err
+		}
+		return []Feature{feature}, nil
+	}
+	return nil, fmt.Errorf("unsupported GeoJSON type %q, expected FeatureCollection or Feature", header.Type)
+}
+
+// MarshalJSON 将折线编码为 GeoJSON LineString 几何对象
+func (l LineString) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(l.Geometry())
+}
+
+// UnmarshalJSON 从 GeoJSON LineString 几何对象解码折线
+func (l *LineString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*l = nil
+		return nil
+	}
+	var g Geometry
+	if err := json.Unmarshal(data, &g); err != nil {
+		return err
+	}
+	line, err := g.LineString()
+	if err != nil {
+		return err
+	}
+	*l = line
+	return nil
+}
+
+// Value 将折线以 GeoJSON 文本形式存入数据库
+func (l LineString) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	data, err := l.MarshalJSON()
+	return string(data), err
+}
+
+// Scan 从数据库中的 GeoJSON 文本读取折线
+func (l *LineString) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return l.UnmarshalJSON(v)
+	case string:
+		return l.UnmarshalJSON([]byte(v))
+	}
+	return fmt.Errorf("cannot scan %T into LineString", value)
+}
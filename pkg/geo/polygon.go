@@ -0,0 +1,156 @@
+package geo
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Polygon 为由若干闭合环组成的多边形，第一个环为外边界，其余的环为洞，与 GeoJSON Polygon 一致
+type Polygon []LineString
+
+// ErrInvalidRing 表示多边形的环少于四个点或首尾不相同
+var ErrInvalidRing = errors.New("a Polygon ring needs at least four points and must be closed")
+
+// Validate 检查多边形至少有一个环，每个环闭合且至少有四个点，每个点的坐标合法
+func (g Polygon) Validate() error {
+	if len(g) == 0 {
+		return errors.New("a Polygon needs at least one ring")
+	}
+	for _, ring := range g {
+		if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+			return ErrInvalidRing
+		}
+		for _, p := range ring {
+			if err := p.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Bounds 返回多边形外边界的外包矩形
+func (g Polygon) Bounds() BBox {
+	if len(g) == 0 {
+		return BBox{}
+	}
+	return g[0].Bounds()
+}
+
+// Contains 判断点是否在多边形内，即在外边界内且不在任何洞内，按平面坐标以射线法计算
+func (g Polygon) Contains(p Point) bool {
+	if len(g) == 0 || !g.Bounds().Contains(p) || !ringContains(g[0], p) {
+		return false
+	}
+	for _, hole := range g[1:] {
+		if ringContains(hole, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains 判断点是否在闭合环内，从点向东发出射线，与环的边相交奇数次时在环内
+func ringContains(ring LineString, p Point) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Lat() > p.Lat()) != (b.Lat() > p.Lat()) &&
+			p.Lon() < (b.Lon()-a.Lon())*(p.Lat()-a.Lat())/(b.Lat()-a.Lat())+a.Lon() {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Convert 将多边形的全部坐标从坐标系 from 转换到坐标系 to
+func (g Polygon) Convert(from, to CRS) Polygon {
+	if g == nil || from == to {
+		return g
+	}
+	converted := make(Polygon, len(g))
+	for i, ring := range g {
+		converted[i] = ring.Convert(from, to)
+	}
+	return converted
+}
+
+// Geometry 返回多边形的 GeoJSON 几何对象
+func (g Polygon) Geometry() *Geometry {
+	rings := make([][]Point, len(g))
+	for i, ring := range g {
+		rings[i] = ring
+	}
+	coordinates, _ := json.Marshal(rings)
+	return &Geometry{Type: TypePolygon, Coordinates: coordinates}
+}
+
+// Polygon 将几何对象解析为多边形，几何类型不是 Polygon 时返回错误
+func (g *Geometry) Polygon() (Polygon, error) {
+	if g == nil {
+		return nil, errors.New("geometry is missing")
+	}
+	if g.Type != TypePolygon {
+		return nil, fmt.Errorf("unsupported geometry type %q, expected Polygon", g.Type)
+	}
+	var rings [][]Point
+	if err := json.Unmarshal(g.Coordinates, &rings); err != nil {
+		return nil, fmt.Errorf("invalid Polygon coordinates: %w", err)
+	}
+	polygon := make(Polygon, len(rings))
+	for i, ring := range rings {
+		polygon[i] = ring
+	}
+	return polygon, nil
+}
+
+// MarshalJSON 将多边形编码为 GeoJSON Polygon 几何对象
+func (g Polygon) MarshalJSON() ([]byte, error) {
+	if g == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(g.Geometry())
+}
+
+// UnmarshalJSON 从 GeoJSON Polygon 几何对象解码多边形
+func (g *Polygon) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*g = nil
+		return nil
+	}
+	var geometry Geometry
+	if err := json.Unmarshal(data, &geometry); err != nil {
+		return err
+	}
+	polygon, err := geometry.Polygon()
+	if err != nil {
+		return err
+	}
+	*g = polygon
+	return nil
+}
+
+// Value 将多边形以 GeoJSON 文本形式存入数据库
+func (g Polygon) Value() (driver.Value, error) {
+	if g == nil {
+		return nil, nil
+	}
+	data, err := g.MarshalJSON()
+	return string(data), err
+}
+
+// Scan 从数据库中的 GeoJSON 文本读取多边形
+func (g *Polygon) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*g = nil
+		return nil
+	case []byte:
+		return g.UnmarshalJSON(v)
+	case string:
+		return g.UnmarshalJSON([]byte(v))
+	}
+	return fmt.Errorf("cannot scan %T into Polygon", value)
+}
@@ -0,0 +1,90 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rateLimitEvent 定义数据库中记录的限流事件
+type rateLimitEvent struct {
+	ID  uint      `gorm:"primaryKey"`
+	Key string    `gorm:"size:191;index:idx_rate_limit_key_at"`
+	At  time.Time `gorm:"index:idx_rate_limit_key_at"`
+}
+
+var (
+	keyColumn = clause.Column{Name: "key"}
+	atColumn  = clause.Column{Name: "at"}
+)
+
+// GormStore 是基于数据库的 Store 实现，多个实例连接同一数据库即可共享计数
+// mu 为访问该数据库连接时需要持有的锁，与其他使用同一连接的代码共用
+type GormStore struct {
+	db *gorm.DB
+	mu sync.Locker
+}
+
+func NewGormStore(db *gorm.DB, mu sync.Locker) (*GormStore, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := db.AutoMigrate(&rateLimitEvent{}); err != nil {
+		return nil, err
+	}
+	return &GormStore{db: db, mu: mu}, nil
+}
+
+func (s *GormStore) Add(key string, at time.Time, window time.Duration, limit int) ([]time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []time.Time
+	added := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(clause.Eq{Column: keyColumn, Value: key}).Where(clause.Lte{Column: atColumn, Value: at.Add(-window)}).Delete(&rateLimitEvent{}).Error; err != nil {
+			return err
+		}
+		// 锁住该 key 的事件，多个实例同时检查同一个 key 时依次进行
+		err := tx.Model(&rateLimitEvent{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(clause.Eq{Column: keyColumn, Value: key}).
+			Order(clause.OrderByColumn{Column: atColumn}).
+			Pluck("at", &events).Error
+		if err != nil || len(events) >= limit {
+			return err
+		}
+		if err := tx.Create(&rateLimitEvent{Key: key, At: at}).Error; err != nil {
+			return err
+		}
+		events, added = append(events, at), true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return events, added, nil
+}
+
+func (s *GormStore) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []uint
+	err := s.db.Model(&rateLimitEvent{}).
+		Where(clause.Eq{Column: keyColumn, Value: key}).
+		Order(clause.OrderBy{Columns: []clause.OrderByColumn{{Column: atColumn, Desc: true}, {Column: clause.PrimaryColumn, Desc: true}}}).
+		Limit(1).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return s.db.Delete(&rateLimitEvent{}, ids[0]).Error
+}
+
+func (s *GormStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Where(clause.Eq{Column: keyColumn, Value: key}).Delete(&rateLimitEvent{}).Error
+}
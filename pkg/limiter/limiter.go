@@ -0,0 +1,66 @@
+package limiter
+
+import (
+	"time"
+)
+
+// Store 定义记录事件时间的存储后端
+// 默认使用内存实现，多实例部署时可以换成共享的实现（例如数据库）以共享计数
+type Store interface {
+	// Add 在 window 内的事件少于 limit 次时记录一次事件，检查和记录是原子的
+	// 返回 window 内的全部事件时间（升序，记录成功时包含本次事件）以及是否记录
+	Add(key string, at time.Time, window time.Duration, limit int) ([]time.Time, bool, error)
+	// Remove 删除 key 最近的一次事件
+	Remove(key string) error
+	// Reset 清除 key 的全部事件
+	Reset(key string) error
+}
+
+// SlidingWindow 是基于滑动窗口的限制器：任意 Window 时间内最多允许 Limit 次事件
+// Limit 小于等于 0 时不做任何限制
+type SlidingWindow struct {
+	Store  Store
+	Limit  int
+	Window time.Duration
+}
+
+// Allow 检查 key 是否被限制，未被限制时同时记录一次事件，并发调用时最多只有 Limit 次能够通过
+// 被限制时不记录事件，返回需要等待的时长
+func (l *SlidingWindow) Allow(key string, now time.Time) (time.Duration, error) {
+	if l == nil || l.Limit <= 0 {
+		return 0, nil
+	}
+	events, added, err := l.Store.Add(key, now, l.Window, l.Limit)
+	if err != nil || added {
+		return 0, err
+	}
+	return l.retryAfter(events, now), nil
+}
+
+// Release 撤销 key 最近记录的一次事件，用于事后确认不需要计数的情况
+func (l *SlidingWindow) Release(key string) error {
+	if l == nil || l.Limit <= 0 {
+		return nil
+	}
+	return l.Store.Remove(key)
+}
+
+// Reset 清除 key 的全部事件
+func (l *SlidingWindow) Reset(key string) error {
+	if l == nil || l.Limit <= 0 {
+		return nil
+	}
+	return l.Store.Reset(key)
+}
+
+func (l *SlidingWindow) retryAfter(events []time.Time, now time.Time) time.Duration {
+	if len(events) < l.Limit {
+		return 0
+	}
+	// 只有当倒数第 Limit 次事件滑出窗口后，窗口内的事件数才会重新小于 Limit
+	wait := events[len(events)-l.Limit].Add(l.Window).Sub(now)
+	if wait <= 0 {
+		return 0
+	}
+	return wait
+}
@@ -0,0 +1,166 @@
+package limiter
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := &SlidingWindow{Store: NewMemoryStore(), Limit: 3, Window: time.Minute}
+
+	// 每步为相对 start 的时间、操作和期望的等待时长
+	steps := []struct {
+		offset time.Duration
+		op     string
+		want   time.Duration
+	}{
+		{0, "allow", 0},
+		{10 * time.Second, "allow", 0},
+		{20 * time.Second, "allow", 0},
+		// 窗口内已有 3 次，被拒绝的尝试不计数
+		{30 * time.Second, "allow", 30 * time.Second},
+		{40 * time.Second, "allow", 20 * time.Second},
+		// 第一次事件滑出窗口后，窗口内只剩两次
+		{time.Minute, "allow", 0},
+		{time.Minute, "allow", 10 * time.Second},
+		// 撤销最近一次事件后可以再尝试一次
+		{time.Minute, "release", 0},
+		{time.Minute, "allow", 0},
+		{time.Minute, "allow", 10 * time.Second},
+		{time.Minute, "reset", 0},
+		{time.Minute, "allow", 0},
+		{time.Minute, "allow", 0},
+		{time.Minute, "allow", 0},
+		{time.Minute, "allow", time.Minute},
+	}
+	for i, step := range steps {
+		now := start.Add(step.offset)
+		var got time.Duration
+		var err error
+		switch step.op {
+		case "allow":
+			got, err = l.Allow("k", now)
+		case "release":
+			err = l.Release("k")
+		case "reset":
+			err = l.Reset("k")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != step.want {
+			t.Errorf("step %d: %s at +%s = %s, want %s", i, step.op, step.offset, got, step.want)
+		}
+	}
+}
+
+func TestSlidingWindowKeys(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := &SlidingWindow{Store: NewMemoryStore(), Limit: 1, Window: time.Minute}
+	if wait, _ := l.Allow("a", now); wait != 0 {
+		t.Errorf("first Allow(a) = %s, want 0", wait)
+	}
+	if wait, _ := l.Allow("a", now); wait != time.Minute {
+		t.Errorf("second Allow(a) = %s, want %s", wait, time.Minute)
+	}
+	if wait, _ := l.Allow("b", now); wait != 0 {
+		t.Errorf("Allow(b) = %s, want 0", wait)
+	}
+}
+
+// TestSlidingWindowConcurrent 并发尝试时最多只有 Limit 次能够通过
+func TestSlidingWindowConcurrent(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:limiter_test?mode=memory&cache=shared"), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gormStore, err := NewGormStore(db, &sync.Mutex{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "gorm": gormStore} {
+		t.Run(name, func(t *testing.T) {
+			l := &SlidingWindow{Store: store, Limit: 5, Window: time.Minute}
+			now := time.Now()
+			var allowed atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					wait, err := l.Allow("k", now)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if wait == 0 {
+						allowed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			if got := allowed.Load(); got != 5 {
+				t.Errorf("%d concurrent attempts allowed, want 5", got)
+			}
+
+			if err := l.Release("k"); err != nil {
+				t.Fatal(err)
+			}
+			if wait, _ := l.Allow("k", now); wait != 0 {
+				t.Errorf("Allow after Release = %s, want 0", wait)
+			}
+			if err := l.Reset("k"); err != nil {
+				t.Fatal(err)
+			}
+			if wait, _ := l.Allow("k", now); wait != 0 {
+				t.Errorf("Allow after Reset = %s, want 0", wait)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowDisabled(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var nilLimiter *SlidingWindow
+	for _, l := range []*SlidingWindow{nilLimiter, {Store: NewMemoryStore(), Limit: 0, Window: time.Minute}} {
+		for i := 0; i < 5; i++ {
+			if wait, err := l.Allow("k", now); wait != 0 || err != nil {
+				t.Fatalf("Allow on disabled limiter = %s, %v", wait, err)
+			}
+		}
+		if err := l.Release("k"); err != nil {
+			t.Error(err)
+		}
+		if err := l.Reset("k"); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	if _, _, err := s.Add("old", now, time.Second, 1); err != nil {
+		t.Fatal(err)
+	}
+	later := now.Add(time.Minute)
+	for i := 0; i < sweepInterval; i++ {
+		if _, _, err := s.Add("new", later, time.Second, sweepInterval); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := s.entries["old"]; ok {
+		t.Error("expired key was not swept")
+	}
+	if events, added, _ := s.Add("new", later, time.Second, sweepInterval); added || len(events) != sweepInterval {
+		t.Errorf("Add(new) over the limit returned %d events and added %v, want %d events", len(events), added, sweepInterval)
+	}
+}
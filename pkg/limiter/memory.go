@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+const sweepInterval = 1000
+
+type memoryEntry struct {
+	events []time.Time
+	window time.Duration
+}
+
+// MemoryStore 是进程内的 Store 实现，只适用于单实例部署
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	adds    int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (s *MemoryStore) Add(key string, at time.Time, window time.Duration, limit int) ([]time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	entry.window = window
+	entry.events = prune(entry.events, at, window)
+	added := len(entry.events) < limit
+	if added {
+		entry.events = append(entry.events, at)
+	}
+
+	// 定期清理已经完全过期的 key，避免内存无限增长
+	s.adds++
+	if s.adds%sweepInterval == 0 {
+		for k, e := range s.entries {
+			if len(prune(e.events, at, e.window)) == 0 {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	return append([]time.Time(nil), entry.events...), added, nil
+}
+
+func (s *MemoryStore) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || len(entry.events) == 0 {
+		return nil
+	}
+	entry.events = entry.events[:len(entry.events)-1]
+	return nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// prune 丢弃 window 之外的事件
+func prune(events []time.Time, now time.Time, window time.Duration) []time.Time {
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	return events[i:]
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+)
+
+// LogMailer 只将邮件内容写入日志，适用于开发环境
+type LogMailer struct {
+	From string
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	logger.Info("Mail to ", msg.To, " subject ", msg.Subject, ": ", msg.Body)
+	return nil
+}
+
+var fileSeq atomic.Uint64
+
+// FileMailer 将每封邮件保存为目录下的一个 .eml 文件，适用于测试环境
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") {
+		return errors.New("invalid recipient address")
+	}
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := now.Format("20060102T150405.000000000") + "-" + strconv.FormatUint(fileSeq.Add(1), 10) + ".eml"
+	return os.WriteFile(filepath.Join(m.Dir, name), build(m.From, msg, now), 0o600)
+}
@@ -0,0 +1,68 @@
+package mailer
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// Message 定义一封待发送的邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 为邮件发送的统一接口
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Config 定义创建 Mailer 所需的配置
+type Config struct {
+	Driver       string // smtp, file, log
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	FileDir      string
+}
+
+// New 根据配置创建对应的 Mailer，未知的 driver 视为 log
+func New(cfg Config) Mailer {
+	switch cfg.Driver {
+	case "smtp":
+		return &SMTPMailer{Host: cfg.SMTPHost, Port: cfg.SMTPPort, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.From}
+	case "file":
+		return &FileMailer{Dir: cfg.FileDir, From: cfg.From}
+	default:
+		return &LogMailer{From: cfg.From}
+	}
+}
+
+// build 生成符合 RFC 5322 的邮件内容
+func build(from string, msg Message, now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", encodeHeader(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// encodeHeader 对包含非 ASCII 字符的邮件头进行编码
+func encodeHeader(value string) string {
+	for _, r := range value {
+		if r > 127 {
+			return mime.BEncoding.Encode("UTF-8", value)
+		}
+	}
+	return value
+}
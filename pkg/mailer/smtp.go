@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"errors"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPMailer 通过 SMTP 服务器发送邮件
+// 服务器支持 STARTTLS 时自动启用；Username 为空时不进行认证，便于对接本地的测试 SMTP 服务
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if m.Host == "" {
+		return errors.New("smtp host is not configured")
+	}
+	if strings.ContainsAny(msg.To, "\r\n") {
+		return errors.New("invalid recipient address")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	port := m.Port
+	if port == "" {
+		port = "25"
+	}
+	return smtp.SendMail(net.JoinHostPort(m.Host, port), auth, m.From, []string{msg.To}, build(m.From, msg, time.Now()))
+}
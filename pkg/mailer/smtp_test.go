@@ -0,0 +1,148 @@
+package mailer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession 记录测试 SMTP 服务收到的一次投递
+type smtpSession struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// startSMTPServer 在本地端口启动只处理一个连接的最小 SMTP 服务，不支持 STARTTLS
+func startSMTPServer(t *testing.T) (string, string, <-chan smtpSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		var session smtpSession
+		reply("220 localhost ESMTP test")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"):
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case strings.HasPrefix(command, "AUTH PLAIN "):
+				session.auth = line[len("AUTH PLAIN "):]
+				reply("235 2.7.0 Authentication successful")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				session.from = line[len("MAIL FROM:"):]
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				session.to = append(session.to, line[len("RCPT TO:"):])
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				session.data = data.String()
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 Bye")
+				sessions <- session
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, port, sessions
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	host, port, sessions := startSMTPServer(t)
+	m := &SMTPMailer{Host: host, Port: port, Username: "mailer", Password: "secret", From: "noreply@example.com"}
+
+	err := m.Send(Message{To: "user@example.com", Subject: "重置密码", Body: "第一行\n第二行\n"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	var session smtpSession
+	select {
+	case session = <-sessions:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP server received no mail")
+	}
+
+	if want := base64.StdEncoding.EncodeToString([]byte("\x00mailer\x00secret")); session.auth != want {
+		t.Errorf("AUTH PLAIN = %q, want %q", session.auth, want)
+	}
+	if session.from != "<noreply@example.com>" {
+		t.Errorf("MAIL FROM = %q", session.from)
+	}
+	if len(session.to) != 1 || session.to[0] != "<user@example.com>" {
+		t.Errorf("RCPT TO = %q", session.to)
+	}
+	for _, want := range []string{
+		"From: noreply@example.com\r\n",
+		"To: user@example.com\r\n",
+		"Subject: =?UTF-8?b?",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+		"\r\n\r\n第一行\r\n第二行\r\n",
+	} {
+		if !strings.Contains(session.data, want) {
+			t.Errorf("message does not contain %q:\n%s", want, session.data)
+		}
+	}
+}
+
+func TestSMTPMailerRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		mailer *SMTPMailer
+		to     string
+	}{
+		{"no host", &SMTPMailer{From: "noreply@example.com"}, "user@example.com"},
+		{"header injection", &SMTPMailer{Host: "127.0.0.1", Port: "1", From: "noreply@example.com"}, "user@example.com\r\nBcc: other@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mailer.Send(Message{To: tt.to, Subject: "subject", Body: "body"}); err == nil {
+				t.Error("Send() succeeded, want an error")
+			}
+		})
+	}
+}
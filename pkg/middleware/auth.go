@@ -1,15 +1,27 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
-	"github.com/Slinet6056/road-patrol-backend/internal/config"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/Slinet6056/road-patrol-backend/pkg/token"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func JWTAuth(requiredRoles []string) gin.HandlerFunc {
+const (
+	tenantIDKey = "tenant_id"
+	userIDKey   = "user_id"
+	usernameKey = "username"
+	roleKey     = "role"
+	sessionKey  = "session_id"
+)
+
+// JWTAuth 校验访问令牌并把令牌中的租户、用户和角色写入上下文，具体权限交由 RequirePermission 检查
+func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" || !strings.HasPrefix(tokenString, "Bearer ") {
@@ -19,42 +31,65 @@ func JWTAuth(requiredRoles []string) gin.HandlerFunc {
 		}
 
 		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-		token, err := jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.JWTSecret), nil
-		})
+		claims, err := token.Parse(tokenString, token.TypeAccess)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Error parsing token", "details": err.Error()})
 			c.Abort()
 			return
 		}
 
-		if claims, ok := token.Claims.(*jwt.MapClaims); ok && token.Valid {
-			if role, ok := (*claims)["role"].(string); ok {
-				if !contains(requiredRoles, role) {
-					c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "Insufficient permissions", "required_roles": requiredRoles, "token_role": role})
-					c.Abort()
-					return
-				}
-				c.Next()
+		// 租户只能来自令牌，显式传入与令牌不一致的 tenant_id 视为越权
+		if tenantID := c.Query("tenant_id"); tenantID != "" && tenantID != strconv.FormatUint(uint64(claims.TenantID), 10) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "tenant_id does not match the token"})
+			c.Abort()
+			return
+		}
+
+		// 租户被停用后，已签发的访问令牌也立即失效
+		if err := tenancy.CheckActive(claims.TenantID); err != nil {
+			if errors.Is(err, tenancy.ErrTenantSuspended) || errors.Is(err, tenancy.ErrTenantNotFound) {
+				c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "Tenant is not active"})
 			} else {
-				c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Role claim must be a non-empty string"})
-				c.Abort()
-				return
+				c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+				logger.Error("Could not check tenant status: ", err.Error())
 			}
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Invalid token"})
 			c.Abort()
 			return
 		}
+
+		c.Set(tenantIDKey, claims.TenantID)
+		c.Set(userIDKey, claims.UserID)
+		c.Set(usernameKey, claims.Username)
+		c.Set(roleKey, claims.Role)
+		c.Set(sessionKey, claims.SessionID)
+		c.Next()
 	}
 }
 
-// Helper function to check if a slice contains a string
-func contains(slice []string, str string) bool {
-	for _, v := range slice {
-		if v == str {
-			return true
-		}
-	}
-	return false
+// GetTenantID 获取当前请求令牌中的租户ID，请求没有经过 JWTAuth 时第二个返回值为 false
+// 不能把缺少租户当作 0 处理，0 为平台租户
+func GetTenantID(c *gin.Context) (uint, bool) {
+	value, _ := c.Get(tenantIDKey)
+	tenantID, ok := value.(uint)
+	return tenantID, ok
+}
+
+// GetUserID 获取当前请求令牌中的用户ID
+func GetUserID(c *gin.Context) uint {
+	return c.GetUint(userIDKey)
+}
+
+// GetUsername 获取当前请求令牌中的用户名
+func GetUsername(c *gin.Context) string {
+	return c.GetString(usernameKey)
+}
+
+// GetRole 获取当前请求令牌中的角色
+func GetRole(c *gin.Context) string {
+	return c.GetString(roleKey)
+}
+
+// GetSessionID 获取当前请求令牌所属的会话ID
+func GetSessionID(c *gin.Context) string {
+	return c.GetString(sessionKey)
 }
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/rbac"
+	"github.com/Slinet6056/road-patrol-backend/internal/tenancy"
+	"github.com/Slinet6056/road-patrol-backend/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const permissionsKey = "permissions"
+
+// RequirePermission 检查当前用户的角色是否拥有指定权限，需要在 JWTAuth 之后使用
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		permissions, err := loadPermissions(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "服务器错误"})
+			logger.Error("Could not load permissions: ", err.Error())
+			c.Abort()
+			return
+		}
+
+		if !permissions[permission] {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "Insufficient permissions", "required_permission": permission, "token_role": GetRole(c)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// HasPermission 判断当前用户是否拥有指定权限
+func HasPermission(c *gin.Context, permission string) bool {
+	permissions, err := loadPermissions(c)
+	if err != nil {
+		logger.Error("Could not load permissions: ", err.Error())
+		return false
+	}
+	return permissions[permission]
+}
+
+// loadPermissions 读取当前用户的权限集合，同一请求内只查询一次
+func loadPermissions(c *gin.Context) (map[string]bool, error) {
+	if value, ok := c.Get(permissionsKey); ok {
+		return value.(map[string]bool), nil
+	}
+	tenantID, ok := GetTenantID(c)
+	if !ok {
+		return nil, tenancy.ErrNoTenant
+	}
+	permissions, err := rbac.RolePermissions(tenantID, GetRole(c))
+	if err != nil {
+		return nil, err
+	}
+	c.Set(permissionsKey, permissions)
+	return permissions, nil
+}
@@ -0,0 +1,82 @@
+package password
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cost 为生成哈希时使用的 bcrypt 代价因子
+var Cost = bcrypt.DefaultCost
+
+// MinLength 为密码策略要求的最小长度
+var MinLength = 8
+
+// maxLength 为 bcrypt 能够处理的最大字节数
+const maxLength = 72
+
+// Validate 检查密码是否符合密码策略：长度足够、同时包含字母和数字且不能与用户名相同
+func Validate(plain string, username string) error {
+	if len([]rune(plain)) < MinLength {
+		return errors.New("password is too short")
+	}
+	if len(plain) > maxLength {
+		return errors.New("password is too long")
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range plain {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("password must contain both letters and digits")
+	}
+	if strings.EqualFold(plain, username) {
+		return errors.New("password must not be the same as the username")
+	}
+	return nil
+}
+
+// Hash 使用 bcrypt 生成带盐的密码哈希
+func Hash(plain string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// IsHashed 判断存储的密码是否已经是 bcrypt 哈希
+func IsHashed(stored string) bool {
+	if !strings.HasPrefix(stored, "$2") {
+		return false
+	}
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
+
+// Verify 校验明文密码与存储的密码是否匹配
+// 对于历史遗留的明文密码同样可以校验，此时 needsRehash 为 true，调用方应在校验成功后重新哈希并保存
+// 存储的密码或提交的密码为空时始终校验失败
+func Verify(stored, plain string) (ok bool, needsRehash bool) {
+	if stored == "" || plain == "" {
+		return false, false
+	}
+	if !IsHashed(stored) {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(plain)) == 1
+		return ok, ok
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain)); err != nil {
+		return false, false
+	}
+	cost, _ := bcrypt.Cost([]byte(stored))
+	return true, cost < Cost
+}
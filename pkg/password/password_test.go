@@ -0,0 +1,35 @@
+package password
+
+import "testing"
+
+func TestVerify(t *testing.T) {
+	Cost = 4
+	hashed, err := Hash("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		stored      string
+		plain       string
+		ok          bool
+		needsRehash bool
+	}{
+		{"hashed match", hashed, "secret123", true, false},
+		{"hashed mismatch", hashed, "secret124", false, false},
+		{"legacy plaintext match", "secret123", "secret123", true, true},
+		{"legacy plaintext mismatch", "secret123", "secret", false, false},
+		{"empty stored and empty plain", "", "", false, false},
+		{"empty stored", "", "secret123", false, false},
+		{"empty plain against hash", hashed, "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash := Verify(tt.stored, tt.plain)
+			if ok != tt.ok || needsRehash != tt.needsRehash {
+				t.Errorf("Verify(%q, %q) = %v, %v, want %v, %v", tt.stored, tt.plain, ok, needsRehash, tt.ok, tt.needsRehash)
+			}
+		})
+	}
+}
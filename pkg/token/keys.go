@@ -0,0 +1,265 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key 定义一个签名密钥，只有公钥的密钥仅用于校验
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet 定义当前生效的密钥集合：一个用于签发的密钥和若干个用于校验的密钥
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+	// legacySecret 非空时仍然接受旧版本使用 HS256 签发、没有 kid 的令牌
+	legacySecret []byte
+}
+
+var (
+	keySetMutex sync.RWMutex
+	keySet      *KeySet
+)
+
+// LoadKeys 从目录中加载密钥并替换当前的密钥集合，可以在运行时重复调用以轮换密钥
+// 目录中的每个 PEM 文件是一个密钥，文件名（去掉 .pem 和 .pub 后缀）即为 kid
+// activeKID 为空时使用 kid 字典序最大的私钥签发令牌，目录中没有任何私钥时会生成一个 Ed25519 密钥
+func LoadKeys(dir string, activeKID string, legacySecret string) error {
+	keys, err := readKeyDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var kids []string
+	for kid, key := range keys {
+		if key.Private != nil {
+			kids = append(kids, kid)
+		}
+	}
+	if len(kids) == 0 {
+		key, err := generateKey(dir)
+		if err != nil {
+			return err
+		}
+		keys[key.ID] = key
+		kids = append(kids, key.ID)
+	}
+	sort.Strings(kids)
+
+	if activeKID == "" {
+		activeKID = kids[len(kids)-1]
+	}
+	signing, ok := keys[activeKID]
+	if !ok || signing.Private == nil {
+		return errors.New("no private key found for active kid " + activeKID)
+	}
+
+	set := &KeySet{signing: signing, keys: keys}
+	if legacySecret != "" {
+		set.legacySecret = []byte(legacySecret)
+	}
+
+	keySetMutex.Lock()
+	keySet = set
+	keySetMutex.Unlock()
+	return nil
+}
+
+func currentKeySet() (*KeySet, error) {
+	keySetMutex.RLock()
+	defer keySetMutex.RUnlock()
+	if keySet == nil {
+		return nil, errors.New("signing keys are not loaded")
+	}
+	return keySet, nil
+}
+
+func readKeyDir(dir string) (map[string]*Key, error) {
+	keys := make(map[string]*Key)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return keys, nil
+		}
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".pem"), ".pub")
+		key, err := parseKey(kid, data)
+		if err != nil {
+			return nil, errors.New(entry.Name() + ": " + err.Error())
+		}
+		// 同一个 kid 同时存在私钥和公钥文件时以私钥为准
+		if existing, ok := keys[kid]; ok && existing.Private != nil {
+			continue
+		}
+		keys[kid] = key
+	}
+	return keys, nil
+}
+
+func parseKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, errors.New("unsupported PEM block type " + block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, Private: k, Public: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, Private: k, Public: k.Public()}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, Public: k}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, Public: k}, nil
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+}
+
+// generateKey 生成一个 Ed25519 密钥并保存到目录中，kid 为公钥的 JWK 指纹
+// 保存失败时返回错误，否则密钥只在本进程内有效，重启后或其他实例上已签发的令牌都无法校验
+func generateKey(dir string) (*Key, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := thumbprint(public)
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{ID: kid, Method: jwt.SigningMethodEdDSA, Private: private, Public: public}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, key.ID+".pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// thumbprint 计算公钥的 JWK 指纹（RFC 7638），即按字典序排列必需成员的 JWK 的 SHA-256
+func thumbprint(public crypto.PublicKey) (string, error) {
+	var members string
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		members = `{"e":"` + base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()) +
+			`","kty":"RSA","n":"` + base64.RawURLEncoding.EncodeToString(k.N.Bytes()) + `"}`
+	case ed25519.PublicKey:
+		members = `{"crv":"Ed25519","kty":"OKP","x":"` + base64.RawURLEncoding.EncodeToString(k) + `"}`
+	default:
+		return "", errors.New("only RSA and Ed25519 keys are supported")
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// keyFunc 根据令牌头部的 kid 选择校验密钥，并确保签名算法与密钥类型一致
+func (s *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if s.legacySecret != nil && token.Method == jwt.SigningMethodHS256 {
+			return s.legacySecret, nil
+		}
+		return nil, errors.New("token has no kid")
+	}
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown kid " + kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("signing method does not match the key")
+	}
+	return key.Public, nil
+}
+
+func (s *KeySet) validMethods() []string {
+	methods := []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+	if s.legacySecret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	return methods
+}
+
+// JWKS 返回全部校验密钥的 JSON Web Key Set（RFC 7517）
+func JWKS() (map[string]interface{}, error) {
+	set, err := currentKeySet()
+	if err != nil {
+		return nil, err
+	}
+
+	kids := make([]string, 0, len(set.keys))
+	for kid := range set.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := make([]map[string]string, 0, len(kids))
+	for _, kid := range kids {
+		key := set.keys[kid]
+		jwk := map[string]string{"kid": kid, "use": "sig", "alg": key.Method.Alg()}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks = append(jwks, jwk)
+	}
+	return map[string]interface{}{"keys": jwks}, nil
+}
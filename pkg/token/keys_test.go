@@ -0,0 +1,85 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 7638 第 3.1 节的 RSA 示例
+	rsaKey := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(mustDecode(t, "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")),
+		E: 65537,
+	}
+	// RFC 8037 附录 A.3 的 Ed25519 示例
+	edKey := ed25519.PublicKey(mustDecode(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"))
+
+	tests := []struct {
+		name string
+		key  interface{}
+		want string
+	}{
+		{"rsa", rsaKey, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"},
+		{"ed25519", edKey, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"},
+	}
+	for _, tt := range tests {
+		got, err := thumbprint(tt.key)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: thumbprint() = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := thumbprint("not a key"); err == nil {
+		t.Error("thumbprint() of an unsupported key returned no error")
+	}
+}
+
+func TestLoadKeysGenerates(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	if err := LoadKeys(dir, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	set, err := currentKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := set.signing.ID
+	if want, _ := thumbprint(set.signing.Public); kid != want {
+		t.Errorf("generated kid = %q, want the thumbprint %q", kid, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, kid+".pem")); err != nil {
+		t.Errorf("generated key was not saved: %v", err)
+	}
+
+	// 再次加载时使用保存的密钥，不再生成新的
+	if err := LoadKeys(dir, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if set, _ := currentKeySet(); set.signing.ID != kid {
+		t.Errorf("reloaded kid = %q, want %q", set.signing.ID, kid)
+	}
+}
+
+func TestGenerateKeyUnwritableDir(t *testing.T) {
+	// 以普通文件作为上级目录，无论以什么用户运行都无法创建密钥目录
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generateKey(filepath.Join(file, "keys")); err == nil {
+		t.Error("generateKey() into an unwritable directory returned no error")
+	}
+}
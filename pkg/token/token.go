@@ -0,0 +1,94 @@
+package token
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/Slinet6056/road-patrol-backend/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+	// TypeMFA 为密码校验通过后、两步验证完成前使用的挑战令牌
+	TypeMFA = "mfa"
+
+	AccessTokenTTL  = time.Hour * 2
+	RefreshTokenTTL = time.Hour * 24 * 30
+	MFATokenTTL     = time.Minute * 5
+)
+
+// Claims 定义令牌中携带的声明
+type Claims struct {
+	UserID   uint   `json:"user_id"`
+	TenantID uint   `json:"tenant_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Type     string `json:"type"`
+	// SessionID 为刷新令牌所属的会话（令牌族）ID，访问令牌同样携带以便识别当前会话
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// NewClaims 根据用户信息生成指定类型和有效期的声明
+func NewClaims(user model.User, tokenType string, ttl time.Duration) *Claims {
+	now := time.Now()
+	return &Claims{
+		UserID:   user.ID,
+		TenantID: user.TenantID,
+		Username: user.Username,
+		Role:     user.Role,
+		Type:     tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        NewID(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+}
+
+// Sign 使用当前的签发密钥签发令牌，并在头部写入 kid
+func Sign(claims *Claims) (string, error) {
+	set, err := currentKeySet()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(set.signing.Method, claims)
+	token.Header["kid"] = set.signing.ID
+	return token.SignedString(set.signing.Private)
+}
+
+// Parse 解析并校验令牌，同时检查令牌类型
+func Parse(tokenString string, tokenType string) (*Claims, error) {
+	set, err := currentKeySet()
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, set.keyFunc, jwt.WithValidMethods(set.validMethods()))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if claims.Type != tokenType {
+		return nil, errors.New("unexpected token type")
+	}
+	if claims.Role == "" {
+		return nil, errors.New("role claim must be a non-empty string")
+	}
+	return claims, nil
+}
+
+// NewID 生成随机的令牌ID
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
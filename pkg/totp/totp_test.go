@@ -0,0 +1,105 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret 为 RFC 6238 附录 B 中 SHA1 测试向量使用的密钥 "12345678901234567890" 的 base32 编码
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 附录 B 给出的是 8 位密码，6 位密码为其后 6 位
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, tt := range rfc6238Vectors {
+		got, err := Code(rfc6238Secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.code {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestCodeSecretFormat(t *testing.T) {
+	got, err := Code(" "+strings.ToLower(rfc6238Secret)+" ", Step(time.Unix(59, 0)))
+	if err != nil || got != "287082" {
+		t.Errorf("Code with lower-case secret = %s, %v, want 287082", got, err)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code with invalid secret returned no error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	tests := []struct {
+		name string
+		code string
+		step int64
+		ok   bool
+	}{
+		{"current step", "050471", current, true},
+		{"surrounding spaces", " 050471 ", current, true},
+		{"previous step", mustCode(t, current-1), current - 1, true},
+		{"next step", mustCode(t, current+1), current + 1, true},
+		{"outside skew", mustCode(t, current-2), 0, false},
+		{"wrong code", "000000", 0, false},
+		{"too short", "50471", 0, false},
+		{"too long", "0504710", 0, false},
+		{"empty", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfc6238Secret, tt.code, now)
+			if ok != tt.ok || step != tt.step {
+				t.Errorf("Validate(%q) = %d, %v, want %d, %v", tt.code, step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("GenerateSecret() = %q, decodes to %d bytes, %v", secret, len(key), err)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	got := ProvisioningURI("Road Patrol", "alice@example.com", rfc6238Secret)
+	want := "otpauth://totp/Road%20Patrol:alice@example.com?algorithm=SHA1&digits=6&issuer=Road+Patrol&period=30&secret=" + rfc6238Secret
+	if got != want {
+		t.Errorf("ProvisioningURI() = %s, want %s", got, want)
+	}
+}
+
+func mustCode(t *testing.T, step int64) string {
+	t.Helper()
+	code, err := Code(rfc6238Secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
@@ -0,0 +1,217 @@
+// Package xlsx 读取 Excel 2007 及以后版本（.xlsx）工作簿中第一个工作表的单元格文本
+// 只支持导入数据所需的最小功能：共享字符串、内联字符串、数字和布尔值，不计算公式，不处理日期格式
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// MaxEntrySize 为工作簿中单个文件解压后的最大字节数，防止解压炸弹
+var MaxEntrySize int64 = 64 << 20
+
+// ErrInvalidWorkbook 表示文件不是有效的 xlsx 工作簿
+var ErrInvalidWorkbook = errors.New("invalid xlsx workbook")
+
+type workbook struct {
+	Sheets []struct {
+		RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type relationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// richText 为共享字符串或内联字符串，文本可能直接写在 t 中，也可能分为多段带格式的 r
+type richText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t richText) String() string {
+	var b strings.Builder
+	b.WriteString(t.T)
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+type sharedStrings struct {
+	Items []richText `xml:"si"`
+}
+
+type worksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R  string    `xml:"r,attr"`
+			T  string    `xml:"t,attr"`
+			V  string    `xml:"v"`
+			IS *richText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadRows 读取第一个工作表的全部行，rows[i] 为第 i+1 行，空行为 nil，行尾的空单元格会被省略
+// 行号超过 maxRows 或列号超过 maxColumns 时在补齐空行和空单元格之前返回 ErrInvalidWorkbook，防止很大的行号或列号耗尽内存
+func ReadRows(r io.ReaderAt, size int64, maxRows int, maxColumns int) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkbook, err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	var strs sharedStrings
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decode(f, &strs); err != nil {
+			return nil, err
+		}
+	}
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidWorkbook, sheetPath)
+	}
+	var sheet worksheet
+	if err := decode(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		index := len(rows)
+		if row.R > 0 {
+			index = row.R - 1
+		}
+		if index < len(rows) {
+			return nil, fmt.Errorf("%w: row %d is out of order", ErrInvalidWorkbook, row.R)
+		}
+		if index >= maxRows {
+			return nil, fmt.Errorf("%w: sheet has more than %d rows", ErrInvalidWorkbook, maxRows)
+		}
+		for len(rows) < index {
+			rows = append(rows, nil)
+		}
+		var cells []string
+		for _, cell := range row.Cells {
+			column := len(cells)
+			if cell.R != "" {
+				if column, err = columnIndex(cell.R); err != nil {
+					return nil, err
+				}
+			}
+			if column < len(cells) {
+				return nil, fmt.Errorf("%w: cell %s is out of order", ErrInvalidWorkbook, cell.R)
+			}
+			if column >= maxColumns {
+				return nil, fmt.Errorf("%w: sheet has more than %d columns", ErrInvalidWorkbook, maxColumns)
+			}
+			for len(cells) < column {
+				cells = append(cells, "")
+			}
+			value := cell.V
+			switch cell.T {
+			case "s":
+				i, err := strconv.Atoi(cell.V)
+				if err != nil || i < 0 || i >= len(strs.Items) {
+					return nil, fmt.Errorf("%w: cell %s refers to a missing shared string", ErrInvalidWorkbook, cell.R)
+				}
+				value = strs.Items[i].String()
+			case "inlineStr":
+				if cell.IS != nil {
+					value = cell.IS.String()
+				}
+			case "b":
+				value = map[string]string{"0": "FALSE", "1": "TRUE"}[cell.V]
+			}
+			cells = append(cells, value)
+		}
+		rows = append(rows, cells)
+	}
+	return rows, nil
+}
+
+// firstSheet 通过 workbook.xml 及其关系文件找到第一个工作表的路径
+func firstSheet(files map[string]*zip.File) (string, error) {
+	wf, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", fmt.Errorf("%w: missing xl/workbook.xml", ErrInvalidWorkbook)
+	}
+	var wb workbook
+	if err := decode(wf, &wb); err != nil {
+		return "", err
+	}
+	if len(wb.Sheets) == 0 {
+		return "", fmt.Errorf("%w: workbook has no sheets", ErrInvalidWorkbook)
+	}
+	rf, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return "", fmt.Errorf("%w: missing xl/_rels/workbook.xml.rels", ErrInvalidWorkbook)
+	}
+	var rels relationships
+	if err := decode(rf, &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID == wb.Sheets[0].RID {
+			// Target 一般相对于 xl 目录，也可能是以 / 开头的绝对路径
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return "", fmt.Errorf("%w: first sheet not found", ErrInvalidWorkbook)
+}
+
+// columnIndex 将单元格引用（如 C12）的列转换为从 0 开始的下标
+func columnIndex(ref string) (int, error) {
+	index := 0
+	letters := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		index = index*26 + int(ch-'A'+1)
+		letters++
+	}
+	if letters == 0 || letters > 3 {
+		return 0, fmt.Errorf("%w: invalid cell reference %q", ErrInvalidWorkbook, ref)
+	}
+	return index - 1, nil
+}
+
+func decode(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWorkbook, err)
+	}
+	defer rc.Close()
+	limited := &io.LimitedReader{R: rc, N: MaxEntrySize + 1}
+	if err := xml.NewDecoder(limited).Decode(v); err != nil {
+		if limited.N <= 0 {
+			return fmt.Errorf("%w: %s exceeds %d bytes", ErrInvalidWorkbook, f.Name, MaxEntrySize)
+		}
+		return fmt.Errorf("%w: %s: %v", ErrInvalidWorkbook, f.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testWorkbook = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const testRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`
+
+const testSharedStrings = `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>name</t></si><si><r><t>Main </t></r><r><t>Street</t></r></si></sst>`
+
+// buildWorkbook 将 files 打包为 xlsx 文件，键为文件在压缩包中的路径
+func buildWorkbook(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// sheetFiles 返回只包含一个工作表的工作簿的文件，sheetData 为工作表 sheetData 元素的内容
+func sheetFiles(sheetData string) map[string]string {
+	return map[string]string{
+		"xl/workbook.xml":            testWorkbook,
+		"xl/_rels/workbook.xml.rels": testRels,
+		"xl/sharedStrings.xml":       testSharedStrings,
+		"xl/worksheets/sheet1.xml":   `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + sheetData + `</sheetData></worksheet>`,
+	}
+}
+
+func TestReadRows(t *testing.T) {
+	tests := []struct {
+		name      string
+		sheetData string
+		want      [][]string
+	}{
+		{
+			name:      "shared, inline, number and boolean cells",
+			sheetData: `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><t>length</t></is></c></row><row r="2"><c r="A2" t="s"><v>1</v></c><c r="B2"><v>12.5</v></c><c r="C2" t="b"><v>1</v></c></row>`,
+			want:      [][]string{{"name", "length"}, {"Main Street", "12.5", "TRUE"}},
+		},
+		{
+			name:      "missing rows and cells are padded",
+			sheetData: `<row r="1"><c r="B1"><v>1</v></c></row><row r="3"><c r="C3"><v>2</v></c></row>`,
+			want:      [][]string{{"", "1"}, nil, {"", "", "2"}},
+		},
+		{
+			name:      "rows and cells without references follow the previous ones",
+			sheetData: `<row><c><v>1</v></c><c><v>2</v></c></row><row><c><v>3</v></c></row>`,
+			want:      [][]string{{"1", "2"}, {"3"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildWorkbook(t, sheetFiles(tt.sheetData))
+			rows, err := ReadRows(bytes.NewReader(data), int64(len(data)), 100, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("ReadRows() = %q, want %q", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRowsInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"huge row number", sheetFiles(`<row r="2000000000"><c r="A2000000000"><v>1</v></c></row>`)},
+		{"row past the limit", sheetFiles(`<row r="101"><c r="A101"><v>1</v></c></row>`)},
+		{"too many rows without references", sheetFiles(strings.Repeat(`<row><c><v>1</v></c></row>`, 101))},
+		{"huge column", sheetFiles(`<row r="1"><c r="XFD1"><v>1</v></c></row>`)},
+		{"column past the limit", sheetFiles(`<row r="1"><c r="K1"><v>1</v></c></row>`)},
+		{"too many cells without references", sheetFiles(`<row r="1">` + strings.Repeat(`<c><v>1</v></c>`, 11) + `</row>`)},
+		{"rows out of order", sheetFiles(`<row r="2"></row><row r="1"></row>`)},
+		{"cells out of order", sheetFiles(`<row r="1"><c r="B1"><v>1</v></c><c r="A1"><v>2</v></c></row>`)},
+		{"invalid cell reference", sheetFiles(`<row r="1"><c r="1A"><v>1</v></c></row>`)},
+		{"missing shared string", sheetFiles(`<row r="1"><c r="A1" t="s"><v>5</v></c></row>`)},
+		{"negative shared string", sheetFiles(`<row r="1"><c r="A1" t="s"><v>-1</v></c></row>`)},
+		{"malformed sheet", sheetFiles(`<row r="1"><c r="A1"><v>1</v></row>`)},
+		{"missing workbook", map[string]string{"xl/worksheets/sheet1.xml": "<worksheet/>"}},
+		{"missing sheet", map[string]string{"xl/workbook.xml": testWorkbook, "xl/_rels/workbook.xml.rels": testRels}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildWorkbook(t, tt.files)
+			if _, err := ReadRows(bytes.NewReader(data), int64(len(data)), 100, 10); !errors.Is(err, ErrInvalidWorkbook) {
+				t.Errorf("ReadRows() error = %v, want ErrInvalidWorkbook", err)
+			}
+		})
+	}
+}
+
+func TestReadRowsNotZip(t *testing.T) {
+	data := []byte("name,length\nMain Street,12.5\n")
+	if _, err := ReadRows(bytes.NewReader(data), int64(len(data)), 100, 10); !errors.Is(err, ErrInvalidWorkbook) {
+		t.Errorf("ReadRows() error = %v, want ErrInvalidWorkbook", err)
+	}
+}
+
+func TestReadRowsEntrySize(t *testing.T) {
+	defer func(size int64) { MaxEntrySize = size }(MaxEntrySize)
+	MaxEntrySize = 256
+	data := buildWorkbook(t, sheetFiles(strings.Repeat(`<row><c><v>1</v></c></row>`, 50)))
+	if _, err := ReadRows(bytes.NewReader(data), int64(len(data)), 100, 10); !errors.Is(err, ErrInvalidWorkbook) {
+		t.Errorf("ReadRows() error = %v, want ErrInvalidWorkbook", err)
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want int
+	}{
+		{"A1", 0},
+		{"Z9", 25},
+		{"AA10", 26},
+		{"XFD1048576", 16383},
+	}
+	for _, tt := range tests {
+		got, err := columnIndex(tt.ref)
+		if err != nil || got != tt.want {
+			t.Errorf("columnIndex(%q) = %d, %v, want %d", tt.ref, got, err, tt.want)
+		}
+	}
+	for _, ref := range []string{"", "1", "a1", "ABCD1"} {
+		if _, err := columnIndex(ref); !errors.Is(err, ErrInvalidWorkbook) {
+			t.Errorf("columnIndex(%q) error = %v, want ErrInvalidWorkbook", ref, err)
+		}
+	}
+}